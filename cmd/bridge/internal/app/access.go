@@ -0,0 +1,183 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// AccessConfig restricts the source addresses a listener accepts. Entries
+// are CIDR prefixes such as "10.0.0.0/8" or single addresses. Deny entries
+// take precedence; if allow entries exist, a client must match one of them.
+type AccessConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// validate reports entries that are neither a prefix nor an address.
+func (a AccessConfig) validate(path string, add func(string, error)) {
+	for i, entry := range a.Allow {
+		if _, err := parsePrefix(entry); err != nil {
+			add(fmt.Sprintf("%s.allow[%d]", path, i), err)
+		}
+	}
+	for i, entry := range a.Deny {
+		if _, err := parsePrefix(entry); err != nil {
+			add(fmt.Sprintf("%s.deny[%d]", path, i), err)
+		}
+	}
+}
+
+// parsePrefix accepts a CIDR prefix or a single address, which is treated as
+// a prefix of full length.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q", entry)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", entry)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// accessList is the compiled form of an AccessConfig.
+type accessList struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+func newAccessList(cfg AccessConfig) (accessList, error) {
+	var l accessList
+	for _, entry := range cfg.Allow {
+		p, err := parsePrefix(entry)
+		if err != nil {
+			return accessList{}, err
+		}
+		l.allow = append(l.allow, p)
+	}
+	for _, entry := range cfg.Deny {
+		p, err := parsePrefix(entry)
+		if err != nil {
+			return accessList{}, err
+		}
+		l.deny = append(l.deny, p)
+	}
+	return l, nil
+}
+
+// allows reports whether a client connecting from addr passes the list.
+func (l accessList) allows(addr netip.Addr) bool {
+	for _, p := range l.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(l.allow) == 0 {
+		return true
+	}
+	for _, p := range l.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessRules holds the admission settings that Reload can replace.
+type accessRules struct {
+	// lists maps the listener name to its access list.
+	lists      map[string]accessList
+	maxClients int
+	maxPerIP   int
+}
+
+func newAccessRules(cfg Config) (*accessRules, error) {
+	rules := &accessRules{
+		lists:      make(map[string]accessList),
+		maxClients: cfg.MaxClients,
+		maxPerIP:   cfg.MaxClientsPerIP,
+	}
+	for _, listener := range cfg.listeners() {
+		l, err := newAccessList(listener.Access)
+		if err != nil {
+			return nil, err
+		}
+		rules.lists[listener.name()] = l
+	}
+	return rules, nil
+}
+
+// admission counts the admitted connections, in total and per source
+// address, to enforce the connection limits.
+type admission struct {
+	mu    sync.Mutex
+	total int
+	perIP map[netip.Addr]int
+}
+
+// remoteIP extracts the IP address of a client connection; ok is false for
+// connections without one, such as Unix domain sockets.
+func remoteIP(conn net.Conn) (addr netip.Addr, ok bool) {
+	ap, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
+
+// admit decides whether a new connection on the named listener may proceed and
+// reserves a slot for it. It returns the reason for a rejection or "" if
+// the connection was admitted; admitted connections must be released.
+func (b *Bridge) admit(listener string, conn net.Conn) string {
+	rules := b.access.Load()
+	ip, hasIP := remoteIP(conn)
+	if hasIP && !rules.lists[listener].allows(ip) {
+		return "address not allowed"
+	}
+
+	a := &b.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if rules.maxClients > 0 && a.total >= rules.maxClients {
+		return "client limit reached"
+	}
+	if hasIP && rules.maxPerIP > 0 && a.perIP[ip] >= rules.maxPerIP {
+		return "per-address client limit reached"
+	}
+	a.total++
+	if hasIP {
+		if a.perIP == nil {
+			a.perIP = make(map[netip.Addr]int)
+		}
+		a.perIP[ip]++
+	}
+	return ""
+}
+
+// release frees the slot reserved by admit.
+func (b *Bridge) release(conn net.Conn) {
+	a := &b.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total--
+	if ip, ok := remoteIP(conn); ok {
+		if a.perIP[ip]--; a.perIP[ip] <= 0 {
+			delete(a.perIP, ip)
+		}
+	}
+}
+
+// rejectClient logs and closes a connection that was refused admission.
+func (b *Bridge) rejectClient(conn net.Conn, log Logger, reason string) {
+	b.rejectedClients.Add(1)
+	log.Warn("client rejected", "reason", reason)
+	_ = conn.Close()
+}
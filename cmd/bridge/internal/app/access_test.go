@@ -0,0 +1,79 @@
+package app
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// addrConn is a connection stub with a fixed remote address.
+type addrConn struct {
+	net.Conn
+	remote string
+}
+
+func (c addrConn) RemoteAddr() net.Addr {
+	return net.TCPAddrFromAddrPort(netip.MustParseAddrPort(c.remote))
+}
+
+func TestAccessList(t *testing.T) {
+	l, err := newAccessList(AccessConfig{
+		Allow: []string{"192.168.1.0/24", "::1"},
+		Deny:  []string{"192.168.1.13"},
+	})
+	if err != nil {
+		t.Fatalf("newAccessList returned error: %v", err)
+	}
+	cases := map[string]bool{
+		"192.168.1.20": true,
+		"192.168.1.13": false,
+		"10.0.0.1":     false,
+		"::1":          true,
+	}
+	for addr, want := range cases {
+		if got := l.allows(netip.MustParseAddr(addr)); got != want {
+			t.Fatalf("allows(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if _, err := newAccessList(AccessConfig{Deny: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatalf("expected error for invalid prefix")
+	}
+}
+
+func TestAdmitLimits(t *testing.T) {
+	b := newTestBridge(t)
+	b.access.Store(&accessRules{
+		lists: map[string]accessList{
+			protocolGVRET: {deny: []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}},
+		},
+		maxClients: 3,
+		maxPerIP:   2,
+	})
+
+	first := addrConn{remote: "192.0.2.1:5000"}
+	second := addrConn{remote: "192.0.2.1:5001"}
+	if reason := b.admit(protocolGVRET, first); reason != "" {
+		t.Fatalf("first client rejected: %s", reason)
+	}
+	if reason := b.admit(protocolGVRET, second); reason != "" {
+		t.Fatalf("second client rejected: %s", reason)
+	}
+	if reason := b.admit(protocolGVRET, addrConn{remote: "[::ffff:192.0.2.1]:5002"}); reason != "per-address client limit reached" {
+		t.Fatalf("expected per-address limit, got %q", reason)
+	}
+	if reason := b.admit(protocolGVRET, addrConn{remote: "203.0.113.7:5000"}); reason != "address not allowed" {
+		t.Fatalf("expected denied address, got %q", reason)
+	}
+	if reason := b.admit(protocolGVRET, addrConn{remote: "192.0.2.2:5000"}); reason != "" {
+		t.Fatalf("third client rejected: %s", reason)
+	}
+	if reason := b.admit(protocolGVRET, addrConn{remote: "192.0.2.3:5000"}); reason != "client limit reached" {
+		t.Fatalf("expected global limit, got %q", reason)
+	}
+
+	b.release(first)
+	if reason := b.admit(protocolGVRET, addrConn{remote: "192.0.2.1:5003"}); reason != "" {
+		t.Fatalf("client rejected after release: %s", reason)
+	}
+}
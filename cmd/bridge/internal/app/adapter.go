@@ -0,0 +1,436 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/canlog"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// errFailback cancels a session on a secondary adapter once the primary is
+// reachable again.
+var errFailback = errors.New("primary adapter reachable again")
+
+// Adapter backends selected by Config.Backend.
+const (
+	backendEByte     = "ebyte"
+	backendGVRET     = "gvret"
+	backendSocketCAN = "socketcan"
+)
+
+// stableSession is how long an adapter session has to last before the
+// reconnect backoff starts over; adapters that drop connections right after
+// accepting them keep backing off.
+const stableSession = 10 * time.Second
+
+// backends lists the valid values of Config.Backend.
+var backends = []string{backendEByte, backendGVRET, backendSocketCAN}
+
+// adapterEndpoints returns the primary adapter address followed by the
+// configured failover addresses, or the interface of the SocketCAN backend.
+func (b *Bridge) adapterEndpoints() []string {
+	if b.cfg.Backend == backendSocketCAN {
+		return []string{b.cfg.SocketCAN.Interface}
+	}
+	return append([]string{b.cfg.EByteAddress}, b.cfg.FailoverAddresses...)
+}
+
+// runAdapterLoop keeps attempting to connect to the adapter until the context
+// is cancelled, backing off exponentially while the adapter is unreachable.
+// With failover addresses configured, it moves on to the next endpoint after
+// FailoverAfter consecutive failures and returns to the primary once a probe
+// shows that it is reachable again. Clients stay connected throughout.
+func (b *Bridge) runAdapterLoop(ctx context.Context) error {
+	bo := newBackoff(
+		time.Duration(b.cfg.ReconnectDelay),
+		time.Duration(b.cfg.ReconnectMaxDelay),
+		b.cfg.ReconnectMultiplier,
+		b.cfg.ReconnectJitter,
+	)
+	endpoints := b.adapterEndpoints()
+	active := 0
+	failures := 0
+	attempt := 0
+	lastSuccess := b.start
+
+	// stay lasts while secondary adapters are in use. Its failback probe
+	// runs across sessions and reconnects, and cancels it with errFailback
+	// once the primary is reachable again.
+	stay, leave := ctx, context.CancelCauseFunc(func(error) {})
+	defer func() { leave(nil) }()
+
+	for {
+		if errors.Is(context.Cause(stay), errFailback) {
+			b.adapterLog.Warn("adapter failback", "from", endpoints[active], "to", endpoints[0])
+			b.notifyStatus("failing back to primary adapter %s", endpoints[0])
+			active, failures, attempt = 0, 0, 0
+			stay = ctx
+			bo.Reset()
+		}
+
+		attempt++
+		addr := endpoints[active]
+		b.activeAdapter.Store(addr)
+		log := b.adapterLog.With("adapter", addr)
+
+		b.notifyStatus("connecting to adapter %s (attempt %d)", addr, attempt)
+		started := time.Now()
+		connected, err := b.connectAndServe(stay, addr, log)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if stay.Err() != nil {
+			continue
+		}
+
+		if connected {
+			// Only failed connection attempts count towards failover, so a
+			// drop after a working session starts the count over.
+			failures = 0
+			lastSuccess = time.Now()
+		} else {
+			failures++
+		}
+		if connected && time.Since(started) >= stableSession {
+			// The session worked for a while, so start over with short
+			// delays instead of continuing the previous backoff sequence.
+			bo.Reset()
+			attempt = 1
+		}
+
+		if len(endpoints) > 1 && failures >= b.cfg.FailoverAfter {
+			next := (active + 1) % len(endpoints)
+			log.Warn("adapter failover",
+				"error", err,
+				"from", addr,
+				"to", endpoints[next],
+				"failures", failures)
+			b.notifyStatus("failing over to adapter %s after %d failures", endpoints[next], failures)
+			switch {
+			case next == 0:
+				leave(nil)
+				stay = ctx
+			case active == 0 && b.cfg.FailbackInterval > 0:
+				stay, leave = context.WithCancelCause(ctx)
+				probeCtx, found := stay, leave
+				b.spawn(func() { b.probeFailback(probeCtx, endpoints[0], found) })
+			}
+			active, failures, attempt = next, 0, 0
+			bo.Reset()
+			continue
+		}
+
+		delay := bo.Next()
+		log.Warn("adapter connection lost",
+			"error", err,
+			"attempt", attempt,
+			"since_last_success", time.Since(lastSuccess).Round(time.Millisecond),
+			"retry_in", delay.Round(time.Millisecond))
+		b.notifyStatus("adapter %s unavailable, retrying in %s", addr, delay.Round(time.Millisecond))
+		b.expectProgress(delay)
+		if err := sleepContext(stay, delay); err != nil && ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// probeFailback periodically checks whether the primary adapter accepts
+// connections again and cancels the current session if it does.
+func (b *Bridge) probeFailback(ctx context.Context, primary string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(time.Duration(b.cfg.FailbackInterval))
+	defer ticker.Stop()
+
+	dialer := net.Dialer{Timeout: time.Duration(b.cfg.DialTimeout)}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", primary)
+		if err != nil {
+			b.adapterLog.Debug("primary adapter still unreachable", "adapter", primary, "error", err)
+			continue
+		}
+		_ = conn.Close()
+		cancel(errFailback)
+		return
+	}
+}
+
+// errLinkSilent is returned when the watchdog concludes that the connection
+// to the adapter is dead because nothing was received for too long.
+var errLinkSilent = errors.New("no data from adapter within idle timeout")
+
+// adapterReadTimeout bounds a single read so that cancellation and the
+// watchdog are checked regularly even without a watchdog deadline.
+const adapterReadTimeout = 30 * time.Second
+
+// connectAndServe maintains the adapter session and broadcasts received frames
+// until an error occurs. The returned flag reports whether the connection was
+// established at all.
+func (b *Bridge) connectAndServe(ctx context.Context, addr string, log Logger) (bool, error) {
+	if b.cfg.Backend == backendSocketCAN {
+		return b.serveSocketCAN(ctx, addr, log)
+	}
+	conn, err := b.dialAdapter(ctx, addr)
+	if err != nil {
+		return false, fmt.Errorf("dial adapter: %w", err)
+	}
+	if b.cfg.Backend == backendGVRET {
+		return b.serveGVRET(ctx, conn, addr, log)
+	}
+	b.adapterUp(conn.RemoteAddr().String(), addr, log)
+
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		b.adapterWriter(ctx, conn, log, stopWriter, func(tx txFrame) error {
+			return b.writeAdapterFrame(conn, tx)
+		})
+	}()
+
+	// Unblock the pending read as soon as the session ends; the connection
+	// stays open so that the writer can flush pending transmits.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer func() {
+		stop()
+		b.adapterConnected.Store(false)
+		close(stopWriter)
+		<-writerDone
+		_ = conn.Close()
+		log.Info("disconnected from adapter")
+	}()
+
+	idleTimeout := time.Duration(b.cfg.AdapterIdleTimeout)
+	lastData := time.Now()
+	buf := make([]byte, 4096)
+	frameBuf := make([]byte, 0, 4096)
+
+	for {
+		// Arm the deadline before checking for cancellation so that it
+		// cannot replace the one set when the session ended.
+		deadline := b.readDeadline(lastData)
+		_ = conn.SetReadDeadline(deadline)
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		b.expectProgress(time.Until(deadline))
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				if idleTimeout > 0 && time.Since(lastData) >= idleTimeout {
+					if b.handleSilence(ctx, log, nil, time.Since(lastData)) {
+						lastData = time.Now()
+						continue
+					}
+					return true, errLinkSilent
+				}
+				continue
+			}
+			return true, fmt.Errorf("adapter read: %w", err)
+		}
+		lastData = time.Now()
+		b.lastAdapterData.Store(lastData.UnixNano())
+
+		frameBuf = append(frameBuf, buf[:n]...)
+		for len(frameBuf) >= ebyte.FrameSize {
+			frameBytes := frameBuf[:ebyte.FrameSize]
+			frameBuf = frameBuf[ebyte.FrameSize:]
+			frame, err := ebyte.ParseFrame(frameBytes)
+			if err != nil {
+				log.Warn("discarding invalid frame", "raw", fmt.Sprintf("% X", frameBytes), "error", err)
+				continue
+			}
+			b.deliverFrame(frame, 0, time.Now())
+		}
+	}
+}
+
+// dialAdapter opens the TCP connection to the adapter with the configured
+// timeout and keepalive settings.
+func (b *Bridge) dialAdapter(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout: time.Duration(b.cfg.DialTimeout),
+		KeepAliveConfig: net.KeepAliveConfig{
+			Enable:   b.cfg.KeepAliveIdle > 0,
+			Idle:     time.Duration(b.cfg.KeepAliveIdle),
+			Interval: time.Duration(b.cfg.KeepAliveInterval),
+			Count:    b.cfg.KeepAliveCount,
+		},
+	}
+	if b.cfg.KeepAliveIdle <= 0 {
+		dialer.KeepAlive = -1
+	}
+	if dialer.Timeout > 0 {
+		b.expectProgress(dialer.Timeout)
+	} else {
+		// without a dial timeout the operating system's connect timeout
+		// bounds the attempt
+		b.expectProgress(3 * time.Minute)
+	}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// adapterUp records an established adapter session with the device at
+// remote.
+func (b *Bridge) adapterUp(remote, addr string, log Logger) {
+	log.Info("connected to adapter", "remote", remote)
+	b.adapterConnected.Store(true)
+	b.adapterSessions.Add(1)
+	b.notifyStatus("connected to adapter %s", addr)
+	b.notifyReady()
+}
+
+// readDeadline returns when the adapter loop has to check on the link
+// again, given the time data was last received.
+func (b *Bridge) readDeadline(lastData time.Time) time.Time {
+	deadline := time.Now().Add(adapterReadTimeout)
+	if idleTimeout := time.Duration(b.cfg.AdapterIdleTimeout); idleTimeout > 0 {
+		deadline = minTime(deadline, lastData.Add(idleTimeout))
+	}
+	return deadline
+}
+
+// deliverFrame passes a frame received on bus from the adapter, or from a
+// replay standing in for it, to the statistics, the traces and the clients.
+func (b *Bridge) deliverFrame(frame ebyte.Frame, bus uint8, now time.Time) {
+	b.stats.Observe(frame, now)
+	b.traceFrame(canlog.Record{Time: now, Bus: int(bus), Frame: frame})
+	if b.mirror != nil {
+		b.mirror.send(frame)
+	}
+	if t := b.tunnel.Load(); t != nil {
+		t.send(frame)
+	}
+	b.broadcastFrame(frame, bus)
+}
+
+// txFrame is a client frame queued for the adapter together with the index
+// of the bus to send it on.
+type txFrame struct {
+	frame ebyte.Frame
+	bus   uint8
+	// mirrored marks frames that came from the SocketCAN mirror, which must
+	// not be mirrored back.
+	mirrored bool
+	// tunneled marks frames that came from the cannelloni peer, which must
+	// not be sent back to it.
+	tunneled bool
+}
+
+// transmit queues a client frame for bus of the adapter. Frames are dropped
+// while no adapter is connected so that stale commands are not put on the
+// bus after a reconnect.
+func (b *Bridge) transmit(c *client, frame ebyte.Frame, bus uint8) {
+	if !b.adapterConnected.Load() {
+		c.log.Debug("dropping transmit frame, adapter not connected", "frame_id", formatID(frame.ID, frame.Extended))
+		return
+	}
+	select {
+	case b.txCh <- txFrame{frame: frame, bus: bus}:
+	default:
+		c.log.Warn("transmit queue full, dropping frame", "frame_id", formatID(frame.ID, frame.Extended))
+	}
+}
+
+// adapterLink is the part of an adapter connection the writer needs.
+type adapterLink interface {
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// adapterWriter sends queued client frames to the adapter with write until
+// stop is closed. If the session ends because the bridge shuts down, the
+// frames still queued are flushed within the shutdown timeout first.
+func (b *Bridge) adapterWriter(ctx context.Context, conn adapterLink, log Logger, stop <-chan struct{}, write func(txFrame) error) {
+	for {
+		select {
+		case tx := <-b.txCh:
+			if err := write(tx); err != nil {
+				log.Warn("adapter write failed", "frame_id", formatID(tx.frame.ID, tx.frame.Extended), "error", err)
+				// Make the reader notice the broken connection.
+				_ = conn.Close()
+				return
+			}
+		case <-stop:
+			if ctx.Err() == nil {
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(time.Duration(b.cfg.ShutdownTimeout)))
+			for {
+				select {
+				case tx := <-b.txCh:
+					if err := write(tx); err != nil {
+						log.Warn("adapter flush failed", "pending", len(b.txCh)+1, "error", err)
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeAdapterFrame serialises a frame into the EByte format and writes it.
+// The adapter has a single bus, so the bus index is ignored.
+func (b *Bridge) writeAdapterFrame(conn net.Conn, tx txFrame) error {
+	raw, err := ebyte.SerializeFrame(tx.frame)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return err
+	}
+	tx.bus = 0
+	b.observeTransmit(tx, time.Now())
+	return nil
+}
+
+// observeTransmit counts, traces, mirrors and tunnels a frame sent to the
+// adapter.
+func (b *Bridge) observeTransmit(tx txFrame, now time.Time) {
+	b.stats.Observe(tx.frame, now)
+	b.traceFrame(canlog.Record{Time: now, Bus: int(tx.bus), Dir: canlog.Tx, Frame: tx.frame})
+	if b.mirror != nil && !tx.mirrored {
+		b.mirror.send(tx.frame)
+	}
+	if t := b.tunnel.Load(); t != nil && !tx.tunneled {
+		t.send(tx.frame)
+	}
+}
+
+// handleSilence decides what a watchdog expiry means. If the adapter can be
+// probed and answers, the link is fine and only the bus is quiet, so the
+// session is kept and true is returned. Without a probe - the EByte TCP
+// protocol has no status request - or when the probe fails, the link is
+// considered dead and the caller reconnects.
+func (b *Bridge) handleSilence(ctx context.Context, log Logger, probe func(context.Context) error, silent time.Duration) bool {
+	if probe != nil {
+		probeCtx, cancel := context.WithTimeout(ctx, time.Duration(b.cfg.DialTimeout))
+		err := probe(probeCtx)
+		cancel()
+		if err == nil {
+			b.busSilentEvents.Add(1)
+			log.Info("bus silent, adapter link alive", "silent_for", silent.Round(time.Millisecond))
+			return true
+		}
+		log.Debug("adapter status probe failed", "error", err)
+	}
+	b.linkSilentEvents.Add(1)
+	log.Warn("adapter link silent, forcing reconnect", "silent_for", silent.Round(time.Millisecond))
+	return false
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
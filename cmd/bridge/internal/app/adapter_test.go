@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// startFakeAdapter accepts a single connection and hands it to serve.
+func startFakeAdapter(t *testing.T, serve func(net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		serve(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestConnectAndServeWatchdog(t *testing.T) {
+	b := newTestBridge(t)
+	release := make(chan struct{})
+	defer close(release)
+	b.cfg.EByteAddress = startFakeAdapter(t, func(conn net.Conn) {
+		<-release
+	})
+	b.cfg.AdapterIdleTimeout = Duration(100 * time.Millisecond)
+
+	start := time.Now()
+	connected, err := b.connectAndServe(context.Background(), b.cfg.EByteAddress, b.adapterLog)
+	if !connected || !errors.Is(err, errLinkSilent) {
+		t.Fatalf("expected link silent error after connecting, got %v (connected=%v)", err, connected)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("watchdog fired too late")
+	}
+	if b.linkSilentEvents.Load() != 1 {
+		t.Fatalf("expected link silent event to be counted")
+	}
+}
+
+func TestConnectAndServeStats(t *testing.T) {
+	b := newTestBridge(t)
+	raw, err := ebyte.SerializeFrame(ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{1, 2}})
+	if err != nil {
+		t.Fatalf("SerializeFrame returned error: %v", err)
+	}
+	b.cfg.EByteAddress = startFakeAdapter(t, func(conn net.Conn) {
+		_, _ = conn.Write(raw)
+	})
+
+	connected, err := b.connectAndServe(context.Background(), b.cfg.EByteAddress, b.adapterLog)
+	if !connected || err == nil {
+		t.Fatalf("expected session to end with an error after the adapter closed, got %v", err)
+	}
+	if snap := b.Stats(); snap.Frames != 1 || snap.IDs[0].ID != 0x123 {
+		t.Fatalf("unexpected statistics %+v", snap)
+	}
+}
+
+func TestRunAdapterLoopFailoverAndFailback(t *testing.T) {
+	// Reserve an address for the primary that refuses connections at first.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	primary := ln.Addr().String()
+	ln.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	secondary := startFakeAdapter(t, func(conn net.Conn) { <-release })
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = primary
+	b.cfg.FailoverAddresses = []string{secondary}
+	b.cfg.FailoverAfter = 2
+	b.cfg.FailbackInterval = Duration(20 * time.Millisecond)
+	b.cfg.ReconnectDelay = Duration(time.Millisecond)
+	b.cfg.ReconnectMaxDelay = Duration(time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.runAdapterLoop(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, func() bool {
+		return b.adapterConnected.Load() && b.activeAdapter.Load() == secondary
+	})
+
+	ln, err = net.Listen("tcp", primary)
+	if err != nil {
+		t.Skipf("primary address no longer available: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				<-release
+				conn.Close()
+			}()
+		}
+	}()
+
+	waitFor(t, func() bool {
+		return b.adapterConnected.Load() && b.activeAdapter.Load() == primary
+	})
+}
+
+func TestRunAdapterLoopBacksOffOnDroppedSessions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan time.Time, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- time.Now()
+			conn.Close()
+		}
+	}()
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = ln.Addr().String()
+	b.cfg.ReconnectDelay = Duration(10 * time.Millisecond)
+	b.cfg.ReconnectMaxDelay = Duration(time.Second)
+	b.cfg.ReconnectJitter = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.runAdapterLoop(ctx) }()
+	time.Sleep(400 * time.Millisecond)
+	cancel()
+	<-done
+
+	// 10, 20, 40, 80 and 160ms fit into the time; restarting at the initial
+	// delay after every accepted connection would reconnect about 40 times.
+	if n := len(accepted); n > 8 {
+		t.Fatalf("adapter redialled %d times, expected the backoff to grow", n)
+	}
+}
+
+// serveAdapters accepts connections on ln until it is closed and hands each
+// one to serve.
+func serveAdapters(ln net.Listener, serve func(net.Conn)) {
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+}
+
+func TestRunAdapterLoopKeepsPrimaryAfterDrop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	release := make(chan struct{})
+	defer close(release)
+	var sessions atomic.Int32
+	serveAdapters(ln, func(conn net.Conn) {
+		if sessions.Add(1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			return
+		}
+		<-release
+	})
+	secondary := startFakeAdapter(t, func(conn net.Conn) { <-release })
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = ln.Addr().String()
+	b.cfg.FailoverAddresses = []string{secondary}
+	b.cfg.FailoverAfter = 1
+	b.cfg.ReconnectDelay = Duration(time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.runAdapterLoop(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, func() bool { return sessions.Load() == 2 && b.adapterConnected.Load() })
+	if active := b.activeAdapter.Load(); active != ln.Addr().String() {
+		t.Fatalf("a dropped session failed over to %v", active)
+	}
+}
+
+func TestRunAdapterLoopProbesAcrossReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	primary := ln.Addr().String()
+	ln.Close()
+
+	// The secondary drops every session before a failback probe is due.
+	secondaryLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer secondaryLn.Close()
+	serveAdapters(secondaryLn, func(conn net.Conn) { time.Sleep(60 * time.Millisecond) })
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = primary
+	b.cfg.FailoverAddresses = []string{secondaryLn.Addr().String()}
+	b.cfg.FailoverAfter = 100
+	b.cfg.FailbackInterval = Duration(100 * time.Millisecond)
+	b.cfg.ReconnectDelay = Duration(time.Millisecond)
+	b.cfg.ReconnectMaxDelay = Duration(time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.runAdapterLoop(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor(t, func() bool {
+		return b.adapterConnected.Load() && b.activeAdapter.Load() == secondaryLn.Addr().String()
+	})
+	ln, err = net.Listen("tcp", primary)
+	if err != nil {
+		t.Skipf("primary address no longer available: %v", err)
+	}
+	defer ln.Close()
+	release := make(chan struct{})
+	defer close(release)
+	serveAdapters(ln, func(conn net.Conn) { <-release })
+
+	waitFor(t, func() bool {
+		return b.adapterConnected.Load() && b.activeAdapter.Load() == primary
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
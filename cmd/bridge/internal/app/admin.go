@@ -0,0 +1,289 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// clientInfo is the admin API representation of a connected client.
+type clientInfo struct {
+	ID        uint64    `json:"id"`
+	Remote    string    `json:"remote"`
+	Listener  string    `json:"listener"`
+	Protocol  string    `json:"protocol"`
+	TLS       bool      `json:"tls"`
+	Identity  string    `json:"identity,omitempty"`
+	Connected time.Time `json:"connected"`
+	Queued    int       `json:"queued"`
+}
+
+// statusInfo is the admin API summary of the bridge state.
+type statusInfo struct {
+	Uptime           string            `json:"uptime"`
+	Adapter          string            `json:"adapter"`
+	AdapterEndpoints []string          `json:"adapter_endpoints"`
+	AdapterConnected bool              `json:"adapter_connected"`
+	AdapterSessions  uint64            `json:"adapter_sessions"`
+	LastAdapterData  *time.Time        `json:"last_adapter_data,omitempty"`
+	LinkSilentEvents uint64            `json:"link_silent_events"`
+	BusSilentEvents  uint64            `json:"bus_silent_events"`
+	Clients          int               `json:"clients"`
+	RejectedClients  uint64            `json:"rejected_clients"`
+	LogLevels        map[string]string `json:"log_levels"`
+	Replay           *replayStatus     `json:"replay,omitempty"`
+	Cannelloni       *cannelloniStatus `json:"cannelloni,omitempty"`
+}
+
+// startAdmin serves the admin API on addr until ctx is cancelled. Addresses
+// prefixed with "unix:" are bound as Unix domain sockets.
+func (b *Bridge) startAdmin(ctx context.Context, addr string) (*http.Server, error) {
+	listener, err := b.listen(addr, "")
+	if err != nil {
+		return nil, fmt.Errorf("admin listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           b.adminHandler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			b.logger.Error("admin server failed", "error", err)
+		}
+	}()
+	b.logger.Info("admin API listening", "listen", listener.Addr().String())
+	return srv, nil
+}
+
+// adminHandler builds the admin API routes.
+func (b *Bridge) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", b.handleAdminStatus)
+	mux.HandleFunc("GET /stats", b.handleAdminStats)
+	mux.HandleFunc("GET /clients", b.handleAdminClients)
+	mux.HandleFunc("DELETE /clients/{id}", b.handleAdminKick)
+	mux.HandleFunc("GET /log/levels", b.handleAdminLevels)
+	mux.HandleFunc("PUT /log/levels", b.handleAdminSetLevel)
+	mux.HandleFunc("GET /replay", b.replayHandler(b.handleReplayStatus))
+	mux.HandleFunc("POST /replay/pause", b.replayHandler(b.handleReplayPause))
+	mux.HandleFunc("POST /replay/resume", b.replayHandler(b.handleReplayResume))
+	mux.HandleFunc("PUT /replay/speed", b.replayHandler(b.handleReplaySpeed))
+	mux.HandleFunc("POST /replay/seek", b.replayHandler(b.handleReplaySeek))
+	mux.HandleFunc("POST /replay/step", b.replayHandler(b.handleReplayStep))
+	mux.HandleFunc("POST /replay/next", b.replayHandler(b.handleReplayNext))
+	return mux
+}
+
+func (b *Bridge) handleAdminStatus(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, b.status())
+}
+
+// status collects the state reported by the admin status endpoint.
+func (b *Bridge) status() statusInfo {
+	b.mu.RLock()
+	clients := len(b.clients)
+	b.mu.RUnlock()
+	info := statusInfo{
+		Uptime:           time.Since(b.start).Round(time.Second).String(),
+		Adapter:          b.activeAdapter.Load().(string),
+		AdapterEndpoints: b.adapterEndpoints(),
+		AdapterConnected: b.adapterConnected.Load(),
+		AdapterSessions:  b.adapterSessions.Load(),
+		LinkSilentEvents: b.linkSilentEvents.Load(),
+		BusSilentEvents:  b.busSilentEvents.Load(),
+		Clients:          clients,
+		RejectedClients:  b.rejectedClients.Load(),
+		LogLevels:        b.logging.Levels(),
+	}
+	if ns := b.lastAdapterData.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		info.LastAdapterData = &t
+	}
+	if b.replay != nil {
+		replay := b.replay.status()
+		info.Replay = &replay
+	}
+	if t := b.tunnel.Load(); t != nil {
+		tunnel := t.status()
+		info.Cannelloni = &tunnel
+	}
+	return info
+}
+
+func (b *Bridge) handleAdminStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, b.Stats())
+}
+
+func (b *Bridge) handleAdminClients(w http.ResponseWriter, _ *http.Request) {
+	b.mu.RLock()
+	infos := make([]clientInfo, 0, len(b.clients))
+	for c := range b.clients {
+		infos = append(infos, clientInfo{
+			ID:        c.id,
+			Remote:    c.remote,
+			Listener:  c.listener,
+			Protocol:  c.protocol,
+			TLS:       c.tls,
+			Identity:  c.identity,
+			Connected: c.connected,
+			Queued:    len(c.sendCh),
+		})
+	}
+	b.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// handleAdminKick disconnects the client matching the numeric ID or remote
+// address given in the path.
+func (b *Bridge) handleAdminKick(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("id")
+	id, _ := strconv.ParseUint(key, 10, 64)
+
+	var target *client
+	b.mu.RLock()
+	for c := range b.clients {
+		if c.id == id || c.remote == key {
+			target = c
+			break
+		}
+	}
+	b.mu.RUnlock()
+
+	if target == nil {
+		http.Error(w, fmt.Sprintf("client %q not found", key), http.StatusNotFound)
+		return
+	}
+	target.log.Info("client disconnected by admin request")
+	target.close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (b *Bridge) handleAdminLevels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, b.logging.Levels())
+}
+
+// handleAdminSetLevel applies ?level=...&component=... to the log level
+// table. Without a component the default level is changed.
+func (b *Bridge) handleAdminSetLevel(w http.ResponseWriter, r *http.Request) {
+	component := r.URL.Query().Get("component")
+	level := r.URL.Query().Get("level")
+	if err := b.logging.SetLevel(component, level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.logger.Info("log level changed", "target", component, "level", level)
+	writeJSON(w, http.StatusOK, b.logging.Levels())
+}
+
+// replayHandler rejects replay requests while no replay is running and
+// answers successful ones with the replay state.
+func (b *Bridge) replayHandler(h func(*http.Request) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if b.replay == nil {
+			http.Error(w, "no replay configured", http.StatusNotFound)
+			return
+		}
+		if status, err := h(r); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeJSON(w, http.StatusOK, b.replay.status())
+	}
+}
+
+func (b *Bridge) handleReplayStatus(*http.Request) (int, error) {
+	return http.StatusOK, nil
+}
+
+func (b *Bridge) handleReplayPause(*http.Request) (int, error) {
+	b.replay.setPaused(true)
+	return http.StatusOK, nil
+}
+
+func (b *Bridge) handleReplayResume(*http.Request) (int, error) {
+	b.replay.setPaused(false)
+	return http.StatusOK, nil
+}
+
+// handleReplaySpeed applies ?factor=2.
+func (b *Bridge) handleReplaySpeed(r *http.Request) (int, error) {
+	factor, err := strconv.ParseFloat(r.URL.Query().Get("factor"), 64)
+	if err == nil {
+		err = b.replay.setSpeed(factor)
+	}
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid speed factor: %w", err)
+	}
+	return http.StatusOK, nil
+}
+
+// handleReplaySeek applies ?to=, either an offset from the first frame of
+// the trace such as "90s" or a trace timestamp in RFC 3339 format.
+func (b *Bridge) handleReplaySeek(r *http.Request) (int, error) {
+	to := r.URL.Query().Get("to")
+	var err error
+	if offset, perr := time.ParseDuration(to); perr == nil {
+		err = b.replay.seek(offset)
+	} else if t, perr := time.Parse(time.RFC3339Nano, to); perr == nil {
+		err = b.replay.seekTime(t)
+	} else {
+		err = fmt.Errorf("invalid position %q, expected a duration or an RFC 3339 time", to)
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// handleReplayStep applies ?count=N, which defaults to one frame and may be
+// at most the number of frames in the replayed section.
+func (b *Bridge) handleReplayStep(r *http.Request) (int, error) {
+	count := 1
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > len(b.replay.frames) {
+			return http.StatusBadRequest, fmt.Errorf("invalid count %q, expected 1 to %d", v, len(b.replay.frames))
+		}
+		count = n
+	}
+	b.replay.step(count)
+	return http.StatusOK, nil
+}
+
+// handleReplayNext applies ?id=0x123 and the optional &extended=true or
+// false, which restricts the search to one frame type.
+func (b *Bridge) handleReplayNext(r *http.Request) (int, error) {
+	query := r.URL.Query()
+	var f Filter
+	if err := f.ID.UnmarshalText([]byte(query.Get("id"))); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if v := query.Get("extended"); v != "" {
+		extended, err := strconv.ParseBool(v)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid frame type %q, expected true or false", v)
+		}
+		f.Extended = &extended
+	}
+	if !b.replay.next(f) {
+		return http.StatusNotFound, fmt.Errorf("no frame with identifier 0x%X after the current position", uint32(f.ID))
+	}
+	return http.StatusOK, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
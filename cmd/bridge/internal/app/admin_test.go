@@ -0,0 +1,94 @@
+package app
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestBridge(t *testing.T) *Bridge {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.EByteAddress = "192.0.2.10:4001"
+	cfg.Log.Level = "error"
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	return b
+}
+
+func TestAdminClientsAndKick(t *testing.T) {
+	b := newTestBridge(t)
+	server, peer := net.Pipe()
+	defer peer.Close()
+	c := newClient(b.nextClientID.Add(1), server, b.clientLog)
+	b.addClient(c)
+
+	handler := b.adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/clients", nil))
+	var infos []clientInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(infos) != 1 || infos[0].ID != c.id {
+		t.Fatalf("unexpected client list %+v", infos)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/clients/1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("unexpected kick status %d: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatalf("expected client to be closed")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/clients/42", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown client, got %d", rec.Code)
+	}
+}
+
+func TestAdminSetLevel(t *testing.T) {
+	b := newTestBridge(t)
+	handler := b.adminHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/levels?component=adapter&level=debug", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := b.logging.Levels()["adapter"]; got != "debug" {
+		t.Fatalf("expected adapter level debug, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/log/levels?level=loud", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid level, got %d", rec.Code)
+	}
+}
+
+func TestLoggingShiftLevels(t *testing.T) {
+	logging, err := NewLogging(LogConfig{Level: "info", ComponentLevels: map[string]string{"client": "error"}})
+	if err != nil {
+		t.Fatalf("NewLogging returned error: %v", err)
+	}
+	logging.ShiftLevels(-1)
+	levels := logging.Levels()
+	if levels[""] != "debug" || levels["client"] != "warn" {
+		t.Fatalf("unexpected levels after raising verbosity: %v", levels)
+	}
+	logging.ShiftLevels(-1)
+	if got := logging.Levels()[""]; got != "debug" {
+		t.Fatalf("expected level to stay at debug, got %q", got)
+	}
+}
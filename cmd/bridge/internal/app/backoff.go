@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// backoff computes exponentially growing retry delays with random jitter so
+// that a flapping adapter is not hammered with connection attempts.
+type backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+	random     func() float64
+
+	next time.Duration
+}
+
+func newBackoff(initial, max time.Duration, multiplier, jitter float64) *backoff {
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	if max < initial {
+		max = initial
+	}
+	return &backoff{
+		initial:    initial,
+		max:        max,
+		multiplier: multiplier,
+		jitter:     jitter,
+		random:     rand.Float64,
+		next:       initial,
+	}
+}
+
+// Next returns the delay before the upcoming attempt and advances the
+// sequence. The jitter spreads the delay by up to ±jitter of its value.
+func (b *backoff) Next() time.Duration {
+	d := b.next
+	b.next = min(time.Duration(float64(b.next)*b.multiplier), b.max)
+
+	if b.jitter > 0 {
+		spread := (b.random()*2 - 1) * b.jitter
+		d = time.Duration(float64(d) * (1 + spread))
+	}
+	return max(d, 0)
+}
+
+// Reset restarts the sequence at the initial delay after a successful
+// connection.
+func (b *backoff) Reset() {
+	b.next = b.initial
+}
+
+// sleepContext waits for d or until the context is cancelled, whichever comes
+// first, and reports the context error in the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
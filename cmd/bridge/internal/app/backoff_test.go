@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowsAndCaps(t *testing.T) {
+	bo := newBackoff(time.Second, 5*time.Second, 2, 0)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := bo.Next(); got != w {
+			t.Fatalf("attempt %d: got %s want %s", i+1, got, w)
+		}
+	}
+
+	bo.Reset()
+	if got := bo.Next(); got != time.Second {
+		t.Fatalf("expected reset to initial delay, got %s", got)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	bo := newBackoff(time.Second, time.Minute, 2, 0.5)
+
+	bo.random = func() float64 { return 0 }
+	if got := bo.Next(); got != 500*time.Millisecond {
+		t.Fatalf("expected lower jitter bound, got %s", got)
+	}
+	bo.random = func() float64 { return 1 }
+	if got := bo.Next(); got != 3*time.Second {
+		t.Fatalf("expected upper jitter bound, got %s", got)
+	}
+}
+
+func TestSleepContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := sleepContext(ctx, time.Hour); err == nil {
+		t.Fatalf("expected context error")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("sleepContext ignored cancellation")
+	}
+}
@@ -4,15 +4,21 @@ package app
 
 import (
 	"context"
-	"encoding/binary"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/ebyte"
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/stats"
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/systemd"
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
 )
 
 // Bridge coordinates the TCP connections to the adapter and connected clients
@@ -23,125 +29,401 @@ type Bridge struct {
 	mu      sync.RWMutex
 	clients map[*client]struct{}
 
-	logger Logger
-
-	listener net.Listener
-	start    time.Time
+	logging    *Logging
+	logger     Logger
+	adapterLog Logger
+	clientLog  Logger
+	statsLog   Logger
+	traceLog   Logger
+	stats      *stats.Collector
+
+	// traces receive every adapter frame; they are opened by Run.
+	traces []*traceSink
+	// mirror copies adapter frames to a SocketCAN interface; it is opened
+	// with the traces.
+	mirror *canMirror
+	// tunnel exchanges frames with a cannelloni peer; it is opened with the
+	// traces and read by the admin API.
+	tunnel atomic.Pointer[cannelloniTunnel]
+	// replay stands in for the adapter if a replay file is configured; it
+	// is loaded by Run.
+	replay *replayer
+
+	start time.Time
+
+	// txCh queues frames received from clients for the adapter.
+	txCh chan txFrame
+
+	// wg tracks every goroutine started by Run, handlers only the client
+	// connection handlers, which are stopped before the adapter.
+	wg       sync.WaitGroup
+	handlers sync.WaitGroup
+
+	nextClientID     atomic.Uint64
+	adapterConnected atomic.Bool
+	activeAdapter    atomic.Value // string
+	adapterSessions  atomic.Uint64
+	lastAdapterData  atomic.Int64 // unix nanoseconds
+	linkSilentEvents atomic.Uint64
+	busSilentEvents  atomic.Uint64
+	rejectedClients  atomic.Uint64
+	admission        admission
+
+	// systemd integration: sockets passed by socket activation until a
+	// listener takes them, readiness and the adapter loop's next deadline
+	// for the watchdog.
+	activated       []*os.File
+	readyOnce       sync.Once
+	adapterDeadline atomic.Int64 // unix nanoseconds
+
+	// Settings that can be changed by Reload while the bridge is running.
+	bitrate atomic.Uint32
+	filters atomic.Pointer[filterSet]
+	access  atomic.Pointer[accessRules]
+
+	// deviceBuses describes the buses of an upstream GVRET device once it
+	// answered the bus queries; nil for single-bus backends.
+	deviceBuses atomic.Pointer[[]gvret.BusInfo]
+
+	// reloadMu serialises Reload. applied is the configuration given to the
+	// last successful Reload, or to New; restart-required changes are
+	// reported against it so that each one is logged once.
+	reloadMu sync.Mutex
+	applied  Config
 }
 
 type client struct {
-	conn      net.Conn
-	sendCh    chan []byte
-	done      chan struct{}
-	closeOnce sync.Once
-	remote    string
-}
-
-type gvretParserState int
-
-const (
-	gvretStateIdle gvretParserState = iota
-	gvretStateExpectCommand
-	gvretStateClassicFrame
-	gvretStateFdFrame
-	gvretStateSkip
-)
-
-type gvretClientState struct {
-	binary    bool
-	e7Count   int
-	state     gvretParserState
-	step      int
-	remaining int
-	fdLength  int
+	id         uint64
+	connected  time.Time
+	conn       net.Conn
+	sendCh     chan []byte
+	done       chan struct{}
+	closeOnce  sync.Once
+	flush      chan struct{}
+	flushOnce  sync.Once
+	writerDone chan struct{}
+	remote     string
+	log        Logger
+
+	listener string
+	protocol string
+	session  session
+	// tls is set for clients connected over TLS, identity to the common
+	// name of their verified certificate, if any.
+	tls      bool
+	identity string
 }
 
 // New constructs a Bridge using the provided configuration and initialises the
 // logging backend.
 func New(cfg Config) (*Bridge, error) {
-	logger, err := NewLogger(cfg.LogLevel)
+	access, err := newAccessRules(cfg)
 	if err != nil {
 		return nil, err
 	}
+	logging, err := NewLogging(cfg.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bridge{
+		cfg:        cfg,
+		clients:    make(map[*client]struct{}),
+		logging:    logging,
+		logger:     logging.Logger("bridge"),
+		adapterLog: logging.Logger("adapter"),
+		clientLog:  logging.Logger("client"),
+		statsLog:   logging.Logger("stats"),
+		traceLog:   logging.Logger("trace"),
+		stats:      stats.NewCollector(cfg.BusBitrate),
+		start:      time.Now(),
+		applied:    cfg,
+		txCh:       make(chan txFrame, 256),
+	}
+	b.activeAdapter.Store(cfg.EByteAddress)
+	b.bitrate.Store(cfg.BusBitrate)
+	b.filters.Store(newFilterSet(cfg.Filters))
+	b.access.Store(access)
+	return b, nil
+}
 
-	return &Bridge{
-		cfg:     cfg,
-		clients: make(map[*client]struct{}),
-		logger:  logger,
-		start:   time.Now(),
-	}, nil
+// Logger returns the logger of the given component, e.g. "bridge", which
+// honours the configured levels and log file.
+func (b *Bridge) Logger(component string) Logger {
+	return b.logging.Logger(component)
+}
+
+// Close releases resources that outlive Run, such as the log file.
+func (b *Bridge) Close() error {
+	return b.logging.Close()
 }
 
 // Run starts the bridge and blocks until the context is cancelled or a fatal
-// error occurs.
+// error occurs. It then shuts down in order: stop accepting clients, stop
+// reading from clients and the adapter, flush pending transmits to the
+// adapter, drain the client queues, close all connections and wait for every
+// goroutine. All errors encountered on the way are returned joined.
 func (b *Bridge) Run(ctx context.Context) error {
-	listener, err := net.Listen("tcp", b.cfg.ListenAddress)
+	var err error
+	b.replay, err = b.openReplay()
+	if err != nil {
+		return err
+	}
+	b.activated = activatedFiles()
+	listeners, err := b.openListeners()
 	if err != nil {
-		return fmt.Errorf("listen on %s: %w", b.cfg.ListenAddress, err)
+		b.closeUnusedActivated()
+		return err
+	}
+	closeListeners := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
 	}
-	defer listener.Close()
-	b.listener = listener
-	b.logger.Infof("GVRET TCP server listening on %s", listener.Addr())
 
-	errCh := make(chan error, 2)
+	// Each context stops one stage of the shutdown sequence; background
+	// tasks such as the statistics logger stop with runCtx last.
+	runCtx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+	clientCtx, stopClients := context.WithCancel(context.Background())
+	defer stopClients()
+	adapterCtx, stopAdapter := context.WithCancel(context.Background())
+	defer stopAdapter()
+
+	var admin *http.Server
+	if b.cfg.AdminAddress != "" {
+		admin, err = b.startAdmin(runCtx, b.cfg.AdminAddress)
+		if err != nil {
+			closeListeners()
+			b.closeUnusedActivated()
+			return err
+		}
+	}
+	b.closeUnusedActivated()
 
-	go func() {
-		errCh <- b.runAdapterLoop(ctx)
-	}()
+	if err := b.openTraces(); err != nil {
+		closeListeners()
+		if admin != nil {
+			_ = admin.Close()
+		}
+		_ = b.closeTraces()
+		return err
+	}
 
-	go func() {
-		errCh <- b.acceptClients(ctx, listener)
-	}()
+	if b.cfg.StatsInterval > 0 {
+		b.spawn(func() { b.logStats(runCtx, time.Duration(b.cfg.StatsInterval)) })
+	}
+	b.spawn(func() { b.watchLevelSignals(runCtx) })
+	stopWatchdog := make(chan struct{})
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		b.expectProgress(time.Duration(b.cfg.DialTimeout))
+		b.spawn(func() { b.runWatchdog(stopWatchdog, interval) })
+	}
+
+	var adapterErr error
+	adapterDone := make(chan struct{})
+	acceptErrs := make(chan error, len(listeners))
+	b.spawn(func() {
+		defer close(adapterDone)
+		if b.replay != nil {
+			adapterErr = b.replay.run(adapterCtx)
+		} else {
+			adapterErr = b.runAdapterLoop(adapterCtx)
+		}
+	})
+	for _, l := range listeners {
+		b.spawn(func() { acceptErrs <- b.acceptClients(clientCtx, l) })
+	}
 
+	// A failing listener stops the bridge like a shutdown request.
+	pending := len(listeners)
+	var errs []error
 	select {
 	case <-ctx.Done():
-		return nil
-	case err := <-errCh:
-		return err
+	case err := <-acceptErrs:
+		errs = append(errs, err)
+		pending--
+	}
+
+	b.logger.Info("shutting down")
+	close(stopWatchdog)
+	b.notify("STOPPING=1\nSTATUS=shutting down")
+	deadline := time.Now().Add(time.Duration(b.cfg.ShutdownTimeout))
+
+	closeListeners()
+	for ; pending > 0; pending-- {
+		errs = append(errs, <-acceptErrs)
+	}
+
+	stopClients()
+	b.handlers.Wait()
+
+	stopAdapter()
+	<-adapterDone
+	if !errors.Is(adapterErr, context.Canceled) {
+		errs = append(errs, adapterErr)
+	}
+	if n := len(b.txCh); n > 0 {
+		errs = append(errs, fmt.Errorf("%d pending transmit frames dropped", n))
+	}
+	errs = append(errs, b.closeTraces())
+
+	errs = append(errs, b.drainClients(deadline))
+
+	if admin != nil {
+		shutdownCtx, cancel := context.WithDeadline(context.Background(), deadline)
+		if err := admin.Shutdown(shutdownCtx); err != nil {
+			errs = append(errs, fmt.Errorf("admin server: %w", err))
+			_ = admin.Close()
+		}
+		cancel()
+	}
+
+	stopRun()
+	b.wg.Wait()
+
+	err = errors.Join(errs...)
+	if err != nil {
+		b.logger.Warn("shutdown completed with errors", "error", err)
+	} else {
+		b.logger.Info("shutdown complete")
+	}
+	return err
+}
+
+// spawn runs f in a goroutine that Run waits for before returning.
+func (b *Bridge) spawn(f func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		f()
+	}()
+}
+
+// drainClients flushes the queues of all remaining clients in parallel and
+// closes their connections once done or at the deadline.
+func (b *Bridge) drainClients(deadline time.Time) error {
+	b.mu.Lock()
+	clients := make([]*client, 0, len(b.clients))
+	for c := range b.clients {
+		clients = append(clients, c)
+	}
+	b.clients = make(map[*client]struct{})
+	b.mu.Unlock()
+
+	errCh := make(chan error, len(clients))
+	for _, c := range clients {
+		go func() {
+			errCh <- c.finish(deadline)
+		}()
+	}
+	var errs []error
+	for range clients {
+		errs = append(errs, <-errCh)
 	}
+	return errors.Join(errs...)
 }
 
-func (b *Bridge) acceptClients(ctx context.Context, listener net.Listener) error {
+func (b *Bridge) acceptClients(ctx context.Context, listener clientListener) error {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			if ctx.Err() != nil {
+			if errors.Is(err, net.ErrClosed) {
 				return nil
 			}
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				continue
 			}
-			return fmt.Errorf("accept client: %w", err)
+			return fmt.Errorf("accept client on %s: %w", listener.name, err)
+		}
+
+		if reason := b.admit(listener.name, conn); reason != "" {
+			log := b.clientLog.With("client", conn.RemoteAddr().String(), "listener", listener.name)
+			b.rejectClient(conn, log, reason)
+			continue
 		}
 
-		b.logger.Infof("client connected: %s", conn.RemoteAddr())
-		go b.handleClient(ctx, conn)
+		b.handlers.Add(1)
+		go func() {
+			defer b.handlers.Done()
+			defer b.release(conn)
+			b.handleClient(ctx, conn, listener)
+		}()
 	}
 }
 
-// handleClient manages the lifecycle of a single GVRET client connection.
-func (b *Bridge) handleClient(ctx context.Context, conn net.Conn) {
-	c := newClient(conn)
+// handleClient manages the lifecycle of a single client connection accepted
+// on listener. TLS clients are admitted once the handshake completed.
+// When ctx is cancelled it stops reading but leaves the client registered so
+// that the shutdown sequence can drain its queue.
+func (b *Bridge) handleClient(ctx context.Context, conn net.Conn, listener clientListener) {
+	c := newClient(b.nextClientID.Add(1), conn, b.clientLog)
+	c.listener = listener.name
+	c.log = c.log.With("listener", listener.name)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		identity, err := handshakeClient(ctx, tlsConn)
+		if err != nil {
+			c.log.Warn("TLS handshake failed", "error", err)
+			_ = conn.Close()
+			return
+		}
+		c.tls, c.identity = true, identity
+		if identity != "" {
+			c.log = c.log.With("identity", identity)
+		}
+	}
+	if reason := b.authorizeClient(c); reason != "" {
+		b.rejectClient(conn, c.log, reason)
+		return
+	}
+
+	c.protocol = listener.protocol
+	var prefix []byte
+	if c.protocol == protocolAuto {
+		var err error
+		c.protocol, prefix, err = b.detectProtocol(ctx, conn, c.log)
+		if err != nil {
+			c.log.Debug("client left during protocol detection", "error", err)
+			_ = conn.Close()
+			return
+		}
+	}
+	c.log = c.log.With("protocol", c.protocol)
+	c.session = b.newSession(c.protocol, c)
+	if s, ok := c.session.(*gvretSession); ok && len(prefix) > 0 && prefix[0] == gvret.Start {
+		// Detection accepted a command without the handshake, which the
+		// session would otherwise discard.
+		s.session.StartBinary()
+	}
+	if s, ok := c.session.(sessionStopper); ok {
+		defer s.stop()
+	}
+
+	c.log.Info("client connected")
 	b.addClient(c)
 	defer func() {
+		if ctx.Err() != nil {
+			return
+		}
 		b.removeClient(c)
-		b.logger.Infof("client disconnected: %s", c.remote)
+		c.log.Info("client disconnected")
 	}()
 
-	clientCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-
-	go c.writer(clientCtx, b.logger)
+	b.spawn(c.writer)
+	// Unblock the pending read when the bridge stops reading from clients.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
 
-	state := gvretClientState{}
+	c.session.receive(prefix)
 	buf := make([]byte, 1024)
 
 	for {
+		// Checked after arming the deadline so that it cannot replace the
+		// one set when the bridge stopped reading.
+		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
 		if ctx.Err() != nil {
 			return
 		}
-
-		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
 		n, err := conn.Read(buf)
 		if err != nil {
 			if ne, ok := err.(net.Error); ok && ne.Timeout() {
@@ -153,48 +435,96 @@ func (b *Bridge) handleClient(ctx context.Context, conn net.Conn) {
 			if ctx.Err() != nil {
 				return
 			}
-			b.logger.Warnf("client %s read error: %v", c.remote, err)
+			select {
+			case <-c.done:
+				// closed locally, e.g. by a write failure or an admin request
+				return
+			default:
+			}
+			c.log.Warn("client read failed", "error", err)
 			return
 		}
 
-		for i := 0; i < n; i++ {
-			b.processGVRETByte(c, &state, buf[i])
-		}
+		c.session.receive(buf[:n])
 	}
 }
 
-func newClient(conn net.Conn) *client {
+func newClient(id uint64, conn net.Conn, logger Logger) *client {
+	remote := conn.RemoteAddr().String()
 	return &client{
-		conn:   conn,
-		sendCh: make(chan []byte, 128),
-		done:   make(chan struct{}),
-		remote: conn.RemoteAddr().String(),
+		id:         id,
+		connected:  time.Now(),
+		conn:       conn,
+		sendCh:     make(chan []byte, 128),
+		done:       make(chan struct{}),
+		flush:      make(chan struct{}),
+		writerDone: make(chan struct{}),
+		remote:     remote,
+		log:        logger.With("client", remote, "client_id", id),
 	}
 }
 
-// writer streams queued payloads to the client connection until cancelled.
-func (c *client) writer(ctx context.Context, logger Logger) {
+// writer streams queued payloads to the client connection until the client
+// is closed, or until the queue is empty once a flush was requested.
+func (c *client) writer() {
+	defer close(c.writerDone)
 	for {
 		select {
-		case <-ctx.Done():
-			return
 		case <-c.done:
 			return
-		case data := <-c.sendCh:
-			if len(data) == 0 {
-				continue
-			}
-			if _, err := c.conn.Write(data); err != nil {
-				if logger != nil {
-					logger.Debugf("write to %s failed: %v", c.remote, err)
+		case <-c.flush:
+			for {
+				select {
+				case data := <-c.sendCh:
+					if !c.write(data) {
+						return
+					}
+				default:
+					return
 				}
-				c.close()
+			}
+		case data := <-c.sendCh:
+			if !c.write(data) {
 				return
 			}
 		}
 	}
 }
 
+// write sends one payload and closes the client on failure.
+func (c *client) write(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	if _, err := c.conn.Write(data); err != nil {
+		c.log.Debug("client write failed", "error", err)
+		c.close()
+		return false
+	}
+	return true
+}
+
+// finish flushes the queued payloads until the deadline and closes the
+// connection afterwards. It reports payloads that could not be delivered.
+func (c *client) finish(deadline time.Time) error {
+	_ = c.conn.SetWriteDeadline(deadline)
+	c.flushOnce.Do(func() { close(c.flush) })
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-c.writerDone:
+	case <-timer.C:
+	}
+	c.close()
+
+	if n := len(c.sendCh); n > 0 {
+		return fmt.Errorf("client %s: %d queued messages not delivered", c.remote, n)
+	}
+	c.log.Info("client disconnected")
+	return nil
+}
+
 func (c *client) close() {
 	c.closeOnce.Do(func() {
 		close(c.done)
@@ -248,176 +578,14 @@ func (b *Bridge) removeClient(c *client) {
 	c.close()
 }
 
-// processGVRETByte feeds a single byte into the GVRET binary state machine and
-// triggers responses for recognised commands.
-func (b *Bridge) processGVRETByte(c *client, state *gvretClientState, by byte) {
-	if !state.binary {
-		if by == 0xE7 {
-			state.e7Count++
-			if state.e7Count >= 2 {
-				state.binary = true
-				state.state = gvretStateIdle
-				state.e7Count = 0
-				b.logger.Debugf("client %s switched to GVRET binary mode", c.remote)
-			}
-		} else {
-			state.e7Count = 0
-		}
-		return
-	}
-
-	switch state.state {
-	case gvretStateIdle:
-		if by == 0xF1 {
-			state.state = gvretStateExpectCommand
-		}
-	case gvretStateExpectCommand:
-		state.state = gvretStateIdle
-		state.step = 0
-		b.handleGVRETCommandByte(c, state, by)
-	case gvretStateClassicFrame:
-		state.step++
-		switch state.step {
-		case 1, 2, 3, 4, 5, 6, 7, 8:
-			// header bytes: timestamp and identifier
-		case 9:
-			length := int(by & 0x0F)
-			state.remaining = length + 1 // payload + terminator
-			if state.remaining <= 0 {
-				state.state = gvretStateIdle
-				state.step = 0
-			} else {
-				state.state = gvretStateSkip
-			}
-		default:
-			state.state = gvretStateIdle
-			state.step = 0
-		}
-	case gvretStateFdFrame:
-		state.step++
-		switch state.step {
-		case 1, 2, 3, 4, 5, 6, 7, 8:
-			// timestamp and identifier bytes
-		case 9:
-			state.fdLength = int(by & 0x3F)
-		case 10:
-			state.remaining = state.fdLength + 1 // data + trailing byte
-			if state.remaining <= 0 {
-				state.state = gvretStateIdle
-				state.step = 0
-			} else {
-				state.state = gvretStateSkip
-			}
-		default:
-			state.state = gvretStateIdle
-			state.step = 0
-		}
-	case gvretStateSkip:
-		state.remaining--
-		if state.remaining <= 0 {
-			state.state = gvretStateIdle
-			state.step = 0
-		}
-	}
-}
-
-// handleGVRETCommandByte interprets the command byte that follows the GVRET
-// prefix and updates the parser state or sends control responses.
-func (b *Bridge) handleGVRETCommandByte(c *client, state *gvretClientState, cmd byte) {
-	switch cmd {
-	case 0x00:
-		state.state = gvretStateClassicFrame
-		state.step = 0
-	case 0x01:
-		b.sendGVRETTimeSync(c)
-	case 0x06:
-		b.sendGVRETBusParams(c)
-	case 0x07:
-		b.sendGVRETDeviceInfo(c)
-	case 0x09:
-		b.sendGVRETValidationAck(c)
-	case 0x0C:
-		b.sendGVRETNumBuses(c)
-	case 0x0D:
-		b.sendGVRETExtendedBusInfo(c)
-	case 0x05:
-		state.state = gvretStateSkip
-		state.remaining = 9
-	case 0x08:
-		state.state = gvretStateSkip
-		state.remaining = 2
-	case 0x14:
-		state.state = gvretStateFdFrame
-		state.step = 0
-		state.fdLength = 0
-	default:
-		state.state = gvretStateIdle
-	}
-}
-
-// sendGVRETTimeSync reports the current timestamp relative to the bridge
-// startup in microseconds.
-func (b *Bridge) sendGVRETTimeSync(c *client) {
-	ts := b.gvretTimestamp()
-	payload := []byte{0xF1, 0x01, byte(ts), byte(ts >> 8), byte(ts >> 16), byte(ts >> 24)}
-	c.enqueuePriority(payload)
-}
-
-// sendGVRETBusParams informs the client about the configured CAN bus bitrate.
-func (b *Bridge) sendGVRETBusParams(c *client) {
-	bitrate := b.cfg.BusBitrate
-	payload := []byte{
-		0xF1, 0x06,
-		0x01,
-		byte(bitrate), byte(bitrate >> 8), byte(bitrate >> 16), byte(bitrate >> 24),
-		0x00,
-		0x00, 0x00, 0x00, 0x00,
-	}
-	c.enqueuePriority(payload)
-}
-
-// sendGVRETDeviceInfo returns a minimal GVRET device descriptor payload.
-func (b *Bridge) sendGVRETDeviceInfo(c *client) {
-	payload := []byte{0xF1, 0x07, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
-	c.enqueuePriority(payload)
-}
-
-// sendGVRETNumBuses indicates that a single CAN bus is available.
-func (b *Bridge) sendGVRETNumBuses(c *client) {
-	payload := []byte{0xF1, 0x0C, 0x01}
-	c.enqueuePriority(payload)
-}
-
-// sendGVRETExtendedBusInfo provides additional bus metadata as expected by
-// GVRET clients.
-func (b *Bridge) sendGVRETExtendedBusInfo(c *client) {
-	payload := make([]byte, 17)
-	payload[0] = 0xF1
-	payload[1] = 0x0D
-	c.enqueuePriority(payload)
-}
-
-// sendGVRETValidationAck acknowledges the client's periodic keep-alive check.
-func (b *Bridge) sendGVRETValidationAck(c *client) {
-	payload := []byte{0xF1, 0x09}
-	c.enqueuePriority(payload)
-}
-
-// gvretTimestamp returns the elapsed time since the bridge started in
-// microseconds, matching GVRET's expectation.
-func (b *Bridge) gvretTimestamp() uint32 {
-	elapsed := time.Since(b.start)
-	return uint32(elapsed / time.Microsecond)
-}
-
-// broadcastFrame encodes an adapter frame into GVRET format and enqueues it for
-// all connected clients.
-func (b *Bridge) broadcastFrame(frame ebyte.Frame) {
-	data, err := encodeGVRETFrame(frame, b.gvretTimestamp(), 0)
-	if err != nil {
-		b.logger.Warnf("unable to encode GVRET frame: %v", err)
+// broadcastFrame encodes an adapter frame received on bus in each client's
+// protocol and enqueues it for all connected clients, unless the configured
+// filters reject it.
+func (b *Bridge) broadcastFrame(frame ebyte.Frame, bus uint8) {
+	if !b.filters.Load().allows(frame) {
 		return
 	}
+	at := time.Now()
 
 	b.mu.RLock()
 	clients := make([]*client, 0, len(b.clients))
@@ -431,103 +599,11 @@ func (b *Bridge) broadcastFrame(frame ebyte.Frame) {
 	}
 
 	for _, c := range clients {
-		c.enqueue(data)
-	}
-}
-
-// encodeGVRETFrame assembles a GVRET binary frame message from the bridge's
-// internal frame representation.
-func encodeGVRETFrame(frame ebyte.Frame, timestamp uint32, bus uint8) ([]byte, error) {
-	if frame.DLC > 8 {
-		return nil, fmt.Errorf("invalid DLC %d", frame.DLC)
-	}
-
-	id := frame.ID
-	if frame.Extended || frame.ID > 0x7FF {
-		id |= 1 << 31
-	}
-	if frame.Remote {
-		id |= 1 << 30
-	}
-
-	buf := make([]byte, 0, 13+int(frame.DLC))
-	buf = append(buf, 0xF1, 0x00)
-
-	tsBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(tsBytes, timestamp)
-	buf = append(buf, tsBytes...)
-
-	idBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(idBytes, id)
-	buf = append(buf, idBytes...)
-
-	lengthByte := byte(frame.DLC & 0x0F)
-	lengthByte |= (bus & 0x0F) << 4
-	buf = append(buf, lengthByte)
-
-	if frame.DLC > 0 {
-		buf = append(buf, frame.Data[:frame.DLC]...)
-	}
-
-	buf = append(buf, 0x00)
-	return buf, nil
-}
-
-// runAdapterLoop keeps attempting to connect to the adapter until successful or
-// the context is cancelled.
-func (b *Bridge) runAdapterLoop(ctx context.Context) error {
-	for {
-		if err := b.connectAndServe(ctx); err != nil {
-			if ctx.Err() != nil {
-				return ctx.Err()
-			}
-			b.logger.Warnf("adapter loop error: %v", err)
-			time.Sleep(b.cfg.ReconnectDelay)
+		if c.session == nil {
 			continue
 		}
-		return nil
-	}
-}
-
-// connectAndServe maintains the adapter session and broadcasts received frames
-// until an error occurs.
-func (b *Bridge) connectAndServe(ctx context.Context) error {
-	conn, err := net.Dial("tcp", b.cfg.EByteAddress)
-	if err != nil {
-		return fmt.Errorf("dial adapter: %w", err)
-	}
-	b.logger.Infof("connected to adapter at %s", conn.RemoteAddr())
-	defer func() {
-		_ = conn.Close()
-		b.logger.Infof("disconnected from adapter")
-	}()
-
-	buf := make([]byte, 4096)
-	frameBuf := make([]byte, 0, 4096)
-
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		_ = conn.SetReadDeadline(time.Now().Add(30 * time.Second))
-		n, err := conn.Read(buf)
-		if err != nil {
-			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				continue
-			}
-			return fmt.Errorf("adapter read: %w", err)
-		}
-
-		frameBuf = append(frameBuf, buf[:n]...)
-		for len(frameBuf) >= ebyte.FrameSize {
-			frameBytes := frameBuf[:ebyte.FrameSize]
-			frameBuf = frameBuf[ebyte.FrameSize:]
-			frame, err := ebyte.ParseFrame(frameBytes)
-			if err != nil {
-				b.logger.Warnf("discarding invalid frame: %v", err)
-				continue
-			}
-			b.broadcastFrame(frame)
+		if data := c.session.encodeFrame(frame, bus, at); data != nil {
+			c.enqueue(data)
 		}
 	}
 }
@@ -0,0 +1,261 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/cannelloni"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// CannelloniConfig joins the adapter bus with a remote cannelloni instance
+// or another bridge over UDP.
+type CannelloniConfig struct {
+	// Peer is the host:port the remote side receives packets on; the tunnel
+	// is disabled when empty. Host names are resolved once at start.
+	Peer string `json:"peer,omitempty"`
+	// Listen is the local UDP address packets are sent from and received
+	// on. Only packets from Peer are accepted.
+	Listen string `json:"listen,omitempty"`
+	// Timeout is how long frames are collected before they are sent; full
+	// packets are sent at once.
+	Timeout Duration `json:"timeout"`
+}
+
+// validate reports problems with an enabled tunnel.
+func (c CannelloniConfig) validate(add func(string, error)) {
+	if c.Peer == "" {
+		return
+	}
+	add("cannelloni.peer", validateHostPort(c.Peer))
+	add("cannelloni.listen", validateHostPort(c.Listen))
+	if c.Timeout <= 0 {
+		add("cannelloni.timeout", errors.New("must be positive"))
+	}
+}
+
+// cannelloniStatus is the admin API and statistics log representation of
+// the tunnel counters.
+type cannelloniStatus struct {
+	Peer            string `json:"peer"`
+	PacketsSent     uint64 `json:"packets_sent"`
+	FramesSent      uint64 `json:"frames_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	FramesReceived  uint64 `json:"frames_received"`
+	LostPackets     uint64 `json:"lost_packets"`
+	OutOfOrder      uint64 `json:"out_of_order_packets"`
+	Malformed       uint64 `json:"malformed_packets"`
+	SkippedFrames   uint64 `json:"skipped_frames"`
+	DroppedFrames   uint64 `json:"dropped_frames"`
+}
+
+// cannelloniTunnel sends adapter frames to the peer in batches from its own
+// goroutine and forwards frames received from the peer to the adapter.
+type cannelloniTunnel struct {
+	b       *Bridge
+	conn    *net.UDPConn
+	peer    netip.AddrPort
+	timeout time.Duration
+	ch      chan ebyte.Frame
+	done    chan struct{}
+	rxDone  chan struct{}
+	log     Logger
+
+	packetsSent     atomic.Uint64
+	framesSent      atomic.Uint64
+	packetsReceived atomic.Uint64
+	framesReceived  atomic.Uint64
+	lost            atomic.Uint64
+	outOfOrder      atomic.Uint64
+	malformed       atomic.Uint64
+	skipped         atomic.Uint64
+	dropped         atomic.Uint64
+}
+
+// openTunnel binds the local UDP address and starts the tunnel goroutines.
+func (b *Bridge) openTunnel() (*cannelloniTunnel, error) {
+	cfg := b.cfg.Cannelloni
+	peer, err := net.ResolveUDPAddr("udp", cfg.Peer)
+	if err != nil {
+		return nil, fmt.Errorf("cannelloni peer %s: %w", cfg.Peer, err)
+	}
+	local, err := net.ResolveUDPAddr("udp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("cannelloni listen address %s: %w", cfg.Listen, err)
+	}
+	conn, err := net.ListenUDP("udp", local)
+	if err != nil {
+		return nil, fmt.Errorf("cannelloni listen on %s: %w", cfg.Listen, err)
+	}
+	t := &cannelloniTunnel{
+		b:       b,
+		conn:    conn,
+		peer:    unmapAddrPort(peer.AddrPort()),
+		timeout: time.Duration(cfg.Timeout),
+		ch:      make(chan ebyte.Frame, traceQueueSize),
+		done:    make(chan struct{}),
+		rxDone:  make(chan struct{}),
+		log:     b.traceLog.With("cannelloni", cfg.Peer),
+	}
+	go t.run()
+	go t.receive()
+	t.log.Info("cannelloni tunnel started", "listen", conn.LocalAddr().String(), "peer", t.peer.String(), "timeout", cfg.Timeout)
+	return t, nil
+}
+
+// unmapAddrPort turns IPv4-mapped IPv6 addresses into IPv4 addresses so that
+// peers compare equal regardless of the socket's address family.
+func unmapAddrPort(ap netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// run batches queued frames into packets until the tunnel is closed.
+func (t *cannelloniTunnel) run() {
+	defer close(t.done)
+	var batch cannelloni.Batch
+	timer := time.NewTimer(t.timeout)
+	timer.Stop()
+	failing := false
+	flush := func() {
+		timer.Stop()
+		frames := batch.Len()
+		packet := batch.Take()
+		if packet == nil {
+			return
+		}
+		_, err := t.conn.WriteToUDPAddrPort(packet, t.peer)
+		switch {
+		case err != nil && !failing:
+			t.log.Error("cannelloni send failed", "error", err)
+			failing = true
+		case err == nil && failing:
+			t.log.Info("cannelloni send recovered")
+			failing = false
+		}
+		if err == nil {
+			t.packetsSent.Add(1)
+			t.framesSent.Add(uint64(frames))
+		}
+	}
+	for {
+		select {
+		case frame, ok := <-t.ch:
+			if !ok {
+				flush()
+				return
+			}
+			if !batch.Add(frame) {
+				flush()
+				batch.Add(frame)
+			}
+			if batch.Len() == 1 {
+				timer.Reset(t.timeout)
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// send queues a frame for the peer without blocking.
+func (t *cannelloniTunnel) send(frame ebyte.Frame) {
+	select {
+	case t.ch <- frame:
+	default:
+		if t.dropped.Add(1) == 1 {
+			t.log.Warn("cannelloni queue full, dropping frames")
+		}
+	}
+}
+
+// receive forwards frames from the peer to the adapter until the socket is
+// closed.
+func (t *cannelloniTunnel) receive() {
+	defer close(t.rxDone)
+	var seq cannelloni.Sequence
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := t.conn.ReadFromUDPAddrPort(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			t.log.Debug("cannelloni receive failed", "error", err)
+			continue
+		}
+		if from = unmapAddrPort(from); from != t.peer {
+			t.log.Debug("ignoring packet from unknown sender", "remote", from.String())
+			continue
+		}
+		p, err := cannelloni.Decode(buf[:n])
+		if err != nil {
+			t.malformed.Add(1)
+			t.log.Debug("malformed cannelloni packet", "error", err)
+			continue
+		}
+		if p.OpCode != cannelloni.OpData {
+			continue
+		}
+		t.packetsReceived.Add(1)
+		if lost, late := seq.Track(p.Seq); late {
+			t.outOfOrder.Add(1)
+			t.log.Debug("cannelloni packet out of order", "seq", p.Seq)
+		} else if lost > 0 {
+			t.lost.Add(uint64(lost))
+			t.log.Debug("cannelloni packets lost", "seq", p.Seq, "lost", lost)
+		}
+		t.skipped.Add(uint64(p.Skipped))
+		t.framesReceived.Add(uint64(len(p.Frames)))
+		for _, frame := range p.Frames {
+			t.forward(frame)
+		}
+	}
+}
+
+// forward queues a frame from the peer for the adapter.
+func (t *cannelloniTunnel) forward(frame ebyte.Frame) {
+	if !t.b.adapterConnected.Load() {
+		t.log.Debug("dropping cannelloni frame, adapter not connected", "frame_id", formatID(frame.ID, frame.Extended))
+		return
+	}
+	select {
+	case t.b.txCh <- txFrame{frame: frame, tunneled: true}:
+	default:
+		t.log.Warn("transmit queue full, dropping cannelloni frame", "frame_id", formatID(frame.ID, frame.Extended))
+	}
+}
+
+// status returns the tunnel counters.
+func (t *cannelloniTunnel) status() cannelloniStatus {
+	return cannelloniStatus{
+		Peer:            t.peer.String(),
+		PacketsSent:     t.packetsSent.Load(),
+		FramesSent:      t.framesSent.Load(),
+		PacketsReceived: t.packetsReceived.Load(),
+		FramesReceived:  t.framesReceived.Load(),
+		LostPackets:     t.lost.Load(),
+		OutOfOrder:      t.outOfOrder.Load(),
+		Malformed:       t.malformed.Load(),
+		SkippedFrames:   t.skipped.Load(),
+		DroppedFrames:   t.dropped.Load(),
+	}
+}
+
+// close sends the pending frames and closes the socket.
+func (t *cannelloniTunnel) close() error {
+	close(t.ch)
+	<-t.done
+	err := t.conn.Close()
+	<-t.rxDone
+	s := t.status()
+	t.log.Info("cannelloni tunnel closed", "packets_sent", s.PacketsSent, "packets_received", s.PacketsReceived,
+		"lost_packets", s.LostPackets, "out_of_order_packets", s.OutOfOrder, "dropped_frames", s.DroppedFrames)
+	if err != nil {
+		return fmt.Errorf("cannelloni tunnel: %w", err)
+	}
+	return nil
+}
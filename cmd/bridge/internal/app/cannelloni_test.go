@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/cannelloni"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestRunCannelloniTunnel(t *testing.T) {
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer peer.Close()
+
+	fromAdapter := ebyte.Frame{ID: 0x7E8, DLC: 2, Data: [8]byte{0x41, 0x0C}}
+	transmitted := make(chan []byte, 1)
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		raw, _ := ebyte.SerializeFrame(fromAdapter)
+		_, _ = conn.Write(raw)
+		buf := make([]byte, ebyte.FrameSize)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			transmitted <- buf
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.Cannelloni = CannelloniConfig{Peer: peer.LocalAddr().String(), Listen: "127.0.0.1:0", Timeout: Duration(10 * time.Millisecond)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}()
+
+	buf := make([]byte, cannelloni.MaxPacketSize)
+	_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, bridgeAddr, err := peer.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no packet from the bridge: %v", err)
+	}
+	p, err := cannelloni.Decode(buf[:n])
+	if err != nil || !slices.Equal(p.Frames, []ebyte.Frame{fromAdapter}) {
+		t.Fatalf("peer received %+v (%v), want %+v", p, err, fromAdapter)
+	}
+
+	// A frame from the peer goes to the adapter but is not sent back.
+	fromPeer := ebyte.Frame{ID: 0x7DF, DLC: 3, Data: [8]byte{0x02, 0x01, 0x0C}}
+	var batch cannelloni.Batch
+	batch.Add(fromPeer)
+	if _, err := peer.WriteToUDP(batch.Take(), bridgeAddr); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	select {
+	case raw := <-transmitted:
+		if f, err := ebyte.ParseFrame(raw); err != nil || f != fromPeer {
+			t.Fatalf("adapter received %+v (%v), want %+v", f, err, fromPeer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("tunnel frame did not reach the adapter")
+	}
+	_ = peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, _, err := peer.ReadFromUDP(buf); err == nil {
+		t.Fatalf("frame from the peer was sent back")
+	}
+
+	// Sequence number 3 follows 0 after two lost packets; 2 arrives late.
+	// Packets from other senders are ignored.
+	for _, seq := range []byte{3, 2} {
+		_, _ = peer.WriteToUDP([]byte{cannelloni.Version, cannelloni.OpData, seq, 0, 0}, bridgeAddr)
+	}
+	stranger, err := net.DialUDP("udp", nil, bridgeAddr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer stranger.Close()
+	_, _ = stranger.Write([]byte{0xFF})
+	_, _ = peer.WriteToUDP([]byte{1, 0, 4, 0, 0}, bridgeAddr)
+
+	waitFor(t, func() bool { return b.status().Cannelloni.Malformed == 1 })
+	s := b.status().Cannelloni
+	if s.PacketsSent != 1 || s.FramesSent != 1 || s.PacketsReceived != 3 || s.FramesReceived != 1 || s.LostPackets != 2 || s.OutOfOrder != 1 {
+		t.Fatalf("unexpected tunnel status %+v", s)
+	}
+}
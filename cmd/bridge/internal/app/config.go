@@ -1,12 +1,422 @@
 package app
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// Config collects runtime settings for the bridge.
+// Config collects runtime settings for the bridge. The JSON tags define the
+// layout of the configuration file.
 type Config struct {
-	EByteAddress   string
-	ListenAddress  string
-	ReconnectDelay time.Duration
-	LogLevel       string
-	BusBitrate     uint32
+	// Backend selects the kind of device at EByteAddress and the failover
+	// addresses: "ebyte" (the default) for EByte adapters or "gvret" for
+	// GVRET devices such as ESP32RET and M2RET. "socketcan" uses the
+	// interface in SocketCAN instead.
+	Backend       string `json:"backend,omitempty"`
+	EByteAddress  string `json:"ebyte_address"`
+	ListenAddress string `json:"listen_address"`
+	// ListenProtocol is the protocol spoken on ListenAddress, "gvret" by
+	// default or "auto" to detect it per client.
+	ListenProtocol string `json:"listen_protocol,omitempty"`
+	// ListenTLS serves the main listener over TLS using the TLS settings.
+	ListenTLS    bool         `json:"listen_tls,omitempty"`
+	ListenAccess AccessConfig `json:"listen_access"`
+	// SLCANListenAddress enables a listener for SLCAN ASCII clients.
+	SLCANListenAddress string       `json:"slcan_listen_address,omitempty"`
+	SLCANListenTLS     bool         `json:"slcan_listen_tls,omitempty"`
+	SLCANListenAccess  AccessConfig `json:"slcan_listen_access"`
+	// Listeners adds client listeners with their own protocol, address
+	// family and access options. ListenAddress may be left empty if only
+	// these listeners are wanted.
+	Listeners []ListenerConfig `json:"listeners,omitempty"`
+	// Detect configures protocol detection on listeners using "auto".
+	Detect DetectConfig `json:"detect"`
+	// MaxClients and MaxClientsPerIP limit the concurrent client
+	// connections over all listeners, in total and per source address;
+	// zero means unlimited.
+	MaxClients      int `json:"max_clients"`
+	MaxClientsPerIP int `json:"max_clients_per_ip"`
+	// TLS holds the certificates for listeners with TLS enabled.
+	TLS TLSConfig `json:"tls"`
+	// FailoverAddresses lists secondary adapters on the same bus, tried in
+	// order when the current adapter fails FailoverAfter times in a row.
+	FailoverAddresses []string `json:"failover_addresses,omitempty"`
+	FailoverAfter     int      `json:"failover_after"`
+	// FailbackInterval is the period for probing the primary adapter while a
+	// secondary is in use; zero disables failback.
+	FailbackInterval Duration `json:"failback_interval"`
+	ReconnectDelay   Duration `json:"reconnect_delay"`
+	// ReconnectMaxDelay caps the exponentially growing reconnect delay. A
+	// value below ReconnectDelay is raised to it.
+	ReconnectMaxDelay Duration `json:"reconnect_max_delay"`
+	// ReconnectMultiplier is applied to the delay after each failed attempt.
+	ReconnectMultiplier float64 `json:"reconnect_multiplier"`
+	// ReconnectJitter randomises each delay by up to this fraction (0..1).
+	ReconnectJitter float64 `json:"reconnect_jitter"`
+	// DialTimeout limits a single connection attempt to the adapter.
+	DialTimeout Duration `json:"dial_timeout"`
+	// KeepAliveIdle enables TCP keepalive on the adapter connection after
+	// the given idle time; zero disables keepalive probes.
+	KeepAliveIdle     Duration `json:"keepalive_idle"`
+	KeepAliveInterval Duration `json:"keepalive_interval"`
+	KeepAliveCount    int      `json:"keepalive_count"`
+	// AdapterIdleTimeout forces a reconnect when no data arrives from the
+	// adapter for the given time; zero disables the watchdog.
+	AdapterIdleTimeout Duration `json:"adapter_idle_timeout"`
+
+	// ShutdownTimeout bounds flushing transmit and client queues on exit.
+	ShutdownTimeout Duration  `json:"shutdown_timeout"`
+	Log             LogConfig `json:"log"`
+	BusBitrate      uint32    `json:"bus_bitrate"`
+	StatsInterval   Duration  `json:"stats_interval"`
+	// AdminAddress enables the HTTP admin API on an address in any of the
+	// forms accepted for listeners, e.g. "unix:/run/bridge-admin.sock".
+	AdminAddress string `json:"admin_address,omitempty"`
+	// Candump writes every adapter frame to a candump log.
+	Candump CandumpConfig `json:"candump"`
+	// Capture writes adapter frames to a PCAPNG or PCAP file.
+	Capture CaptureConfig `json:"capture"`
+	// ASC writes adapter frames to a Vector ASC log.
+	ASC ASCConfig `json:"asc"`
+	// TRC writes adapter frames to PEAK TRC files.
+	TRC TRCConfig `json:"trc"`
+	// Replay serves a recorded trace instead of connecting to the adapter.
+	Replay ReplayConfig `json:"replay"`
+	// SocketCAN configures the socketcan backend and the mirror of adapter
+	// frames into a SocketCAN interface.
+	SocketCAN SocketCANConfig `json:"socketcan"`
+	// Cannelloni tunnels the adapter bus to a cannelloni peer over UDP.
+	Cannelloni CannelloniConfig `json:"cannelloni"`
+	// Filters restricts which adapter frames are forwarded to clients.
+	Filters []Filter `json:"filters,omitempty"`
+}
+
+// DefaultConfig returns the settings used when neither the configuration
+// file, the environment nor the command line provide a value.
+func DefaultConfig() Config {
+	return Config{
+		EByteAddress:        "127.0.0.1:4001",
+		ListenAddress:       "0.0.0.0:23",
+		FailoverAfter:       3,
+		FailbackInterval:    Duration(time.Minute),
+		ReconnectDelay:      Duration(2 * time.Second),
+		ReconnectMaxDelay:   Duration(time.Minute),
+		ReconnectMultiplier: 2,
+		ReconnectJitter:     0.2,
+		DialTimeout:         Duration(5 * time.Second),
+		KeepAliveIdle:       Duration(10 * time.Second),
+		KeepAliveInterval:   Duration(5 * time.Second),
+		KeepAliveCount:      3,
+		ShutdownTimeout:     Duration(5 * time.Second),
+		Log: LogConfig{
+			Level:      "info",
+			Format:     "text",
+			MaxSize:    10 << 20,
+			MaxBackups: 3,
+		},
+		BusBitrate:    500000,
+		StatsInterval: Duration(time.Minute),
+		Detect: DetectConfig{
+			Timeout:  Duration(2 * time.Second),
+			Fallback: protocolGVRET,
+		},
+		Replay: ReplayConfig{
+			Speed: 1,
+		},
+		Cannelloni: CannelloniConfig{
+			Listen:  ":20000",
+			Timeout: Duration(10 * time.Millisecond),
+		},
+	}
+}
+
+// Duration is a time.Duration that is written as a Go duration string such
+// as "2s" in configuration files and environment variables.
+type Duration time.Duration
+
+// String formats the duration like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ConfigError reports an invalid setting together with its path in the
+// configuration file, e.g. "filters[1].mask".
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks the configuration and returns all problems found, joined
+// into a single error.
+func (c Config) Validate() error {
+	var errs []error
+	add := func(path string, err error) {
+		if err != nil {
+			errs = append(errs, &ConfigError{Path: path, Err: err})
+		}
+	}
+
+	if c.Backend != "" && !slices.Contains(backends, c.Backend) {
+		add("backend", fmt.Errorf("unknown backend %q, expected one of %s", c.Backend, strings.Join(backends, ", ")))
+	}
+	add("ebyte_address", validateHostPort(c.EByteAddress))
+	for i, addr := range c.FailoverAddresses {
+		add(fmt.Sprintf("failover_addresses[%d]", i), validateHostPort(addr))
+	}
+	if c.FailoverAfter < 1 {
+		add("failover_after", errors.New("must be at least 1"))
+	}
+	if c.FailbackInterval < 0 {
+		add("failback_interval", errors.New("must not be negative"))
+	}
+	if c.ListenProtocol != "" {
+		add("listen_protocol", validateProtocol(c.ListenProtocol, true))
+	}
+	if c.ListenAddress != "" {
+		add("listen_address", validateListenAddress(c.ListenAddress))
+	} else if c.ListenTLS {
+		add("listen_tls", errors.New("requires listen_address"))
+	}
+	if c.SLCANListenAddress != "" {
+		add("slcan_listen_address", validateListenAddress(c.SLCANListenAddress))
+	} else if c.SLCANListenTLS {
+		add("slcan_listen_tls", errors.New("requires slcan_listen_address"))
+	}
+	c.ListenAccess.validate("listen_access", add)
+	c.SLCANListenAccess.validate("slcan_listen_access", add)
+	if c.MaxClients < 0 {
+		add("max_clients", errors.New("must not be negative"))
+	}
+	if c.MaxClientsPerIP < 0 {
+		add("max_clients_per_ip", errors.New("must not be negative"))
+	}
+	names := make(map[string]bool)
+	for _, l := range c.listeners()[:len(c.listeners())-len(c.Listeners)] {
+		names[l.name()] = true
+	}
+	for i, l := range c.Listeners {
+		path := fmt.Sprintf("listeners[%d]", i)
+		l.validate(path, add)
+		if names[l.name()] {
+			add(path+".name", fmt.Errorf("duplicate listener name %q", l.name()))
+		}
+		names[l.name()] = true
+	}
+	if len(names) == 0 {
+		add("listeners", errors.New("no client listener configured"))
+	}
+	if c.Detect.Timeout <= 0 {
+		add("detect.timeout", errors.New("must be greater than zero"))
+	}
+	add("detect.fallback", validateProtocol(c.Detect.Fallback, false))
+	if slices.ContainsFunc(c.listeners(), func(l ListenerConfig) bool { return l.TLS }) {
+		c.TLS.validate(add)
+	}
+	if c.ReconnectDelay < 0 {
+		add("reconnect_delay", errors.New("must not be negative"))
+	}
+	if c.ReconnectMaxDelay < 0 {
+		add("reconnect_max_delay", errors.New("must not be negative"))
+	}
+	if c.ReconnectMultiplier < 1 {
+		add("reconnect_multiplier", errors.New("must be at least 1"))
+	}
+	if c.ReconnectJitter < 0 || c.ReconnectJitter > 1 {
+		add("reconnect_jitter", errors.New("must be between 0 and 1"))
+	}
+	if c.DialTimeout < 0 {
+		add("dial_timeout", errors.New("must not be negative"))
+	}
+	if c.KeepAliveIdle < 0 {
+		add("keepalive_idle", errors.New("must not be negative"))
+	}
+	if c.KeepAliveInterval < 0 {
+		add("keepalive_interval", errors.New("must not be negative"))
+	}
+	if c.KeepAliveCount < 0 {
+		add("keepalive_count", errors.New("must not be negative"))
+	}
+	if c.AdapterIdleTimeout < 0 {
+		add("adapter_idle_timeout", errors.New("must not be negative"))
+	}
+	if c.ShutdownTimeout < 0 {
+		add("shutdown_timeout", errors.New("must not be negative"))
+	}
+	if c.BusBitrate == 0 {
+		add("bus_bitrate", errors.New("must be greater than zero"))
+	}
+	if c.StatsInterval < 0 {
+		add("stats_interval", errors.New("must not be negative"))
+	}
+	if c.AdminAddress != "" {
+		add("admin_address", validateListenAddress(c.AdminAddress))
+	}
+
+	if _, err := parseLevel(c.Log.Level); err != nil {
+		add("log.level", err)
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "", "text", "json":
+	default:
+		add("log.format", fmt.Errorf("unknown log format %q", c.Log.Format))
+	}
+	if c.Log.MaxSize < 0 {
+		add("log.max_size", errors.New("must not be negative"))
+	}
+	if c.Log.MaxBackups < 0 {
+		add("log.max_backups", errors.New("must not be negative"))
+	}
+	for name, level := range c.Log.ComponentLevels {
+		if _, err := parseLevel(level); err != nil {
+			add(fmt.Sprintf("log.component_levels.%s", name), err)
+		}
+	}
+
+	for i, name := range c.Candump.Interfaces {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			add(fmt.Sprintf("candump.interfaces[%d]", i), fmt.Errorf("invalid interface name %q", name))
+		}
+	}
+
+	switch c.Capture.Format {
+	case "", captureFormatPcapNG, captureFormatPcap:
+	default:
+		add("capture.format", fmt.Errorf("unknown capture format %q, expected pcapng or pcap", c.Capture.Format))
+	}
+	for i, name := range c.Capture.Interfaces {
+		if name == "" || strings.ContainsAny(name, " \t\r\n") {
+			add(fmt.Sprintf("capture.interfaces[%d]", i), fmt.Errorf("invalid interface name %q", name))
+		}
+	}
+	c.Capture.Rotation.validate("capture.rotation", c.Capture.File, add)
+	c.ASC.Rotation.validate("asc.rotation", c.ASC.File, add)
+	c.TRC.Rotation.validate("trc.rotation", c.TRC.File, add)
+	c.Replay.validate(add)
+	c.SocketCAN.validate(c.Backend == backendSocketCAN, add)
+	c.Cannelloni.validate(add)
+	if c.TRC.PerBus && c.TRC.File == "-" {
+		add("trc.per_bus", errors.New("stdout cannot be split by bus"))
+	}
+
+	for i, f := range c.Filters {
+		if f.ID > 0x1FFFFFFF {
+			add(fmt.Sprintf("filters[%d].id", i), fmt.Errorf("identifier 0x%X exceeds 29 bits", uint32(f.ID)))
+		}
+		if f.Mask > 0x1FFFFFFF {
+			add(fmt.Sprintf("filters[%d].mask", i), fmt.Errorf("mask 0x%X exceeds 29 bits", uint32(f.Mask)))
+		}
+		if f.Extended != nil && !*f.Extended && f.ID > 0x7FF {
+			add(fmt.Sprintf("filters[%d].id", i), fmt.Errorf("identifier 0x%X exceeds 11 bits of a standard frame", uint32(f.ID)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateHostPort checks that addr has the host:port form with a numeric
+// port.
+func validateHostPort(addr string) error {
+	if addr == "" {
+		return errors.New("must not be empty")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// restartRequired lists the settings that differ between c and next but
+// cannot be applied to a running bridge.
+func (c Config) restartRequired(next Config) []string {
+	var fields []string
+	check := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	check("backend", c.Backend != next.Backend)
+	check("ebyte_address", c.EByteAddress != next.EByteAddress)
+	check("failover_addresses", !slices.Equal(c.FailoverAddresses, next.FailoverAddresses))
+	check("failover_after", c.FailoverAfter != next.FailoverAfter)
+	check("failback_interval", c.FailbackInterval != next.FailbackInterval)
+	check("listen_address", c.ListenAddress != next.ListenAddress)
+	check("listen_protocol", c.ListenProtocol != next.ListenProtocol)
+	check("listen_tls", c.ListenTLS != next.ListenTLS)
+	check("slcan_listen_address", c.SLCANListenAddress != next.SLCANListenAddress)
+	check("slcan_listen_tls", c.SLCANListenTLS != next.SLCANListenTLS)
+	check("detect", c.Detect != next.Detect)
+	check("listeners", !slices.EqualFunc(c.Listeners, next.Listeners, func(a, b ListenerConfig) bool {
+		// access lists are applied by Reload
+		a.Access, b.Access = AccessConfig{}, AccessConfig{}
+		return reflect.DeepEqual(a, b)
+	}))
+	check("tls", !reflect.DeepEqual(c.TLS, next.TLS))
+	check("reconnect_delay", c.ReconnectDelay != next.ReconnectDelay)
+	check("reconnect_max_delay", c.ReconnectMaxDelay != next.ReconnectMaxDelay)
+	check("reconnect_multiplier", c.ReconnectMultiplier != next.ReconnectMultiplier)
+	check("reconnect_jitter", c.ReconnectJitter != next.ReconnectJitter)
+	check("dial_timeout", c.DialTimeout != next.DialTimeout)
+	check("keepalive_idle", c.KeepAliveIdle != next.KeepAliveIdle)
+	check("keepalive_interval", c.KeepAliveInterval != next.KeepAliveInterval)
+	check("keepalive_count", c.KeepAliveCount != next.KeepAliveCount)
+	check("adapter_idle_timeout", c.AdapterIdleTimeout != next.AdapterIdleTimeout)
+	check("shutdown_timeout", c.ShutdownTimeout != next.ShutdownTimeout)
+	check("stats_interval", c.StatsInterval != next.StatsInterval)
+	check("admin_address", c.AdminAddress != next.AdminAddress)
+	check("candump", !reflect.DeepEqual(c.Candump, next.Candump))
+	check("capture", !reflect.DeepEqual(c.Capture, next.Capture))
+	check("asc", c.ASC != next.ASC)
+	check("trc", c.TRC != next.TRC)
+	check("replay", c.Replay != next.Replay)
+	check("socketcan", c.SocketCAN != next.SocketCAN)
+	check("cannelloni", c.Cannelloni != next.Cannelloni)
+	check("log.format", c.Log.Format != next.Log.Format)
+	check("log.file", c.Log.File != next.Log.File)
+	check("log.max_size", c.Log.MaxSize != next.Log.MaxSize)
+	check("log.max_backups", c.Log.MaxBackups != next.Log.MaxBackups)
+	return fields
+}
+
+// String renders the configuration in the file format.
+func (c Config) String() string {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		type plain Config
+		return fmt.Sprintf("%+v", plain(c))
+	}
+	return string(data)
 }
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bridge.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFileOverlaysDefaults(t *testing.T) {
+	path := writeConfig(t, `{
+		"ebyte_address": "192.0.2.10:4001",
+		"reconnect_delay": "5s",
+		"log": {"level": "debug"},
+		"filters": [{"id": "0x7E0", "mask": "0x7F0"}, {"id": 256, "exclude": true}]
+	}`)
+
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Fatalf("LoadConfigFile returned error: %v", err)
+	}
+	if cfg.EByteAddress != "192.0.2.10:4001" || cfg.ReconnectDelay != Duration(5*time.Second) {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.Log.Level != "debug" || cfg.Log.Format != "text" {
+		t.Fatalf("expected log level from file and format from defaults, got %+v", cfg.Log)
+	}
+	if cfg.ListenAddress != DefaultConfig().ListenAddress {
+		t.Fatalf("expected default listen address, got %q", cfg.ListenAddress)
+	}
+	if len(cfg.Filters) != 2 || cfg.Filters[0].Mask != 0x7F0 || cfg.Filters[1].ID != 0x100 {
+		t.Fatalf("unexpected filters %+v", cfg.Filters)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+}
+
+func TestValidateRaisesReconnectMaxDelay(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ReconnectDelay = Duration(2 * time.Minute)
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("a reconnect delay above the default maximum must be accepted: %v", err)
+	}
+	if bo := newBackoff(2*time.Minute, time.Minute, 2, 0); bo.Next() != 2*time.Minute || bo.Next() != 2*time.Minute {
+		t.Fatalf("expected the maximum delay to be raised to the initial delay")
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown field": `{"ebyte_adress": "x"}`,
+		"syntax":        "{\n  \"listen_address\": \n}",
+		"type":          `{"log": {"max_size": "big"}}`,
+	}
+	for name, content := range cases {
+		cfg := DefaultConfig()
+		if err := LoadConfigFile(writeConfig(t, content), &cfg); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	cfg := DefaultConfig()
+	err := LoadConfigFile(writeConfig(t, `{"log": {"max_size": "big"}}`), &cfg)
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || cfgErr.Path != "log.max_size" {
+		t.Fatalf("expected error for log.max_size, got %v", err)
+	}
+}
+
+func TestValidateReportsPaths(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ListenAddress = "0.0.0.0"
+	cfg.Log.Level = "loud"
+	standard := false
+	cfg.Filters = []Filter{{ID: 0x100}, {ID: 0x100, Mask: 0x40000000}, {ID: 0x800, Extended: &standard}}
+	cfg.ListenTLS = true
+	cfg.TLS.AllowedClients = []string{"savvycan"}
+	cfg.SLCANListenAccess.Deny = []string{"10.0.0.0/8", "bogus"}
+	cfg.Capture = CaptureConfig{File: "-", Format: "erf", Rotation: TraceRotation{MaxAge: Duration(time.Hour)}}
+	cfg.Replay.Speed = 0
+	cfg.Backend = "pcan"
+	cfg.SocketCAN.MirrorTX = true
+	cfg.Cannelloni.Peer = "192.0.2.30"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, path := range []string{"listen_address:", "log.level:", "filters[1].mask:", "filters[2].id:", "tls.cert_file:", "tls.allowed_clients:", "slcan_listen_access.deny[1]:", "capture.format:", "capture.rotation:", "replay.speed:", "backend:", "socketcan.mirror_tx:", "cannelloni.peer:"} {
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("expected %q in %v", path, err)
+		}
+	}
+	if strings.Contains(err.Error(), "filters[0]") {
+		t.Fatalf("unexpected error for valid filter: %v", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"BRIDGE_BUS_BITRATE":           "250000",
+		"BRIDGE_RECONNECT_DELAY":       "10s",
+		"BRIDGE_LOG_LEVEL":             "warn",
+		"BRIDGE_LOG_COMPONENT_LEVELS":  `{"adapter":"debug"}`,
+		"BRIDGE_FILTERS":               `[{"id":"0x123"}]`,
+		"BRIDGE_UNRELATED_SETTING_XYZ": "ignored",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg := DefaultConfig()
+	if err := ApplyEnv(&cfg, lookup); err != nil {
+		t.Fatalf("ApplyEnv returned error: %v", err)
+	}
+	if cfg.BusBitrate != 250000 || cfg.ReconnectDelay != Duration(10*time.Second) || cfg.Log.Level != "warn" {
+		t.Fatalf("environment values not applied: %+v", cfg)
+	}
+	if cfg.Log.ComponentLevels["adapter"] != "debug" {
+		t.Fatalf("unexpected component levels %v", cfg.Log.ComponentLevels)
+	}
+	if len(cfg.Filters) != 1 || cfg.Filters[0].ID != 0x123 {
+		t.Fatalf("unexpected filters %+v", cfg.Filters)
+	}
+
+	env = map[string]string{"BRIDGE_BUS_BITRATE": "fast"}
+	var cfgErr *ConfigError
+	if err := ApplyEnv(&cfg, lookup); !errors.As(err, &cfgErr) || cfgErr.Path != "bus_bitrate" {
+		t.Fatalf("expected bus_bitrate error, got %v", err)
+	}
+}
+
+func TestFilterSet(t *testing.T) {
+	fs := newFilterSet([]Filter{
+		{ID: 0x7E0, Mask: 0x7F0},
+		{ID: 0x7E5, Exclude: true},
+	})
+	cases := map[uint32]bool{0x7E0: true, 0x7E8: true, 0x7E5: false, 0x100: false}
+	for id, want := range cases {
+		if got := fs.allows(ebyte.Frame{ID: id}); got != want {
+			t.Fatalf("allows(0x%X) = %v, want %v", id, got, want)
+		}
+	}
+	if !fs.allows(ebyte.Frame{ID: 0x7E0, Extended: true}) {
+		t.Fatalf("expected a filter without frame type to match extended frames")
+	}
+
+	standard := false
+	fs = newFilterSet([]Filter{{ID: 0x100, Extended: &standard}})
+	if !fs.allows(ebyte.Frame{ID: 0x100}) || fs.allows(ebyte.Frame{ID: 0x100, Extended: true}) {
+		t.Fatalf("expected the filter to match only the standard frame 0x100")
+	}
+	if !newFilterSet(nil).allows(ebyte.Frame{ID: 0x123}) {
+		t.Fatalf("expected empty filter set to allow all frames")
+	}
+}
+
+func TestReloadAppliesSafeSettings(t *testing.T) {
+	b := newTestBridge(t)
+	cfg := b.cfg
+	cfg.BusBitrate = 250000
+	cfg.Log.Level = "debug"
+	cfg.Filters = []Filter{{ID: 0x100}}
+
+	if err := b.Reload(cfg); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if b.bitrate.Load() != 250000 {
+		t.Fatalf("bitrate not applied")
+	}
+	if b.logging.Levels()[""] != "debug" {
+		t.Fatalf("log level not applied")
+	}
+	if b.filters.Load().allows(ebyte.Frame{ID: 0x200}) {
+		t.Fatalf("filters not applied")
+	}
+
+	cfg.ListenAddress = "0.0.0.0:2323"
+	if err := b.Reload(cfg); err != nil {
+		t.Fatalf("Reload returned error: %v", err)
+	}
+	if fields := b.applied.restartRequired(cfg); len(fields) != 0 {
+		t.Fatalf("reload did not record the applied configuration, still differs in %v", fields)
+	}
+
+	cfg.Log.Level = "loud"
+	if err := b.Reload(cfg); err == nil {
+		t.Fatalf("expected invalid configuration to be rejected")
+	}
+	if b.logging.Levels()[""] != "debug" {
+		t.Fatalf("rejected reload changed the log level")
+	}
+	if b.applied.Log.Level != "debug" {
+		t.Fatalf("rejected reload replaced the applied configuration")
+	}
+}
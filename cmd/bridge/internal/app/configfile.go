@@ -0,0 +1,148 @@
+package app
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is prepended to the upper-cased configuration path to form the
+// name of the environment variable overriding a setting, e.g.
+// BRIDGE_LOG_LEVEL for log.level.
+const EnvPrefix = "BRIDGE_"
+
+// LoadConfigFile overlays the settings present in the JSON file at path onto
+// cfg. Settings missing from the file keep their current value; unknown keys
+// are rejected.
+func LoadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, describeJSONError(data, err))
+	}
+	if dec.More() {
+		return fmt.Errorf("%s: unexpected data after the configuration object", path)
+	}
+	return nil
+}
+
+// describeJSONError adds the line and column or the setting path to errors
+// returned by encoding/json.
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, col := lineColumn(data, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		line, col := lineColumn(data, typeErr.Offset)
+		return &ConfigError{
+			Path: typeErr.Field,
+			Err:  fmt.Errorf("line %d, column %d: cannot use JSON %s as %s", line, col, typeErr.Value, typeErr.Type),
+		}
+	}
+	return err
+}
+
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// ApplyEnv overrides settings from environment variables named after their
+// configuration path. Scalars are given as plain text, durations in Go
+// syntax and lists or maps as JSON.
+func ApplyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(cfg).Elem(), "", lookup)
+}
+
+func applyEnv(v reflect.Value, path string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct && !isTextField(fv) {
+			if err := applyEnv(fv, fieldPath, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env := EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_").Replace(fieldPath))
+		raw, ok := lookup(env)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fv, raw); err != nil {
+			return &ConfigError{Path: fieldPath, Err: fmt.Errorf("environment variable %s: %w", env, err)}
+		}
+	}
+	return nil
+}
+
+func isTextField(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// setFromString parses raw according to the kind of v.
+func setFromString(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	default:
+		target := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(raw), target.Interface()); err != nil {
+			return err
+		}
+		v.Set(target.Elem())
+	}
+	return nil
+}
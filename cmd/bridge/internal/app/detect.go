@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// protocolAuto makes a listener detect the client protocol from the first
+// bytes the client sends.
+const protocolAuto = "auto"
+
+// DetectConfig controls protocol detection on listeners using "auto".
+type DetectConfig struct {
+	// Timeout is how long to wait for the client's first bytes.
+	Timeout Duration `json:"timeout"`
+	// Fallback is the protocol used when the client stays silent or sends
+	// bytes no protocol recognises.
+	Fallback string `json:"fallback"`
+}
+
+// classifyPrefix inspects the bytes a client sent first. It returns the
+// detected protocol, or "" with done set if no protocol matches and with
+// done unset if more bytes are needed.
+func classifyPrefix(prefix []byte) (protocol string, done bool) {
+	if len(prefix) == 0 {
+		return "", false
+	}
+	switch prefix[0] {
+	case 0xF1:
+		// GVRET command without the binary mode handshake
+		return protocolGVRET, true
+	case 0xE7:
+		if len(prefix) < 2 {
+			return "", false
+		}
+		if prefix[1] == 0xE7 {
+			return protocolGVRET, true
+		}
+		return "", true
+	}
+	// SLCAN commands are printable ASCII terminated by a carriage return.
+	for _, by := range prefix {
+		switch {
+		case by == '\r':
+			return protocolSLCAN, true
+		case by == '\n', by >= 0x20 && by <= 0x7E:
+		default:
+			return "", true
+		}
+	}
+	if len(prefix) >= slcanMaxLine {
+		return "", true
+	}
+	return "", false
+}
+
+// detectProtocol reads from conn until the received bytes identify the
+// protocol, no protocol can match or the detection timeout expires. It
+// returns the protocol to use together with the bytes read, which belong to
+// the client's first message.
+func (b *Bridge) detectProtocol(ctx context.Context, conn net.Conn, log Logger) (string, []byte, error) {
+	detect := b.cfg.Detect
+	deadline := time.Now().Add(time.Duration(detect.Timeout))
+	_ = conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	prefix := make([]byte, 0, slcanMaxLine)
+	buf := make([]byte, slcanMaxLine)
+	for {
+		n, err := conn.Read(buf[:cap(prefix)-len(prefix)])
+		prefix = append(prefix, buf[:n]...)
+		if protocol, done := classifyPrefix(prefix); done {
+			if protocol != "" {
+				log.Debug("client protocol detected", "detected", protocol)
+				return protocol, prefix, nil
+			}
+			log.Info("client protocol not recognised, using fallback", "fallback", detect.Fallback, "prefix", prefix)
+			return detect.Fallback, prefix, nil
+		}
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && ctx.Err() == nil {
+				log.Debug("client sent nothing to detect the protocol, using fallback", "fallback", detect.Fallback)
+				return detect.Fallback, prefix, nil
+			}
+			return "", nil, err
+		}
+	}
+}
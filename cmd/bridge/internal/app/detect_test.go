@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClassifyPrefix(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		protocol string
+		done     bool
+	}{
+		{"", "", false},
+		{"\xE7", "", false},
+		{"\xE7\xE7", protocolGVRET, true},
+		{"\xF1\x09", protocolGVRET, true},
+		{"\xE7\x41", "", true},
+		{"S6", "", false},
+		{"S6\r", protocolSLCAN, true},
+		{"\r\r\r", protocolSLCAN, true},
+		{"GET /\x00", "", true},
+	}
+	for _, tc := range cases {
+		protocol, done := classifyPrefix([]byte(tc.prefix))
+		if protocol != tc.protocol || done != tc.done {
+			t.Fatalf("classifyPrefix(%q) = %q, %v; want %q, %v", tc.prefix, protocol, done, tc.protocol, tc.done)
+		}
+	}
+}
+
+func TestRunAutoDetect(t *testing.T) {
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.ListenProtocol = protocolAuto
+	b.cfg.Detect = DetectConfig{Timeout: Duration(100 * time.Millisecond), Fallback: protocolSLCAN}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	dial := func() net.Conn {
+		t.Helper()
+		var conn net.Conn
+		waitFor(t, func() bool {
+			var err error
+			conn, err = net.Dial("tcp", b.cfg.ListenAddress)
+			return err == nil
+		})
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	gvret := dial()
+	defer gvret.Close()
+	if _, err := gvret.Write([]byte{0xE7, 0xE7, 0xF1, 0x09}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	ack := make([]byte, 2)
+	if _, err := io.ReadFull(gvret, ack); err != nil || ack[0] != 0xF1 || ack[1] != 0x09 {
+		t.Fatalf("expected GVRET validation ack, got %X (%v)", ack, err)
+	}
+
+	// Detection also accepts a command without the handshake.
+	command := dial()
+	defer command.Close()
+	if _, err := command.Write([]byte{0xF1, 0x09}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := io.ReadFull(command, ack); err != nil || ack[0] != 0xF1 || ack[1] != 0x09 {
+		t.Fatalf("expected GVRET validation ack without handshake, got %X (%v)", ack, err)
+	}
+
+	slcan := dial()
+	defer slcan.Close()
+	if _, err := slcan.Write([]byte("V\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if line, err := bufio.NewReader(slcan).ReadString('\r'); err != nil || line != "V0100\r" {
+		t.Fatalf("unexpected SLCAN reply %q (%v)", line, err)
+	}
+
+	// A silent client gets the fallback protocol once the timeout expires.
+	silent := dial()
+	defer silent.Close()
+	waitFor(t, func() bool {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		return len(b.clients) == 4
+	})
+	if _, err := silent.Write([]byte("N\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if line, err := bufio.NewReader(silent).ReadString('\r'); err != nil || line != "NEB01\r" {
+		t.Fatalf("unexpected fallback reply %q (%v)", line, err)
+	}
+}
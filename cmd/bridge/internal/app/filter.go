@@ -0,0 +1,97 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// CANID is a CAN identifier that accepts both JSON numbers and hexadecimal
+// strings such as "0x7E8" in configuration files.
+type CANID uint32
+
+// MarshalJSON writes the identifier as a hexadecimal string.
+func (id CANID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("0x%X", uint32(id)))
+}
+
+// UnmarshalJSON accepts a number or a string in any base understood by
+// strconv.ParseUint with base 0.
+func (id *CANID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	return id.UnmarshalText([]byte(s))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for environment values.
+func (id *CANID) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseUint(string(text), 0, 32)
+	if err != nil {
+		return fmt.Errorf("invalid CAN identifier %q", text)
+	}
+	*id = CANID(v)
+	return nil
+}
+
+// Filter selects frames whose identifier matches ID under Mask. A zero mask
+// requires an exact match. Extended restricts the filter to extended (true)
+// or standard (false) frames; unset, it matches both frame types. Exclude
+// filters drop matching frames; if any include filters exist, a frame must
+// match at least one of them.
+type Filter struct {
+	ID       CANID `json:"id"`
+	Mask     CANID `json:"mask,omitempty"`
+	Extended *bool `json:"extended,omitempty"`
+	Exclude  bool  `json:"exclude,omitempty"`
+}
+
+func (f Filter) matches(frame ebyte.Frame) bool {
+	if f.Extended != nil && *f.Extended != (frame.Extended || frame.ID > 0x7FF) {
+		return false
+	}
+	mask := uint32(f.Mask)
+	if mask == 0 {
+		mask = 0x1FFFFFFF
+	}
+	return frame.ID&mask == uint32(f.ID)&mask
+}
+
+// filterSet is the compiled form of the configured filters.
+type filterSet struct {
+	include []Filter
+	exclude []Filter
+}
+
+func newFilterSet(filters []Filter) *filterSet {
+	fs := &filterSet{}
+	for _, f := range filters {
+		if f.Exclude {
+			fs.exclude = append(fs.exclude, f)
+		} else {
+			fs.include = append(fs.include, f)
+		}
+	}
+	return fs
+}
+
+// allows reports whether the frame passes the filters.
+func (fs *filterSet) allows(frame ebyte.Frame) bool {
+	for _, f := range fs.exclude {
+		if f.matches(frame) {
+			return false
+		}
+	}
+	if len(fs.include) == 0 {
+		return true
+	}
+	for _, f := range fs.include {
+		if f.matches(frame) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// serveGVRET runs a session with a GVRET device such as ESP32RET or M2RET on
+// an established connection: it completes the handshake, queries the
+// device's buses for the GVRET clients and then passes frames in both
+// directions until an error occurs. The returned flag reports whether the
+// handshake succeeded.
+func (b *Bridge) serveGVRET(ctx context.Context, conn net.Conn, addr string, log Logger) (bool, error) {
+	handshakeCtx := ctx
+	if timeout := time.Duration(b.cfg.DialTimeout); timeout > 0 {
+		var cancel context.CancelFunc
+		handshakeCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	device, err := gvret.NewClient(handshakeCtx, conn)
+	if err != nil {
+		return false, fmt.Errorf("GVRET handshake: %w", err)
+	}
+	buses, err := device.Buses(handshakeCtx)
+	if err != nil {
+		_ = device.Close()
+		return false, fmt.Errorf("GVRET bus query: %w", err)
+	}
+	for i, bus := range buses {
+		log.Info("GVRET device bus", "bus", i, "enabled", bus.Enabled, "listen_only", bus.ListenOnly, "bitrate", bus.Bitrate)
+	}
+	b.deviceBuses.Store(&buses)
+	b.adapterUp(conn.RemoteAddr().String(), addr, log)
+
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		b.adapterWriter(ctx, conn, log, stopWriter, func(tx txFrame) error {
+			if err := device.Send(toGVRET(tx.frame, tx.bus, 0)); err != nil {
+				return err
+			}
+			b.observeTransmit(tx, time.Now())
+			return nil
+		})
+	}()
+
+	// The client reads on its own; forward its frames so that the loop
+	// below can watch the link at the same time. The connection stays open
+	// after the session ends until the writer flushed pending transmits.
+	frames := make(chan gvret.Frame)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			f, err := device.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case frames <- f:
+			case <-writerDone:
+				return
+			}
+		}
+	}()
+	defer func() {
+		b.adapterConnected.Store(false)
+		close(stopWriter)
+		<-writerDone
+		_ = device.Close()
+		log.Info("disconnected from adapter")
+	}()
+
+	idleTimeout := time.Duration(b.cfg.AdapterIdleTimeout)
+	lastData := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		deadline := b.readDeadline(lastData)
+		timer.Reset(time.Until(deadline))
+		b.expectProgress(time.Until(deadline))
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-recvErr:
+			return true, fmt.Errorf("adapter read: %w", err)
+		case f := <-frames:
+			lastData = time.Now()
+			b.lastAdapterData.Store(lastData.UnixNano())
+			b.deliverFrame(fromGVRET(f), f.Bus, lastData)
+		case <-timer.C:
+			if idleTimeout > 0 && time.Since(lastData) >= idleTimeout {
+				if b.handleSilence(ctx, log, device.Validate, time.Since(lastData)) {
+					lastData = time.Now()
+					continue
+				}
+				return true, errLinkSilent
+			}
+		}
+	}
+}
+
+// toGVRET converts a bridge frame received on bus at the given GVRET
+// timestamp.
+func toGVRET(frame ebyte.Frame, bus uint8, timestamp uint32) gvret.Frame {
+	return gvret.Frame{
+		Timestamp: timestamp,
+		ID:        frame.ID,
+		Extended:  frame.Extended,
+		Remote:    frame.Remote,
+		Bus:       bus,
+		DLC:       frame.DLC,
+		Data:      frame.Data,
+	}
+}
+
+// fromGVRET converts a GVRET frame, dropping its bus and timestamp.
+func fromGVRET(f gvret.Frame) ebyte.Frame {
+	return ebyte.Frame{ID: f.ID, Extended: f.Extended, Remote: f.Remote, DLC: f.DLC, Data: f.Data}
+}
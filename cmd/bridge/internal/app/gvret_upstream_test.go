@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+)
+
+// fakeGVRETDevice answers like an ESP32RET with two buses and reports the
+// frames it is asked to transmit.
+type fakeGVRETDevice struct {
+	conn net.Conn
+	sent chan gvret.Frame
+}
+
+func (d *fakeGVRETDevice) Transmit(f gvret.Frame) { d.sent <- f }
+func (d *fakeGVRETDevice) Reply(data []byte)      { _, _ = d.conn.Write(data) }
+func (d *fakeGVRETDevice) Timestamp() uint32      { return 0 }
+func (d *fakeGVRETDevice) Buses() []gvret.BusInfo {
+	return []gvret.BusInfo{{Enabled: true, Bitrate: 500000}, {Enabled: true, ListenOnly: true, Bitrate: 125000}}
+}
+
+func TestRunGVRETBackend(t *testing.T) {
+	sent := make(chan gvret.Frame, 1)
+	connected := make(chan net.Conn, 1)
+	deviceAddr := startFakeAdapter(t, func(conn net.Conn) {
+		dev := &fakeGVRETDevice{conn: conn, sent: sent}
+		s := gvret.NewSession(dev)
+		connected <- conn
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			s.Receive(buf[:n])
+		}
+	})
+	b := newTestBridge(t)
+	b.cfg.Backend = backendGVRET
+	b.cfg.EByteAddress = deviceAddr
+	b.cfg.ListenAddress = freeAddress(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}()
+	deviceConn := <-connected
+	waitFor(t, b.adapterConnected.Load)
+
+	queryCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	c, err := gvret.Dial(queryCtx, b.cfg.ListenAddress)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	buses, err := c.Buses(queryCtx)
+	if err != nil {
+		t.Fatalf("Buses: %v", err)
+	}
+	if len(buses) != 2 || buses[1].Bitrate != 125000 || !buses[1].ListenOnly {
+		t.Fatalf("expected the device's buses, got %+v", buses)
+	}
+
+	// A frame from the device reaches the client on its bus.
+	received := gvret.Frame{ID: 0x7E8, Bus: 1, DLC: 2, Data: [8]byte{0x41, 0x0C}}
+	data, _ := gvret.EncodeFrame(received)
+	if _, err := deviceConn.Write(data); err != nil {
+		t.Fatalf("device write: %v", err)
+	}
+	got, err := c.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	got.Timestamp = 0
+	if got != received {
+		t.Fatalf("client received %+v, want %+v", got, received)
+	}
+
+	// A client transmit reaches the device on the chosen bus.
+	transmit := gvret.Frame{ID: 0x18DAF110, Extended: true, Bus: 1, DLC: 3, Data: [8]byte{1, 2, 3}}
+	if err := c.Send(transmit); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case f := <-sent:
+		if f != transmit {
+			t.Fatalf("device received %+v, want %+v", f, transmit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("transmit did not reach the device")
+	}
+}
+
+func TestGVRETBackendProbesSilentBus(t *testing.T) {
+	deviceAddr := startFakeAdapter(t, func(conn net.Conn) {
+		s := gvret.NewSession(&fakeGVRETDevice{conn: conn})
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			s.Receive(buf[:n])
+		}
+	})
+	b := newTestBridge(t)
+	b.cfg.Backend = backendGVRET
+	b.cfg.EByteAddress = deviceAddr
+	b.cfg.AdapterIdleTimeout = Duration(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		connected, err := b.connectAndServe(ctx, deviceAddr, b.adapterLog)
+		if !connected {
+			t.Errorf("session not established: %v", err)
+		}
+		done <- err
+	}()
+	waitFor(t, func() bool { return b.busSilentEvents.Load() >= 2 })
+	cancel()
+	<-done
+	if n := b.linkSilentEvents.Load(); n != 0 {
+		t.Fatalf("expected a live link, got %d link silent events", n)
+	}
+}
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// protocols lists the protocols a client listener can speak; listeners may
+// also use protocolAuto to detect one of them.
+var protocols = []string{protocolGVRET, protocolSLCAN, protocolSocketCAND}
+
+// ListenerConfig describes one client listener. Address is "host:port" for
+// TCP on the address family given by the host, "tcp4:host:port" or
+// "tcp6:host:port" to force a family, "unix:/path" for a Unix domain socket
+// or "systemd:name" for a socket passed by systemd socket activation.
+type ListenerConfig struct {
+	// Name identifies the listener in logs; it defaults to
+	// "protocol@address".
+	Name     string `json:"name,omitempty"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	// SocketMode sets the permissions of a Unix socket file as an octal
+	// string such as "0660".
+	SocketMode string       `json:"socket_mode,omitempty"`
+	TLS        bool         `json:"tls,omitempty"`
+	Access     AccessConfig `json:"access"`
+}
+
+// name returns the configured or the derived listener name.
+func (l ListenerConfig) name() string {
+	if l.Name != "" {
+		return l.Name
+	}
+	return l.Protocol + "@" + l.Address
+}
+
+// validate reports problems with the listener below path.
+func (l ListenerConfig) validate(path string, add func(string, error)) {
+	add(path+".protocol", validateProtocol(l.Protocol, true))
+	add(path+".address", validateListenAddress(l.Address))
+	if network, _ := splitNetwork(l.Address); l.SocketMode != "" {
+		if network != "unix" {
+			add(path+".socket_mode", errors.New("only valid for unix sockets"))
+		} else if _, err := parseSocketMode(l.SocketMode); err != nil {
+			add(path+".socket_mode", err)
+		}
+	}
+	l.Access.validate(path+".access", add)
+}
+
+// listeners returns all configured client listeners: the main and SLCAN
+// shorthands first, followed by the entries of Listeners.
+func (c Config) listeners() []ListenerConfig {
+	var all []ListenerConfig
+	if c.ListenAddress != "" {
+		protocol := c.ListenProtocol
+		if protocol == "" {
+			protocol = protocolGVRET
+		}
+		all = append(all, ListenerConfig{Name: protocol, Protocol: protocol, Address: c.ListenAddress, TLS: c.ListenTLS, Access: c.ListenAccess})
+	}
+	if c.SLCANListenAddress != "" {
+		all = append(all, ListenerConfig{Name: protocolSLCAN, Protocol: protocolSLCAN, Address: c.SLCANListenAddress, TLS: c.SLCANListenTLS, Access: c.SLCANListenAccess})
+	}
+	return append(all, c.Listeners...)
+}
+
+// validateProtocol checks a protocol name; auto selects whether
+// protocolAuto is acceptable.
+func validateProtocol(protocol string, auto bool) error {
+	if slices.Contains(protocols, protocol) || (auto && protocol == protocolAuto) {
+		return nil
+	}
+	valid := strings.Join(protocols, ", ")
+	if auto {
+		valid += ", " + protocolAuto
+	}
+	return fmt.Errorf("unknown protocol %q, expected one of %s", protocol, valid)
+}
+
+// validateListenAddress checks an address in one of the forms accepted by
+// listen.
+func validateListenAddress(address string) error {
+	switch network, addr := splitNetwork(address); network {
+	case "unix":
+		if addr == "" {
+			return errors.New("missing socket path")
+		}
+	case "systemd":
+		if addr == "" {
+			return errors.New("missing socket name")
+		}
+	default:
+		return validateHostPort(addr)
+	}
+	return nil
+}
+
+// splitNetwork separates an optional "unix:", "systemd:", "tcp4:" or
+// "tcp6:" prefix from an address; addresses without prefix use "tcp".
+func splitNetwork(address string) (network, addr string) {
+	for _, network := range []string{"unix", "systemd", "tcp4", "tcp6"} {
+		if addr, ok := strings.CutPrefix(address, network+":"); ok {
+			return network, addr
+		}
+	}
+	return "tcp", address
+}
+
+func parseSocketMode(mode string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || v > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q", mode)
+	}
+	return os.FileMode(v), nil
+}
+
+// listen binds address, removing a stale Unix socket file first and
+// applying mode to it if set. Sockets passed by systemd are taken from
+// b.activated instead.
+func (b *Bridge) listen(address, mode string) (net.Listener, error) {
+	network, addr := splitNetwork(address)
+	switch network {
+	case "systemd":
+		return b.activatedListener(addr)
+	case "unix":
+	default:
+		return net.Listen(network, addr)
+	}
+	// A stale socket file from a previous run would make Listen fail.
+	if err := removeStaleSocket(addr); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if mode != "" {
+		perm, err := parseSocketMode(mode)
+		if err == nil {
+			err = os.Chmod(addr, perm)
+		}
+		if err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("set socket mode: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// removeStaleSocket deletes the Unix socket file at path if no process
+// accepts connections on it any more. Other files and sockets in use are
+// reported instead of removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use by another process", path)
+	}
+	return os.Remove(path)
+}
+
+// clientListener is a bound client listener together with its settings.
+type clientListener struct {
+	net.Listener
+	name     string
+	protocol string
+}
+
+// openListeners binds the configured client listeners and wraps those with
+// TLS enabled.
+func (b *Bridge) openListeners() ([]clientListener, error) {
+	var tlsConfig *tls.Config
+	var listeners []clientListener
+	fail := func(err error) ([]clientListener, error) {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		return nil, err
+	}
+	for _, spec := range b.cfg.listeners() {
+		if spec.TLS && tlsConfig == nil {
+			cfg, err := b.cfg.TLS.serverConfig()
+			if err != nil {
+				return fail(err)
+			}
+			tlsConfig = cfg
+		}
+		l, err := b.listen(spec.Address, spec.SocketMode)
+		if err != nil {
+			return fail(fmt.Errorf("listen on %s: %w", spec.Address, err))
+		}
+		if spec.TLS {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		listeners = append(listeners, clientListener{Listener: l, name: spec.name(), protocol: spec.Protocol})
+		b.logger.Info("client listener started", "listener", spec.name(), "protocol", spec.Protocol,
+			"listen", l.Addr().String(), "tls", spec.TLS)
+	}
+	return listeners, nil
+}
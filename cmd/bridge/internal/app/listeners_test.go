@@ -0,0 +1,136 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitNetwork(t *testing.T) {
+	cases := map[string][2]string{
+		"0.0.0.0:23":         {"tcp", "0.0.0.0:23"},
+		"tcp6:[::]:23":       {"tcp6", "[::]:23"},
+		"tcp4:127.0.0.1:23":  {"tcp4", "127.0.0.1:23"},
+		"unix:/run/can.sock": {"unix", "/run/can.sock"},
+	}
+	for input, want := range cases {
+		network, addr := splitNetwork(input)
+		if network != want[0] || addr != want[1] {
+			t.Fatalf("splitNetwork(%q) = %q, %q", input, network, addr)
+		}
+	}
+}
+
+func TestValidateListeners(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ListenAddress = ""
+	cfg.Listeners = []ListenerConfig{
+		{Protocol: "lawicel", Address: "127.0.0.1:3333"},
+		{Protocol: protocolSLCAN, Address: "127.0.0.1:3333", SocketMode: "0660"},
+		{Name: "local", Protocol: protocolGVRET, Address: "unix:/tmp/a.sock", SocketMode: "999"},
+		{Name: "local", Protocol: protocolGVRET, Address: "unix:"},
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatalf("expected validation error")
+	}
+	for _, path := range []string{
+		"listeners[0].protocol:", "listeners[1].socket_mode:", "listeners[2].socket_mode:",
+		"listeners[3].address:", "listeners[3].name:",
+	} {
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("expected %q in %v", path, err)
+		}
+	}
+
+	cfg.Listeners = nil
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "no client listener") {
+		t.Fatalf("expected error without listeners, got %v", err)
+	}
+}
+
+func TestRunUnixListener(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "slcan.sock")
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = ""
+	b.cfg.Listeners = []ListenerConfig{{Name: "local", Protocol: protocolSLCAN, Address: "unix:" + socket, SocketMode: "0600"}}
+	b.access.Store(&accessRules{lists: map[string]accessList{}, maxPerIP: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var conn net.Conn
+	waitFor(t, func() bool {
+		var err error
+		conn, err = net.Dial("unix", socket)
+		return err == nil
+	})
+	defer conn.Close()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected socket mode 0600, got %o", perm)
+	}
+
+	if _, err := conn.Write([]byte("N\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\r')
+	if err != nil || line != "NEB01\r" {
+		t.Fatalf("unexpected reply %q (%v)", line, err)
+	}
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err := removeStaleSocket(stale); err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	if _, err := os.Lstat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale socket not removed: %v", err)
+	}
+
+	active := filepath.Join(dir, "active.sock")
+	l, err = net.Listen("unix", active)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	regular := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(regular, []byte("{}"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for _, path := range []string{active, regular} {
+		if err := removeStaleSocket(path); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+		if _, err := os.Lstat(path); err != nil {
+			t.Fatalf("%s removed: %v", path, err)
+		}
+	}
+	if err := removeStaleSocket(filepath.Join(dir, "missing.sock")); err != nil {
+		t.Fatalf("missing socket: %v", err)
+	}
+}
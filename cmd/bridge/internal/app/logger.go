@@ -1,90 +1,308 @@
 package app
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
-)
-
-type LogLevel int32
 
-const (
-	LevelDebug LogLevel = iota
-	LevelInfo
-	LevelWarn
-	LevelError
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/rotate"
 )
 
+// Logger is the structured logger used throughout the bridge. Arguments after
+// the message are key/value pairs as understood by log/slog.
 type Logger interface {
-	// Debugf logs a debug-level message.
-	Debugf(format string, args ...any)
-	// Infof logs an info-level message.
-	Infof(format string, args ...any)
-	// Warnf logs a warning message.
-	Warnf(format string, args ...any)
-	// Errorf logs an error-level message.
-	Errorf(format string, args ...any)
+	// Debug logs a debug-level message.
+	Debug(msg string, args ...any)
+	// Info logs an info-level message.
+	Info(msg string, args ...any)
+	// Warn logs a warning message.
+	Warn(msg string, args ...any)
+	// Error logs an error-level message.
+	Error(msg string, args ...any)
+	// With returns a logger that adds the given attributes to every record.
+	With(args ...any) Logger
 }
 
-type stdLogger struct {
-	level atomic.Int32
-	l     *log.Logger
+// LogConfig describes the log output of the bridge.
+type LogConfig struct {
+	// Level is the default minimum level for all components.
+	Level string `json:"level"`
+	// Format selects the record encoding: "text" or "json".
+	Format string `json:"format"`
+	// File redirects the output from stdout to the given path.
+	File string `json:"file,omitempty"`
+	// MaxSize rotates File once it grows beyond the given number of bytes.
+	MaxSize int64 `json:"max_size"`
+	// MaxBackups limits the number of rotated files that are kept.
+	MaxBackups int `json:"max_backups"`
+	// ComponentLevels overrides Level for individual components such as
+	// "adapter", "client" or "stats".
+	ComponentLevels map[string]string `json:"component_levels,omitempty"`
 }
 
-// NewLogger creates a logger instance that writes to stdout with the requested
-// minimum level.
-func NewLogger(level string) (Logger, error) {
-	lvl, err := parseLevel(level)
+// Logging owns the log output and the per-component level table. Loggers
+// derived from it observe level changes immediately.
+type Logging struct {
+	handler slog.Handler
+	levels  *levelTable
+	out     io.Closer
+}
+
+// NewLogging creates the log backend described by cfg.
+func NewLogging(cfg LogConfig) (*Logging, error) {
+	levels, err := newLevelTable(cfg.Level, cfg.ComponentLevels)
 	if err != nil {
 		return nil, err
 	}
-	logger := log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds)
-	sl := &stdLogger{l: logger}
-	sl.level.Store(int32(lvl))
-	return sl, nil
+
+	var (
+		out    io.Writer = os.Stdout
+		closer io.Closer
+	)
+	if cfg.File != "" {
+		w, err := rotate.Open(cfg.File, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("open log file: %w", err)
+		}
+		out, closer = w, w
+	}
+
+	// Filtering happens in levelHandler, so the encoder accepts everything.
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	return &Logging{handler: handler, levels: levels, out: closer}, nil
+}
+
+// Logger returns a logger for the named component. Records carry the
+// component name as an attribute and are filtered by the component's level.
+func (lg *Logging) Logger(component string) Logger {
+	h := &levelHandler{inner: lg.handler, levels: lg.levels, component: component}
+	return &slogLogger{l: slog.New(h).With("component", component)}
 }
 
-// parseLevel converts the textual representation into the internal log level.
-func parseLevel(level string) (LogLevel, error) {
+// SetLevel changes the minimum level of a component at runtime. An empty
+// component name changes the default level.
+func (lg *Logging) SetLevel(component, level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	lg.levels.set(component, lvl)
+	return nil
+}
+
+// Configure replaces the default level and all component overrides.
+// Components without an entry in components fall back to the default.
+func (lg *Logging) Configure(level string, components map[string]string) error {
+	next, err := newLevelTable(level, components)
+	if err != nil {
+		return err
+	}
+	lg.levels.replace(next)
+	return nil
+}
+
+// Levels reports the default level under the empty key and all component
+// overrides.
+func (lg *Logging) Levels() map[string]string {
+	return lg.levels.snapshot()
+}
+
+// ShiftLevels makes every level more verbose (negative steps) or quieter
+// (positive steps), clamped to the debug..error range.
+func (lg *Logging) ShiftLevels(steps int) {
+	lg.levels.shift(steps)
+}
+
+// Close releases the log file, if any.
+func (lg *Logging) Close() error {
+	if lg.out == nil {
+		return nil
+	}
+	return lg.out.Close()
+}
+
+// parseLevel converts the textual representation into a slog level.
+func parseLevel(level string) (slog.Level, error) {
 	switch strings.ToLower(level) {
 	case "debug":
-		return LevelDebug, nil
+		return slog.LevelDebug, nil
 	case "info":
-		return LevelInfo, nil
+		return slog.LevelInfo, nil
 	case "warn", "warning":
-		return LevelWarn, nil
+		return slog.LevelWarn, nil
 	case "error", "err":
-		return LevelError, nil
+		return slog.LevelError, nil
 	default:
 		return 0, fmt.Errorf("unknown log level %q", level)
 	}
 }
 
-func (l *stdLogger) enabled(level LogLevel) bool {
-	return LogLevel(l.level.Load()) <= level
+// levelTable holds the default level and per-component overrides. Levels are
+// stored atomically so they can be read on every log call without locking.
+type levelTable struct {
+	def atomic.Int32
+
+	mu         sync.RWMutex
+	components map[string]*atomic.Int32
 }
 
-func (l *stdLogger) logf(level LogLevel, prefix, format string, args ...any) {
-	if !l.enabled(level) {
+func newLevelTable(def string, components map[string]string) (*levelTable, error) {
+	lvl, err := parseLevel(def)
+	if err != nil {
+		return nil, err
+	}
+	t := &levelTable{components: make(map[string]*atomic.Int32)}
+	t.def.Store(int32(lvl))
+
+	names := make([]string, 0, len(components))
+	for name := range components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lvl, err := parseLevel(components[name])
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		t.set(name, lvl)
+	}
+	return t, nil
+}
+
+// get returns the effective level for the component.
+func (t *levelTable) get(component string) slog.Level {
+	t.mu.RLock()
+	v, ok := t.components[component]
+	t.mu.RUnlock()
+	if ok {
+		return slog.Level(v.Load())
+	}
+	return slog.Level(t.def.Load())
+}
+
+// set overrides the level of a component, or the default if component is
+// empty.
+func (t *levelTable) set(component string, level slog.Level) {
+	if component == "" {
+		t.def.Store(int32(level))
 		return
 	}
-	l.l.Printf(prefix+format, args...)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.components[component]
+	if !ok {
+		v = new(atomic.Int32)
+		t.components[component] = v
+	}
+	v.Store(int32(level))
+}
+
+// replace copies the levels of other into t.
+func (t *levelTable) replace(other *levelTable) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.def.Store(other.def.Load())
+	for name := range t.components {
+		if _, ok := other.components[name]; !ok {
+			delete(t.components, name)
+		}
+	}
+	for name, v := range other.components {
+		cur, ok := t.components[name]
+		if !ok {
+			cur = new(atomic.Int32)
+			t.components[name] = cur
+		}
+		cur.Store(v.Load())
+	}
+}
+
+// snapshot returns the textual level of the default and every override.
+func (t *levelTable) snapshot() map[string]string {
+	out := map[string]string{"": levelName(slog.Level(t.def.Load()))}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for name, v := range t.components {
+		out[name] = levelName(slog.Level(v.Load()))
+	}
+	return out
 }
 
-func (l *stdLogger) Debugf(format string, args ...any) {
-	l.logf(LevelDebug, "[DEBUG] ", format, args...)
+// shift moves all levels by the given number of steps.
+func (t *levelTable) shift(steps int) {
+	move := func(v *atomic.Int32) {
+		lvl := slog.Level(v.Load()) + slog.Level(steps*4)
+		lvl = max(slog.LevelDebug, min(slog.LevelError, lvl))
+		v.Store(int32(lvl))
+	}
+	move(&t.def)
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, v := range t.components {
+		move(v)
+	}
+}
+
+// levelName is the inverse of parseLevel.
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// levelHandler filters records using the level table entry of its component
+// before passing them on to the encoding handler.
+type levelHandler struct {
+	inner     slog.Handler
+	levels    *levelTable
+	component string
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.levels.get(h.component)
 }
 
-func (l *stdLogger) Infof(format string, args ...any) {
-	l.logf(LevelInfo, "[INFO] ", format, args...)
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
 }
 
-func (l *stdLogger) Warnf(format string, args ...any) {
-	l.logf(LevelWarn, "[WARN] ", format, args...)
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), levels: h.levels, component: h.component}
 }
 
-func (l *stdLogger) Errorf(format string, args ...any) {
-	l.logf(LevelError, "[ERROR] ", format, args...)
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), levels: h.levels, component: h.component}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (l *slogLogger) Debug(msg string, args ...any) { l.l.Debug(msg, args...) }
+
+func (l *slogLogger) Info(msg string, args ...any) { l.l.Info(msg, args...) }
+
+func (l *slogLogger) Warn(msg string, args ...any) { l.l.Warn(msg, args...) }
+
+func (l *slogLogger) Error(msg string, args ...any) { l.l.Error(msg, args...) }
+
+func (l *slogLogger) With(args ...any) Logger {
+	return &slogLogger{l: l.l.With(args...)}
 }
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggingComponentLevels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.log")
+	logging, err := NewLogging(LogConfig{
+		Level:           "info",
+		Format:          "json",
+		File:            path,
+		ComponentLevels: map[string]string{"adapter": "debug", "stats": "error"},
+	})
+	if err != nil {
+		t.Fatalf("NewLogging returned error: %v", err)
+	}
+
+	logging.Logger("adapter").Debug("adapter detail", "frame_id", "123")
+	logging.Logger("stats").Warn("suppressed")
+	logging.Logger("client").Debug("suppressed")
+	logging.Logger("client").With("client", "192.0.2.1:5000").Info("client connected")
+	if err := logging.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d: %s", len(lines), data)
+	}
+
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("invalid JSON record %q: %v", lines[0], err)
+	}
+	if rec["component"] != "adapter" || rec["frame_id"] != "123" || rec["level"] != "DEBUG" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("invalid JSON record %q: %v", lines[1], err)
+	}
+	if rec["client"] != "192.0.2.1:5000" {
+		t.Fatalf("expected client attribute, got %v", rec)
+	}
+}
+
+func TestLevelTableSet(t *testing.T) {
+	levels, err := newLevelTable("warn", nil)
+	if err != nil {
+		t.Fatalf("newLevelTable returned error: %v", err)
+	}
+	levels.set("client", slog.LevelDebug)
+	if got := levels.get("client"); got != slog.LevelDebug {
+		t.Fatalf("unexpected client level %v", got)
+	}
+	levels.set("", slog.LevelError)
+	if got := levels.get("adapter"); got != slog.LevelError {
+		t.Fatalf("unexpected default level %v", got)
+	}
+}
+
+func TestNewLoggingRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewLogging(LogConfig{Level: "info", Format: "xml"}); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
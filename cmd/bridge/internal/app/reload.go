@@ -0,0 +1,38 @@
+package app
+
+import "strings"
+
+// Reload applies the settings of cfg that can change without interrupting
+// clients or the adapter session: filters, log levels, the bitrate reported
+// to GVRET clients and client admission rules, which apply to new
+// connections. Changes to other settings are logged once and take
+// effect after a restart.
+func (b *Bridge) Reload(cfg Config) error {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	access, err := newAccessRules(cfg)
+	if err != nil {
+		return err
+	}
+	if err := b.logging.Configure(cfg.Log.Level, cfg.Log.ComponentLevels); err != nil {
+		return err
+	}
+
+	b.filters.Store(newFilterSet(cfg.Filters))
+	b.access.Store(access)
+	if old := b.bitrate.Swap(cfg.BusBitrate); old != cfg.BusBitrate {
+		b.stats.SetBitrate(cfg.BusBitrate)
+		b.logger.Info("bus bitrate changed", "old", old, "new", cfg.BusBitrate)
+	}
+
+	if fields := b.applied.restartRequired(cfg); len(fields) > 0 {
+		b.logger.Warn("configuration changes require a restart", "settings", strings.Join(fields, ","))
+	}
+	b.applied = cfg
+	b.logger.Info("configuration reloaded", "filters", len(cfg.Filters), "log_level", cfg.Log.Level)
+	return nil
+}
@@ -0,0 +1,500 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/canlog"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// Replay formats.
+const (
+	replayFormatCandump = "candump"
+	replayFormatASC     = "asc"
+	replayFormatTRC     = "trc"
+)
+
+// ReplayConfig replaces the adapter by a recorded trace, so that clients can
+// be served without hardware. Frames of all buses and both directions are
+// replayed as frames received on the single bus of the bridge.
+type ReplayConfig struct {
+	// File is the trace to replay; an empty value connects to the adapter.
+	File string `json:"file,omitempty"`
+	// Format is "candump", "asc" or "trc"; by default it follows the file
+	// extension, with candump for anything but ".asc" and ".trc".
+	Format string `json:"format,omitempty"`
+	// Speed scales the original timing; 2 replays twice as fast.
+	Speed float64 `json:"speed"`
+	// Loop restarts the replay after the last frame.
+	Loop bool `json:"loop,omitempty"`
+	// Start and End select a section of the trace as offsets from its first
+	// frame; a zero End replays to the end.
+	Start Duration `json:"start,omitempty"`
+	End   Duration `json:"end,omitempty"`
+}
+
+// format returns the configured or the derived trace format.
+func (r ReplayConfig) format() string {
+	if r.Format != "" {
+		return r.Format
+	}
+	switch strings.ToLower(filepath.Ext(r.File)) {
+	case ".asc":
+		return replayFormatASC
+	case ".trc":
+		return replayFormatTRC
+	}
+	return replayFormatCandump
+}
+
+// validate reports problems with the replay settings.
+func (r ReplayConfig) validate(add func(string, error)) {
+	switch r.Format {
+	case "", replayFormatCandump, replayFormatASC, replayFormatTRC:
+	default:
+		add("replay.format", fmt.Errorf("unknown replay format %q, expected candump, asc or trc", r.Format))
+	}
+	if r.Speed <= 0 {
+		add("replay.speed", errors.New("must be positive"))
+	}
+	if r.Start < 0 {
+		add("replay.start", errors.New("must not be negative"))
+	}
+	if r.End < 0 {
+		add("replay.end", errors.New("must not be negative"))
+	} else if r.End > 0 && r.End <= r.Start {
+		add("replay.end", errors.New("must be after replay.start"))
+	}
+}
+
+// replayWrapDelay is the pause before each further pass of a looping
+// replay. It keeps sections whose frames share one timestamp, or that are
+// played very fast, from being replayed in a busy loop.
+const replayWrapDelay = 10 * time.Millisecond
+
+// replayFrame is a frame of a replayed trace at its offset from the first
+// frame of the trace.
+type replayFrame struct {
+	offset time.Duration
+	frame  ebyte.Frame
+}
+
+// loadReplay reads the section of the trace selected by cfg into memory. It
+// also returns the time of the first frame of the trace, which offsets are
+// measured from.
+func loadReplay(cfg ReplayConfig) ([]replayFrame, time.Time, error) {
+	f, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("open replay: %w", err)
+	}
+	defer f.Close()
+
+	var r canlog.Reader
+	switch cfg.format() {
+	case replayFormatASC:
+		r = canlog.NewASCReader(f)
+	case replayFormatTRC:
+		r = canlog.NewTRCReader(f)
+	default:
+		r = canlog.NewCandumpReader(f)
+	}
+
+	var frames []replayFrame
+	var first time.Time
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("replay %s: %w", cfg.File, err)
+		}
+		if first.IsZero() {
+			first = rec.Time
+		}
+		offset := rec.Time.Sub(first)
+		if offset < time.Duration(cfg.Start) {
+			continue
+		}
+		if cfg.End > 0 && offset > time.Duration(cfg.End) {
+			break
+		}
+		frames = append(frames, replayFrame{offset: offset, frame: rec.Frame})
+	}
+	if len(frames) == 0 {
+		return nil, time.Time{}, fmt.Errorf("replay %s: no frames in the selected section", cfg.File)
+	}
+	return frames, first, nil
+}
+
+// Replay states reported by the admin API.
+const (
+	replayPlaying  = "playing"
+	replayPaused   = "paused"
+	replayFinished = "finished"
+)
+
+// replayer plays a loaded trace in place of the adapter connection. Its
+// position can be controlled through the admin API while it runs.
+type replayer struct {
+	b      *Bridge
+	file   string
+	frames []replayFrame
+	// origin is the time of the first frame of the trace.
+	origin time.Time
+	loop   bool
+	log    Logger
+	// wake tells run to reconsider the next frame after a change.
+	wake chan struct{}
+
+	// mu also serialises the delivery of frames, so that frames stepped
+	// through the API and those delivered by run stay in order.
+	mu     sync.Mutex
+	speed  float64
+	paused bool
+	// pos is the index of the next frame to deliver.
+	pos  int
+	pass int
+	// at is the trace offset at the wall clock time anchor; while playing,
+	// the position advances from there by the speed factor.
+	at       time.Duration
+	anchor   time.Time
+	finished bool
+	// jumped is set while the replay stands on the frame next moved to, so
+	// that repeated jumps move on.
+	jumped bool
+}
+
+// openReplay loads the configured trace; it returns nil if no replay is
+// configured.
+func (b *Bridge) openReplay() (*replayer, error) {
+	cfg := b.cfg.Replay
+	if cfg.File == "" {
+		return nil, nil
+	}
+	frames, origin, err := loadReplay(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayer{
+		b:      b,
+		file:   cfg.File,
+		frames: frames,
+		origin: origin,
+		loop:   cfg.Loop,
+		log:    b.adapterLog.With("replay", cfg.File),
+		wake:   make(chan struct{}, 1),
+		speed:  cfg.Speed,
+		pass:   1,
+		at:     frames[0].offset,
+	}
+	r.log.Info("replay loaded", "format", cfg.format(), "frames", len(frames),
+		"duration", frames[len(frames)-1].offset-frames[0].offset)
+	return r, nil
+}
+
+// run delivers the frames with their original timing, scaled by the speed
+// factor, until the context is cancelled. The replay stands in for a
+// connected adapter throughout, also while paused or after the last frame.
+func (r *replayer) run(ctx context.Context) error {
+	b := r.b
+	b.activeAdapter.Store("replay:" + r.file)
+	b.adapterConnected.Store(true)
+	b.adapterSessions.Add(1)
+	defer b.adapterConnected.Store(false)
+	b.notifyStatus("replaying %s", r.file)
+	b.notifyReady()
+
+	r.mu.Lock()
+	r.anchor = time.Now()
+	r.log.Info("replay started", "speed", r.speed, "loop", r.loop)
+	r.mu.Unlock()
+
+	txDone := make(chan struct{})
+	go func() {
+		defer close(txDone)
+		r.acceptTransmits(ctx)
+	}()
+	defer func() { <-txDone }()
+
+	timer := time.NewTimer(adapterReadTimeout)
+	defer timer.Stop()
+	for {
+		wait := r.advance(time.Now())
+		if wait == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		if wait < 0 {
+			// Nothing is due while paused or finished; keep the watchdog
+			// satisfied while waiting for the API.
+			wait = adapterReadTimeout
+		}
+		b.expectProgress(wait)
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// advance delivers the next frame if it is due and returns zero, or returns
+// the time until it is due; a negative result means that no frame is due
+// until the state changes.
+func (r *replayer) advance(now time.Time) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		return -1
+	}
+	if r.pos >= len(r.frames) {
+		if !r.loop {
+			if !r.finished {
+				r.finished = true
+				r.log.Info("replay finished")
+				r.b.notifyStatus("replay of %s finished", r.file)
+			}
+			return -1
+		}
+		r.pass++
+		r.log.Debug("replay restarting", "pass", r.pass)
+		r.moveLocked(0, r.frames[0].offset, now.Add(replayWrapDelay))
+	}
+	f := r.frames[r.pos]
+	if wait := r.anchor.Add(r.scaled(f.offset - r.at)).Sub(now); wait > 0 {
+		return wait
+	}
+	r.deliverLocked(now)
+	return 0
+}
+
+// scaled converts a span of trace time into wall clock time.
+func (r *replayer) scaled(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / r.speed)
+}
+
+// deliverLocked hands the frame at pos to the bridge and moves on.
+func (r *replayer) deliverLocked(now time.Time) {
+	f := r.frames[r.pos]
+	r.pos++
+	r.jumped = false
+	r.b.lastAdapterData.Store(now.UnixNano())
+	r.b.deliverFrame(f.frame, 0, now)
+}
+
+// positionLocked returns the current offset in the trace.
+func (r *replayer) positionLocked(now time.Time) time.Duration {
+	if r.paused || r.finished {
+		return r.at
+	}
+	// The anchor lies ahead while waiting to start another pass.
+	at := r.at + time.Duration(float64(max(now.Sub(r.anchor), 0))*r.speed)
+	if r.pos < len(r.frames) {
+		at = min(at, r.frames[r.pos].offset)
+	}
+	return at
+}
+
+// moveLocked places the replay before frame pos at the trace offset at.
+func (r *replayer) moveLocked(pos int, at time.Duration, now time.Time) {
+	r.pos = pos
+	r.at = at
+	r.anchor = now
+	r.finished = false
+	r.jumped = false
+}
+
+// notify wakes run after a change of the state.
+func (r *replayer) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// setPaused pauses or resumes the replay.
+func (r *replayer) setPaused(paused bool) {
+	r.mu.Lock()
+	now := time.Now()
+	if paused != r.paused {
+		r.at = r.positionLocked(now)
+		r.anchor = now
+		r.paused = paused
+		r.log.Info("replay paused", "paused", paused, "position", r.at)
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+// setSpeed changes the speed factor from the current position on.
+func (r *replayer) setSpeed(speed float64) error {
+	if speed <= 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return errors.New("speed must be positive")
+	}
+	r.mu.Lock()
+	now := time.Now()
+	r.at = r.positionLocked(now)
+	r.anchor = now
+	r.speed = speed
+	r.log.Info("replay speed changed", "speed", speed)
+	r.mu.Unlock()
+	r.notify()
+	return nil
+}
+
+// seek moves to the given offset from the first frame of the trace; the
+// next frame delivered is the first one at or after it.
+func (r *replayer) seek(offset time.Duration) error {
+	first, last := r.frames[0].offset, r.frames[len(r.frames)-1].offset
+	if offset < first || offset > last {
+		return fmt.Errorf("offset %s outside of the replayed section %s to %s", offset, first, last)
+	}
+	pos := sort.Search(len(r.frames), func(i int) bool { return r.frames[i].offset >= offset })
+	r.mu.Lock()
+	r.moveLocked(pos, offset, time.Now())
+	r.log.Info("replay seek", "position", offset, "frame", pos)
+	r.mu.Unlock()
+	r.notify()
+	return nil
+}
+
+// seekTime moves to a point given as a timestamp of the trace.
+func (r *replayer) seekTime(t time.Time) error {
+	return r.seek(t.Sub(r.origin))
+}
+
+// step pauses the replay and delivers the next count frames at once, or
+// fewer at the end of a replay that does not loop.
+func (r *replayer) step(count int) {
+	r.mu.Lock()
+	now := time.Now()
+	r.paused = true
+	delivered := 0
+	for ; delivered < count; delivered++ {
+		if r.pos >= len(r.frames) {
+			if !r.loop {
+				break
+			}
+			r.pass++
+			r.pos = 0
+		}
+		r.at = r.frames[r.pos].offset
+		r.deliverLocked(now)
+	}
+	r.anchor = now
+	r.finished = false
+	r.jumped = false
+	r.log.Info("replay stepped", "frames", delivered, "position", r.at)
+	r.mu.Unlock()
+	r.notify()
+}
+
+// next moves to the next frame matching f after the current position,
+// wrapping around when the replay loops. It reports whether such a frame was
+// found.
+func (r *replayer) next(f Filter) bool {
+	r.mu.Lock()
+	defer r.notify()
+	defer r.mu.Unlock()
+	n := len(r.frames)
+	start := 0
+	if r.jumped {
+		start = 1
+	}
+	limit := n - r.pos
+	if r.loop {
+		limit = n
+	}
+	for i := start; i < limit; i++ {
+		pos := r.pos + i
+		if pos >= n {
+			pos -= n
+		}
+		frame := r.frames[pos].frame
+		if !f.matches(frame) {
+			continue
+		}
+		if pos < r.pos {
+			r.pass++
+		}
+		r.moveLocked(pos, r.frames[pos].offset, time.Now())
+		r.jumped = true
+		r.log.Info("replay jumped to identifier", "frame_id", formatID(frame.ID, frame.Extended), "position", r.at, "frame", pos)
+		return true
+	}
+	return false
+}
+
+// replayStatus is the admin API representation of the replay state.
+type replayStatus struct {
+	File  string  `json:"file"`
+	State string  `json:"state"`
+	Speed float64 `json:"speed"`
+	Loop  bool    `json:"loop"`
+	Pass  int     `json:"pass"`
+	// Position is the offset from the first frame of the trace and Time
+	// the corresponding trace timestamp.
+	Position Duration  `json:"position"`
+	Time     time.Time `json:"time"`
+	// Frame is the index of the next frame within the replayed section.
+	Frame  int      `json:"frame"`
+	Frames int      `json:"frames"`
+	Start  Duration `json:"start"`
+	End    Duration `json:"end"`
+}
+
+// status reports the current state of the replay.
+func (r *replayer) status() replayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := replayPlaying
+	switch {
+	case r.paused:
+		state = replayPaused
+	case r.finished:
+		state = replayFinished
+	}
+	at := r.positionLocked(time.Now())
+	return replayStatus{
+		File:     r.file,
+		State:    state,
+		Speed:    r.speed,
+		Loop:     r.loop,
+		Pass:     r.pass,
+		Position: Duration(at),
+		Time:     r.origin.Add(at),
+		Frame:    r.pos,
+		Frames:   len(r.frames),
+		Start:    Duration(r.frames[0].offset),
+		End:      Duration(r.frames[len(r.frames)-1].offset),
+	}
+}
+
+// acceptTransmits takes the place of the adapter writer: client frames are
+// counted and traced as if they had been sent, but go nowhere.
+func (r *replayer) acceptTransmits(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tx := <-r.b.txCh:
+			r.b.observeTransmit(tx, time.Now())
+			r.log.Debug("transmit frame discarded during replay", "frame_id", formatID(tx.frame.ID, tx.frame.Extended))
+		}
+	}
+}
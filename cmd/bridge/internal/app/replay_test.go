@@ -0,0 +1,278 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+const replayLog = `(1000.000000) can0 100#01
+(1000.100000) can0 200#02
+(1000.200000) can1 18DAF110#R3
+(1000.300000) can0 300#03
+`
+
+func writeReplayFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadReplaySection(t *testing.T) {
+	cfg := ReplayConfig{
+		File:  writeReplayFile(t, "trace.log", replayLog),
+		Speed: 1,
+		Start: Duration(100 * time.Millisecond),
+		End:   Duration(200 * time.Millisecond),
+	}
+	frames, _, err := loadReplay(cfg)
+	if err != nil {
+		t.Fatalf("loadReplay returned error: %v", err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %+v", frames)
+	}
+	if frames[0].offset != 100*time.Millisecond || frames[0].frame.ID != 0x200 {
+		t.Fatalf("unexpected first frame %+v", frames[0])
+	}
+	if want := (ebyte.Frame{ID: 0x18DAF110, Extended: true, Remote: true, DLC: 3}); frames[1].frame != want {
+		t.Fatalf("unexpected second frame %+v", frames[1])
+	}
+
+	cfg.Start = Duration(time.Second)
+	cfg.End = 0
+	if _, _, err := loadReplay(cfg); err == nil || !strings.Contains(err.Error(), "no frames") {
+		t.Fatalf("expected error for an empty section, got %v", err)
+	}
+}
+
+func TestReplayConfigFormat(t *testing.T) {
+	for file, want := range map[string]string{"a.ASC": replayFormatASC, "b.trc": replayFormatTRC, "c.log": replayFormatCandump, "d": replayFormatCandump} {
+		if got := (ReplayConfig{File: file}).format(); got != want {
+			t.Fatalf("%s: expected format %s got %s", file, want, got)
+		}
+	}
+	if got := (ReplayConfig{File: "a.asc", Format: replayFormatCandump}).format(); got != replayFormatCandump {
+		t.Fatalf("explicit format ignored, got %s", got)
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	tracePath := filepath.Join(t.TempDir(), "out.log")
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.Replay = ReplayConfig{File: writeReplayFile(t, "trace.log", replayLog), Speed: 3}
+	b.cfg.Candump = CandumpConfig{File: tracePath}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	started := time.Now()
+	go func() { done <- b.Run(ctx) }()
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames == 4 })
+	// 300ms of trace at three times the speed
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Fatalf("replay finished after %v, expected original timing", elapsed)
+	}
+	if !b.adapterConnected.Load() {
+		t.Fatalf("replay should stand in for a connected adapter after the last frame")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var ids []string
+	for _, line := range lines {
+		ids = append(ids, strings.Fields(line)[2])
+	}
+	if got := strings.Join(ids, " "); got != "100#01 200#02 18DAF110#R3 300#03" {
+		t.Fatalf("unexpected replayed frames %s", got)
+	}
+}
+
+func TestRunReplayLoop(t *testing.T) {
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.Replay = ReplayConfig{File: writeReplayFile(t, "trace.log", replayLog), Speed: 100, Loop: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames > 8 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestRunReplayLoopWithoutDuration(t *testing.T) {
+	b := newTestBridge(t)
+	b.cfg.Replay = ReplayConfig{
+		File:  writeReplayFile(t, "trace.log", "(1000.000000) can0 100#01\n(1000.000000) can0 200#02\n"),
+		Speed: 1,
+		Loop:  true,
+	}
+	r, err := b.openReplay()
+	if err != nil {
+		t.Fatalf("openReplay returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- r.run(ctx) }()
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames > 4 })
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("run did not return after cancellation")
+	}
+	// Passes are spaced out instead of repeated in a busy loop.
+	if n := b.stats.Snapshot().Frames; n > 1000 {
+		t.Fatalf("%d frames replayed", n)
+	}
+}
+
+func TestAdminReplayControl(t *testing.T) {
+	b := newTestBridge(t)
+	b.cfg.Replay = ReplayConfig{File: writeReplayFile(t, "trace.log", replayLog), Speed: 1}
+	replay, err := b.openReplay()
+	if err != nil {
+		t.Fatalf("openReplay returned error: %v", err)
+	}
+	b.replay = replay
+	handler := b.adminHandler()
+
+	request := func(method, target string, wantCode int) replayStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		if rec.Code != wantCode {
+			t.Fatalf("%s %s: expected %d got %d: %s", method, target, wantCode, rec.Code, rec.Body.String())
+		}
+		var status replayStatus
+		if wantCode == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decode status: %v", err)
+			}
+		}
+		return status
+	}
+
+	// A frame the replay was moved onto without a jump is still found.
+	request("POST", "/replay/seek?to=0s", http.StatusOK)
+	status := request("POST", "/replay/next?id=0x100", http.StatusOK)
+	if status.Frame != 0 {
+		t.Fatalf("unexpected status after seek and next %+v", status)
+	}
+	at := time.Unix(1000, 100000000).UTC().Format(time.RFC3339Nano)
+	request("POST", "/replay/seek?to="+at, http.StatusOK)
+	if status := request("POST", "/replay/next?id=0x200", http.StatusOK); status.Frame != 1 {
+		t.Fatalf("unexpected status after seek to time and next %+v", status)
+	}
+	request("POST", "/replay/next?id=0x200", http.StatusNotFound)
+	request("POST", "/replay/seek?to=0s", http.StatusOK)
+
+	request("POST", "/replay/step?count=5", http.StatusBadRequest)
+	status = request("POST", "/replay/step?count=2", http.StatusOK)
+	if status.State != replayPaused || status.Frame != 2 || status.Position != Duration(100*time.Millisecond) {
+		t.Fatalf("unexpected status after step %+v", status)
+	}
+	if n := b.stats.Snapshot().Frames; n != 2 {
+		t.Fatalf("expected 2 delivered frames, got %d", n)
+	}
+
+	status = request("POST", "/replay/next?id=0x300", http.StatusOK)
+	if status.Frame != 3 || status.Position != Duration(300*time.Millisecond) {
+		t.Fatalf("unexpected status after next %+v", status)
+	}
+	request("POST", "/replay/next?id=0x300", http.StatusNotFound)
+
+	status = request("POST", "/replay/seek?to=150ms", http.StatusOK)
+	if status.Frame != 2 || status.Position != Duration(150*time.Millisecond) {
+		t.Fatalf("unexpected status after seek %+v", status)
+	}
+	status = request("POST", "/replay/seek?to="+at, http.StatusOK)
+	if status.Frame != 1 || !status.Time.Equal(time.Unix(1000, 100000000)) {
+		t.Fatalf("unexpected status after seek to time %+v", status)
+	}
+	request("POST", "/replay/seek?to=1h", http.StatusBadRequest)
+
+	request("POST", "/replay/next?id=0x18DAF110&extended=false", http.StatusNotFound)
+	request("POST", "/replay/next?id=0x18DAF110&extended=maybe", http.StatusBadRequest)
+	status = request("POST", "/replay/next?id=0x18DAF110&extended=true", http.StatusOK)
+	if status.Frame != 2 {
+		t.Fatalf("unexpected status after next extended frame %+v", status)
+	}
+
+	request("PUT", "/replay/speed?factor=0", http.StatusBadRequest)
+	request("PUT", "/replay/speed?factor=2.5", http.StatusOK)
+	status = request("POST", "/replay/resume", http.StatusOK)
+	if status.State != replayPlaying || status.Speed != 2.5 {
+		t.Fatalf("unexpected status after resume %+v", status)
+	}
+
+	if info := b.status(); info.Replay == nil || info.Replay.Frames != 4 {
+		t.Fatalf("status lacks the replay position: %+v", info.Replay)
+	}
+
+	// The frame after a step is found even if it shares the timestamp of
+	// the stepped one.
+	b.cfg.Replay.File = writeReplayFile(t, "same.log", "(1000.000000) can0 100#01\n(1000.000000) can0 200#02\n")
+	if b.replay, err = b.openReplay(); err != nil {
+		t.Fatalf("openReplay returned error: %v", err)
+	}
+	handler = b.adminHandler()
+	request("POST", "/replay/step", http.StatusOK)
+	if status := request("POST", "/replay/next?id=0x200", http.StatusOK); status.Frame != 1 {
+		t.Fatalf("unexpected status after step and next %+v", status)
+	}
+}
+
+func TestAdminReplayWithoutReplay(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestBridge(t).adminHandler().ServeHTTP(rec, httptest.NewRequest("POST", "/replay/pause", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestRunReplaySpeedChange(t *testing.T) {
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = freeAddress(t)
+	// At this speed the second frame would be due after almost three hours.
+	b.cfg.Replay = ReplayConfig{File: writeReplayFile(t, "trace.log", replayLog), Speed: 0.00001}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames == 1 })
+	if err := b.replay.setSpeed(1000); err != nil {
+		t.Fatalf("setSpeed returned error: %v", err)
+	}
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames == 4 })
+	waitFor(t, func() bool { return b.replay.status().State == replayFinished })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
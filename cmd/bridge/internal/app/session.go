@@ -0,0 +1,104 @@
+package app
+
+import (
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// Protocols spoken by client listeners.
+const (
+	protocolGVRET      = "gvret"
+	protocolSLCAN      = "slcan"
+	protocolSocketCAND = "socketcand"
+)
+
+// session implements the protocol a client speaks on top of the connection
+// handling shared by all clients.
+type session interface {
+	// receive processes bytes read from the client.
+	receive(data []byte)
+	// encodeFrame renders an adapter frame received on bus at the given
+	// time for the client, or returns nil if the client does not want
+	// frames now.
+	encodeFrame(frame ebyte.Frame, bus uint8, at time.Time) []byte
+}
+
+// sessionStopper is implemented by sessions that run goroutines of their
+// own. The client handler stops them before it returns.
+type sessionStopper interface {
+	stop()
+}
+
+// newSession creates the session for a client of the given protocol.
+func (b *Bridge) newSession(protocol string, c *client) session {
+	switch protocol {
+	case protocolSLCAN:
+		return &slcanSession{b: b, c: c}
+	case protocolSocketCAND:
+		return newSocketCANDSession(b, c)
+	default:
+		return newGVRETSession(b, c)
+	}
+}
+
+// gvretSession speaks the GVRET binary protocol used by SavvyCAN. It acts
+// as the gvret.Device of its protocol session.
+type gvretSession struct {
+	b       *Bridge
+	c       *client
+	session *gvret.Session
+}
+
+func newGVRETSession(b *Bridge, c *client) *gvretSession {
+	s := &gvretSession{b: b, c: c}
+	s.session = gvret.NewSession(s)
+	return s
+}
+
+func (s *gvretSession) receive(data []byte) {
+	binary := s.session.Binary()
+	s.session.Receive(data)
+	if !binary && s.session.Binary() {
+		s.c.log.Debug("client switched to GVRET binary mode")
+	}
+}
+
+func (s *gvretSession) encodeFrame(frame ebyte.Frame, bus uint8, at time.Time) []byte {
+	data, err := gvret.EncodeFrame(toGVRET(frame, bus, s.b.gvretTimestamp(at)))
+	if err != nil {
+		s.c.log.Warn("unable to encode GVRET frame", "frame_id", formatID(frame.ID, frame.Extended), "error", err)
+		return nil
+	}
+	return data
+}
+
+// Transmit queues a frame sent by the client for the adapter.
+func (s *gvretSession) Transmit(f gvret.Frame) {
+	s.b.transmit(s.c, fromGVRET(f), f.Bus)
+}
+
+// Reply sends the answer to a query ahead of queued frames.
+func (s *gvretSession) Reply(data []byte) {
+	s.c.enqueuePriority(data)
+}
+
+func (s *gvretSession) Timestamp() uint32 {
+	return s.b.gvretTimestamp(time.Now())
+}
+
+// Buses reports the buses of an upstream GVRET device, or else the
+// adapter's single bus at the configured bitrate.
+func (s *gvretSession) Buses() []gvret.BusInfo {
+	if buses := s.b.deviceBuses.Load(); buses != nil {
+		return *buses
+	}
+	return []gvret.BusInfo{{Enabled: true, Bitrate: s.b.bitrate.Load()}}
+}
+
+// gvretTimestamp returns the time elapsed between the bridge start and at
+// in microseconds, matching GVRET's expectation.
+func (b *Bridge) gvretTimestamp(at time.Time) uint32 {
+	return uint32(at.Sub(b.start) / time.Microsecond)
+}
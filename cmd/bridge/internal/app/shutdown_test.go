@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestGVRETSessionTransmit(t *testing.T) {
+	b := newTestBridge(t)
+	b.adapterConnected.Store(true)
+	server, peer := net.Pipe()
+	defer peer.Close()
+	c := newClient(1, server, b.clientLog)
+
+	s := b.newSession(protocolGVRET, c)
+	s.receive([]byte{
+		0xE7, 0xE7,
+		0xF1, 0x00, 0x23, 0x01, 0x00, 0x00, 0x00, 0x02, 0xAA, 0xBB, 0x00,
+		0xF1, 0x00, 0x78, 0x56, 0x34, 0x92, 0x00, 0x00, 0x00,
+	})
+
+	first := (<-b.txCh).frame
+	if first.ID != 0x123 || first.Extended || first.DLC != 2 || first.Data[0] != 0xAA || first.Data[1] != 0xBB {
+		t.Fatalf("unexpected first frame %+v", first)
+	}
+	second := (<-b.txCh).frame
+	if second.ID != 0x12345678 || !second.Extended || second.DLC != 0 {
+		t.Fatalf("unexpected second frame %+v", second)
+	}
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	received := make(chan []byte, 1)
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		buf := make([]byte, ebyte.FrameSize)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			received <- buf
+		}
+		// Keep the connection open until the bridge closes it.
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = freeAddress(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	waitFor(t, b.adapterConnected.Load)
+	var conn net.Conn
+	waitFor(t, func() bool {
+		var err error
+		conn, err = net.Dial("tcp", b.cfg.ListenAddress)
+		return err == nil
+	})
+	defer conn.Close()
+
+	frame := []byte{0xE7, 0xE7, 0xF1, 0x00, 0x21, 0x03, 0x00, 0x00, 0x00, 0x01, 0x5A, 0x00}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+	waitFor(t, func() bool {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		return len(b.clients) == 1
+	})
+
+	select {
+	case raw := <-received:
+		parsed, err := ebyte.ParseFrame(raw)
+		if err != nil || parsed.ID != 0x321 || parsed.Data[0] != 0x5A {
+			t.Fatalf("adapter received unexpected frame %+v (%v)", parsed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("adapter did not receive the transmitted frame")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Run did not return after cancellation")
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Fatalf("expected the bridge to close the client connection cleanly, got %v", err)
+	}
+}
+
+func TestRunFlushesPendingTransmits(t *testing.T) {
+	// The adapter does not read until the bridge shuts down, so that the
+	// writer blocks and frames stay queued.
+	release := make(chan struct{})
+	received := make(chan int64, 1)
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		<-release
+		n, _ := io.Copy(io.Discard, conn)
+		received <- n
+	})
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = freeAddress(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	waitFor(t, b.adapterConnected.Load)
+
+	queued := 0
+	tx := txFrame{frame: ebyte.Frame{ID: 0x123, DLC: 8}}
+	for stalled := time.Now(); time.Since(stalled) < 100*time.Millisecond; {
+		select {
+		case b.txCh <- tx:
+			queued++
+			stalled = time.Now()
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if len(b.txCh) == 0 {
+		t.Fatalf("no frames queued")
+	}
+
+	cancel()
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Run did not return after cancellation")
+	}
+	if n := <-received; n != int64(queued*ebyte.FrameSize) {
+		t.Fatalf("adapter received %d frames, want %d", n/ebyte.FrameSize, queued)
+	}
+}
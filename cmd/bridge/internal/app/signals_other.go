@@ -0,0 +1,8 @@
+//go:build !unix
+
+package app
+
+import "context"
+
+// watchLevelSignals is a no-op on platforms without SIGUSR1/SIGUSR2.
+func (b *Bridge) watchLevelSignals(ctx context.Context) {}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchLevelSignals makes logging more verbose on SIGUSR1 and quieter on
+// SIGUSR2 until the context is cancelled.
+func (b *Bridge) watchLevelSignals(ctx context.Context) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			if sig == syscall.SIGUSR1 {
+				b.logging.ShiftLevels(-1)
+			} else {
+				b.logging.ShiftLevels(1)
+			}
+			b.logger.Warn("log levels changed by signal", "signal", sig.String(), "levels", b.logging.Levels())
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/slcan"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// slcanMaxLine bounds a single SLCAN command; the longest valid command is
+// an extended data frame of 27 characters.
+const slcanMaxLine = 64
+
+// SLCAN replies: carriage return acknowledges a command, BEL rejects it.
+const (
+	slcanOK    = "\r"
+	slcanError = "\a"
+)
+
+// slcanSession speaks the Lawicel SLCAN ASCII protocol. The channel state is
+// read by broadcastFrame and therefore kept in atomics.
+type slcanSession struct {
+	b    *Bridge
+	c    *client
+	line []byte
+
+	// discard is set when a command exceeded slcanMaxLine; the rest of it
+	// is dropped up to the next carriage return.
+	discard bool
+
+	open       atomic.Bool
+	listenOnly atomic.Bool
+	timestamps atomic.Bool
+}
+
+func (s *slcanSession) receive(data []byte) {
+	for _, by := range data {
+		switch by {
+		case '\r':
+			if s.discard {
+				s.discard = false
+				s.reply(slcanError)
+			} else if len(s.line) > 0 {
+				s.handle(string(s.line))
+			}
+			s.line = s.line[:0]
+		case '\n':
+			// tolerate CRLF line endings
+		default:
+			if len(s.line) >= slcanMaxLine {
+				s.discard = true
+				s.line = s.line[:0]
+			}
+			if !s.discard {
+				s.line = append(s.line, by)
+			}
+		}
+	}
+}
+
+// handle executes one command and sends the reply.
+func (s *slcanSession) handle(line string) {
+	cmd := slcan.ParseCommand(line)
+	switch cmd.Type {
+	case slcan.CommandOpen, slcan.CommandListenOnly:
+		if s.open.Load() || len(line) != 1 {
+			s.reply(slcanError)
+			return
+		}
+		s.listenOnly.Store(cmd.Type == slcan.CommandListenOnly)
+		s.open.Store(true)
+		s.c.log.Debug("SLCAN channel opened", "listen_only", s.listenOnly.Load())
+		s.reply(slcanOK)
+	case slcan.CommandClose:
+		if !s.open.Load() {
+			s.reply(slcanError)
+			return
+		}
+		s.open.Store(false)
+		s.c.log.Debug("SLCAN channel closed")
+		s.reply(slcanOK)
+	case slcan.CommandBitrate, slcan.CommandBitTiming:
+		// The bus bitrate is set on the adapter; accept the command so that
+		// clients configuring it before opening the channel keep working.
+		if s.open.Load() || (cmd.Type == slcan.CommandBitrate && (len(line) != 2 || line[1] < '0' || line[1] > '8')) {
+			s.reply(slcanError)
+			return
+		}
+		s.c.log.Debug("ignoring SLCAN bitrate command", "command", line)
+		s.reply(slcanOK)
+	case slcan.CommandTransmit:
+		if !s.open.Load() || s.listenOnly.Load() {
+			s.reply(slcanError)
+			return
+		}
+		frame, _ := slcan.DecodeFrame(line)
+		s.b.transmit(s.c, frame, 0)
+		if frame.Extended {
+			s.reply("Z\r")
+		} else {
+			s.reply("z\r")
+		}
+	case slcan.CommandVersion:
+		s.reply(line[:1] + "0100\r")
+	case slcan.CommandSerial:
+		s.reply("NEB01\r")
+	case slcan.CommandStatus:
+		if !s.open.Load() {
+			s.reply(slcanError)
+			return
+		}
+		s.reply("F00\r")
+	case slcan.CommandTimestamp:
+		if s.open.Load() || (line != "Z0" && line != "Z1") {
+			s.reply(slcanError)
+			return
+		}
+		s.timestamps.Store(line == "Z1")
+		s.reply(slcanOK)
+	default:
+		s.c.log.Debug("unknown SLCAN command", "command", line)
+		s.reply(slcanError)
+	}
+}
+
+func (s *slcanSession) reply(msg string) {
+	s.c.enqueuePriority([]byte(msg))
+}
+
+// encodeFrame renders frames of all buses alike, as SLCAN has a single
+// channel.
+func (s *slcanSession) encodeFrame(frame ebyte.Frame, _ uint8, at time.Time) []byte {
+	if !s.open.Load() {
+		return nil
+	}
+	if s.timestamps.Load() {
+		// SLCAN timestamps count milliseconds and wrap after a minute.
+		millis := uint16(at.Sub(s.b.start).Milliseconds() % 60000)
+		return []byte(slcan.EncodeFrameTimestamp(frame, millis))
+	}
+	return []byte(slcan.EncodeFrame(frame))
+}
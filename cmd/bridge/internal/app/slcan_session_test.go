@@ -0,0 +1,55 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestSLCANSession(t *testing.T) {
+	b := newTestBridge(t)
+	b.adapterConnected.Store(true)
+	server, peer := net.Pipe()
+	defer peer.Close()
+	c := newClient(1, server, b.clientLog)
+	s := b.newSession(protocolSLCAN, c)
+
+	reply := func(input, want string) {
+		t.Helper()
+		s.receive([]byte(input))
+		got := string(<-c.sendCh)
+		if got != want {
+			t.Fatalf("reply to %q: expected %q got %q", input, want, got)
+		}
+	}
+
+	frame := ebyte.Frame{ID: 0x123, DLC: 1, Data: [8]byte{0x42}}
+	if data := s.encodeFrame(frame, 0, time.Now()); data != nil {
+		t.Fatalf("closed channel must not receive frames, got %q", data)
+	}
+
+	reply("t1230\r", slcanError)
+	reply("S6\r", slcanOK)
+	reply("Z1\r", slcanOK)
+	reply("O\r", slcanOK)
+	reply("O\r", slcanError)
+	reply("V\r", "V0100\r")
+	reply("T1234567821122\r", "Z\r")
+	reply("X\r", slcanError)
+
+	sent := (<-b.txCh).frame
+	if sent.ID != 0x12345678 || !sent.Extended || sent.DLC != 2 || sent.Data[0] != 0x11 {
+		t.Fatalf("unexpected transmitted frame %+v", sent)
+	}
+
+	data := s.encodeFrame(frame, 0, b.start.Add(1500*time.Millisecond))
+	if got, want := string(data), "t12314205DC\r"; got != want {
+		t.Fatalf("expected %q got %q", want, got)
+	}
+
+	reply("C\r", slcanOK)
+	reply("L\r", slcanOK)
+	reply("t1230\r", slcanError)
+}
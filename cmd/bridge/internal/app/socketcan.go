@@ -0,0 +1,244 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/socketcan"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// SocketCANConfig configures the socketcan backend and the mirror. Both need
+// Linux and raw AF_CAN sockets.
+type SocketCANConfig struct {
+	// Interface is read and written by the socketcan backend, e.g. can0.
+	Interface string `json:"interface,omitempty"`
+	// Mirror receives every adapter frame and every frame sent to the
+	// adapter, e.g. vcan0 for can-utils, Wireshark or python-can.
+	Mirror string `json:"mirror,omitempty"`
+	// MirrorTX forwards frames that other programs send on Mirror to the
+	// adapter.
+	MirrorTX bool `json:"mirror_tx,omitempty"`
+}
+
+// validate reports problems with the settings; backend tells whether the
+// socketcan backend is selected.
+func (c SocketCANConfig) validate(backend bool, add func(string, error)) {
+	if backend || c.Interface != "" {
+		add("socketcan.interface", validateInterfaceName(c.Interface))
+	}
+	if c.Mirror != "" {
+		add("socketcan.mirror", validateInterfaceName(c.Mirror))
+		if backend && c.Mirror == c.Interface {
+			add("socketcan.mirror", errors.New("must differ from the backend interface"))
+		}
+	} else if c.MirrorTX {
+		add("socketcan.mirror_tx", errors.New("requires socketcan.mirror"))
+	}
+}
+
+// validateInterfaceName checks a Linux network interface name.
+func validateInterfaceName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("must not be empty")
+	case len(name) > 15:
+		return fmt.Errorf("interface name %q longer than 15 characters", name)
+	case strings.ContainsAny(name, "/: \t\r\n"):
+		return fmt.Errorf("invalid interface name %q", name)
+	}
+	return nil
+}
+
+// canSocket is a raw CAN socket bound to an interface.
+type canSocket interface {
+	ReadFrame() (ebyte.Frame, error)
+	WriteFrame(f ebyte.Frame) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// openSocketCAN binds a raw CAN socket to an interface; tests replace it.
+var openSocketCAN = func(iface string) (canSocket, error) {
+	return socketcan.Open(iface)
+}
+
+// serveSocketCAN runs a session on a SocketCAN interface such as can0 and
+// passes frames in both directions until an error occurs, e.g. when the
+// interface goes down. The returned flag reports whether the socket could be
+// opened.
+func (b *Bridge) serveSocketCAN(ctx context.Context, iface string, log Logger) (bool, error) {
+	sock, err := openSocketCAN(iface)
+	if err != nil {
+		return false, err
+	}
+	b.adapterUp(iface, iface, log)
+
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		b.adapterWriter(ctx, sock, log, stopWriter, func(tx txFrame) error {
+			if err := sock.WriteFrame(tx.frame); err != nil {
+				return err
+			}
+			// The interface is a single bus.
+			tx.bus = 0
+			b.observeTransmit(tx, time.Now())
+			return nil
+		})
+	}()
+
+	stop := context.AfterFunc(ctx, func() { _ = sock.SetReadDeadline(time.Now()) })
+	defer func() {
+		stop()
+		b.adapterConnected.Store(false)
+		close(stopWriter)
+		<-writerDone
+		_ = sock.Close()
+		log.Info("disconnected from adapter")
+	}()
+
+	idleTimeout := time.Duration(b.cfg.AdapterIdleTimeout)
+	lastData := time.Now()
+	for {
+		// Arm the deadline before checking for cancellation so that it
+		// cannot replace the one set when the session ended.
+		deadline := b.readDeadline(lastData)
+		_ = sock.SetReadDeadline(deadline)
+		if ctx.Err() != nil {
+			return true, ctx.Err()
+		}
+		b.expectProgress(time.Until(deadline))
+		frame, err := sock.ReadFrame()
+		switch {
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			if idleTimeout > 0 && time.Since(lastData) >= idleTimeout {
+				if b.handleSilence(ctx, log, nil, time.Since(lastData)) {
+					lastData = time.Now()
+					continue
+				}
+				return true, errLinkSilent
+			}
+			continue
+		case errors.Is(err, socketcan.ErrErrorFrame):
+			continue
+		case err != nil:
+			return true, fmt.Errorf("socketcan read: %w", err)
+		}
+		lastData = time.Now()
+		b.lastAdapterData.Store(lastData.UnixNano())
+		b.deliverFrame(frame, 0, lastData)
+	}
+}
+
+// canMirror copies frames to a SocketCAN interface from its own goroutine
+// and optionally forwards frames other programs send there to the adapter.
+type canMirror struct {
+	b       *Bridge
+	sock    canSocket
+	ch      chan ebyte.Frame
+	done    chan struct{}
+	rxDone  chan struct{}
+	dropped atomic.Uint64
+	log     Logger
+}
+
+// openMirror opens the configured mirror interface and starts its
+// goroutines.
+func (b *Bridge) openMirror() (*canMirror, error) {
+	cfg := b.cfg.SocketCAN
+	sock, err := openSocketCAN(cfg.Mirror)
+	if err != nil {
+		return nil, err
+	}
+	m := &canMirror{
+		b:      b,
+		sock:   sock,
+		ch:     make(chan ebyte.Frame, traceQueueSize),
+		done:   make(chan struct{}),
+		rxDone: make(chan struct{}),
+		log:    b.traceLog.With("mirror", cfg.Mirror),
+	}
+	go m.run()
+	if cfg.MirrorTX {
+		go m.receive()
+	} else {
+		close(m.rxDone)
+	}
+	m.log.Info("SocketCAN mirror started", "interface", cfg.Mirror, "mirror_tx", cfg.MirrorTX)
+	return m, nil
+}
+
+// run writes queued frames until the mirror is closed.
+func (m *canMirror) run() {
+	defer close(m.done)
+	failing := false
+	for frame := range m.ch {
+		err := m.sock.WriteFrame(frame)
+		switch {
+		case err != nil && !failing:
+			m.log.Error("mirror write failed", "error", err)
+			failing = true
+		case err == nil && failing:
+			m.log.Info("mirror write recovered")
+			failing = false
+		}
+	}
+}
+
+// send queues a frame without blocking.
+func (m *canMirror) send(frame ebyte.Frame) {
+	select {
+	case m.ch <- frame:
+	default:
+		if m.dropped.Add(1) == 1 {
+			m.log.Warn("mirror queue full, dropping frames")
+		}
+	}
+}
+
+// receive forwards frames sent on the mirror interface to the adapter until
+// the socket is closed.
+func (m *canMirror) receive() {
+	defer close(m.rxDone)
+	for {
+		frame, err := m.sock.ReadFrame()
+		if errors.Is(err, socketcan.ErrErrorFrame) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if !m.b.adapterConnected.Load() {
+			m.log.Debug("dropping mirror frame, adapter not connected", "frame_id", formatID(frame.ID, frame.Extended))
+			continue
+		}
+		select {
+		case m.b.txCh <- txFrame{frame: frame, mirrored: true}:
+		default:
+			m.log.Warn("transmit queue full, dropping mirror frame", "frame_id", formatID(frame.ID, frame.Extended))
+		}
+	}
+}
+
+// close writes the remaining frames and closes the socket.
+func (m *canMirror) close() error {
+	close(m.ch)
+	<-m.done
+	if n := m.dropped.Load(); n > 0 {
+		m.log.Warn("mirror frames dropped", "dropped", n)
+	}
+	err := m.sock.Close()
+	<-m.rxDone
+	if err != nil {
+		return fmt.Errorf("mirror %s: %w", m.b.cfg.SocketCAN.Mirror, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// fakeCANBus connects in-memory sockets like a SocketCAN interface: a frame
+// written on one socket is received by all others.
+type fakeCANBus struct {
+	mu      sync.Mutex
+	sockets []*fakeCANSocket
+}
+
+func (bus *fakeCANBus) open() *fakeCANSocket {
+	s := &fakeCANSocket{
+		bus:    bus,
+		rx:     make(chan ebyte.Frame, 64),
+		closed: make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+	}
+	bus.mu.Lock()
+	bus.sockets = append(bus.sockets, s)
+	bus.mu.Unlock()
+	return s
+}
+
+type fakeCANSocket struct {
+	bus       *fakeCANBus
+	rx        chan ebyte.Frame
+	closed    chan struct{}
+	closeOnce sync.Once
+	wake      chan struct{}
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (s *fakeCANSocket) ReadFrame() (ebyte.Frame, error) {
+	for {
+		s.mu.Lock()
+		deadline := s.deadline
+		s.mu.Unlock()
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case f := <-s.rx:
+			return f, nil
+		case <-s.closed:
+			return ebyte.Frame{}, net.ErrClosed
+		case <-expired:
+			return ebyte.Frame{}, os.ErrDeadlineExceeded
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *fakeCANSocket) WriteFrame(f ebyte.Frame) error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	for _, other := range s.bus.sockets {
+		if other != s {
+			other.rx <- f
+		}
+	}
+	return nil
+}
+
+func (s *fakeCANSocket) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.deadline = t
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *fakeCANSocket) SetWriteDeadline(time.Time) error { return nil }
+
+func (s *fakeCANSocket) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
+
+// fakeSocketCAN replaces openSocketCAN with in-memory interfaces for the
+// test and returns a function that opens a socket for another program.
+func fakeSocketCAN(t *testing.T) func(iface string) *fakeCANSocket {
+	t.Helper()
+	var mu sync.Mutex
+	buses := make(map[string]*fakeCANBus)
+	bus := func(iface string) *fakeCANBus {
+		mu.Lock()
+		defer mu.Unlock()
+		if buses[iface] == nil {
+			buses[iface] = &fakeCANBus{}
+		}
+		return buses[iface]
+	}
+	orig := openSocketCAN
+	t.Cleanup(func() { openSocketCAN = orig })
+	openSocketCAN = func(iface string) (canSocket, error) { return bus(iface).open(), nil }
+	return func(iface string) *fakeCANSocket { return bus(iface).open() }
+}
+
+func readCANFrame(t *testing.T, s *fakeCANSocket) ebyte.Frame {
+	t.Helper()
+	_ = s.SetReadDeadline(time.Now().Add(5 * time.Second))
+	f, err := s.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	return f
+}
+
+func TestRunSocketCANBackend(t *testing.T) {
+	open := fakeSocketCAN(t)
+	peer := open("can0")
+
+	b := newTestBridge(t)
+	b.cfg.Backend = backendSocketCAN
+	b.cfg.SocketCAN.Interface = "can0"
+	b.cfg.ListenAddress = freeAddress(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}()
+	waitFor(t, b.adapterConnected.Load)
+
+	queryCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	c, err := gvret.Dial(queryCtx, b.cfg.ListenAddress)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	onBus := ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}}
+	if err := peer.WriteFrame(onBus); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	got, err := c.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if fromGVRET(got) != onBus {
+		t.Fatalf("client received %+v, want %+v", got, onBus)
+	}
+
+	sent := gvret.Frame{ID: 0x18DAF110, Extended: true, DLC: 1, Data: [8]byte{9}}
+	if err := c.Send(sent); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if f := readCANFrame(t, peer); f != fromGVRET(sent) {
+		t.Fatalf("interface received %+v, want %+v", f, fromGVRET(sent))
+	}
+	if s := b.status(); s.Adapter != "can0" {
+		t.Fatalf("expected can0 as active adapter, got %q", s.Adapter)
+	}
+}
+
+func TestRunSocketCANMirror(t *testing.T) {
+	open := fakeSocketCAN(t)
+	peer := open("vcan0")
+
+	fromAdapter := ebyte.Frame{ID: 0x7E8, DLC: 2, Data: [8]byte{0x41, 0x0C}}
+	transmitted := make(chan []byte, 1)
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		raw, _ := ebyte.SerializeFrame(fromAdapter)
+		_, _ = conn.Write(raw)
+		buf := make([]byte, ebyte.FrameSize)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			transmitted <- buf
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.SocketCAN = SocketCANConfig{Mirror: "vcan0", MirrorTX: true}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}()
+
+	if f := readCANFrame(t, peer); f != fromAdapter {
+		t.Fatalf("mirror received %+v, want %+v", f, fromAdapter)
+	}
+
+	// A frame sent on the mirror interface goes to the adapter but is not
+	// mirrored back.
+	fromPeer := ebyte.Frame{ID: 0x7DF, DLC: 3, Data: [8]byte{0x02, 0x01, 0x0C}}
+	if err := peer.WriteFrame(fromPeer); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	select {
+	case raw := <-transmitted:
+		if f, err := ebyte.ParseFrame(raw); err != nil || f != fromPeer {
+			t.Fatalf("adapter received %+v (%v), want %+v", f, err, fromPeer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("mirror frame did not reach the adapter")
+	}
+	_ = peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if f, err := peer.ReadFrame(); err == nil {
+		t.Fatalf("frame from the mirror was mirrored back: %+v", f)
+	}
+}
@@ -0,0 +1,408 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// socketcandMaxElement bounds a single socketcand element; the longest
+// supported command is a BCM add of an extended frame with eight data bytes.
+const socketcandMaxElement = 128
+
+// socketcand session modes. A session starts without a bus and enters BCM
+// mode when the client opens one.
+const (
+	socketcandModeNone int32 = iota
+	socketcandModeBCM
+	socketcandModeRaw
+)
+
+// socketcandJobKey identifies a BCM job or subscription by frame identifier.
+type socketcandJobKey struct {
+	id       uint32
+	extended bool
+}
+
+// socketcandJob is a cyclic transmission added in BCM mode. Its frame is
+// replaced by update commands while the job runs.
+type socketcandJob struct {
+	mu    sync.Mutex
+	frame ebyte.Frame
+	stop  chan struct{}
+}
+
+// socketcandSubscription forwards frames of one identifier in BCM mode, at
+// most one per interval if the interval is set.
+type socketcandSubscription struct {
+	interval time.Duration
+	last     time.Time
+}
+
+// socketcandSession speaks the ASCII protocol of socketcand, which exposes
+// the bridge buses as can0, can1 and so on. State read by broadcastFrame is
+// kept in atomics or guarded by mu.
+type socketcandSession struct {
+	b       *Bridge
+	c       *client
+	element []byte
+	// inElement is set between the opening '<' and the closing '>'.
+	inElement bool
+	// discard is set when an element exceeded socketcandMaxElement; the rest
+	// of it is dropped up to the closing '>'.
+	discard bool
+
+	mode atomic.Int32
+	bus  atomic.Uint32
+
+	// jobs is only used by the reading goroutine; jobsDone tracks the
+	// goroutines running them.
+	jobs     map[socketcandJobKey]*socketcandJob
+	jobsDone sync.WaitGroup
+
+	mu            sync.Mutex
+	subscriptions map[socketcandJobKey]*socketcandSubscription
+}
+
+// newSocketCANDSession greets the client, which waits for the greeting
+// before it opens a bus.
+func newSocketCANDSession(b *Bridge, c *client) *socketcandSession {
+	s := &socketcandSession{
+		b:             b,
+		c:             c,
+		jobs:          make(map[socketcandJobKey]*socketcandJob),
+		subscriptions: make(map[socketcandJobKey]*socketcandSubscription),
+	}
+	s.reply("< hi >")
+	return s
+}
+
+func (s *socketcandSession) receive(data []byte) {
+	for _, by := range data {
+		switch {
+		case !s.inElement:
+			// whitespace and stray bytes between elements are ignored
+			if by == '<' {
+				s.inElement = true
+			}
+		case by == '>':
+			if s.discard {
+				s.discard = false
+				s.fail("command too long")
+			} else {
+				s.handle(strings.Fields(string(s.element)))
+			}
+			s.element = s.element[:0]
+			s.inElement = false
+		default:
+			if len(s.element) >= socketcandMaxElement {
+				s.discard = true
+				s.element = s.element[:0]
+			}
+			if !s.discard {
+				s.element = append(s.element, by)
+			}
+		}
+	}
+}
+
+// handle executes one command. Mode changes and opening a bus are
+// acknowledged; like socketcand, successful BCM commands are not.
+func (s *socketcandSession) handle(args []string) {
+	if len(args) == 0 {
+		s.fail("empty command")
+		return
+	}
+	mode := s.mode.Load()
+	if mode == socketcandModeNone && args[0] != "open" && args[0] != "echo" {
+		s.fail("no bus opened")
+		return
+	}
+	switch args[0] {
+	case "open":
+		s.open(args[1:])
+	case "echo":
+		s.reply("< echo >")
+	case "rawmode":
+		s.mode.Store(socketcandModeRaw)
+		s.c.log.Debug("socketcand client switched to raw mode")
+		s.reply("< ok >")
+	case "bcmmode":
+		s.mode.Store(socketcandModeBCM)
+		s.c.log.Debug("socketcand client switched to BCM mode")
+		s.reply("< ok >")
+	case "send":
+		frame, err := parseSocketCANDFrame(args[1:])
+		if err != nil {
+			s.fail(err.Error())
+			return
+		}
+		s.b.transmit(s.c, frame, uint8(s.bus.Load()))
+	case "add", "update", "delete", "subscribe", "unsubscribe":
+		if mode != socketcandModeBCM {
+			s.fail("command only valid in BCM mode")
+			return
+		}
+		if err := s.handleBCM(args[0], args[1:]); err != nil {
+			s.fail(err.Error())
+		}
+	default:
+		s.c.log.Debug("unsupported socketcand command", "command", args[0])
+		s.fail("unsupported command " + args[0])
+	}
+}
+
+// open selects the bus named canN and enters BCM mode.
+func (s *socketcandSession) open(args []string) {
+	if s.mode.Load() != socketcandModeNone {
+		s.fail("bus already opened")
+		return
+	}
+	if len(args) != 1 {
+		s.fail("expected a bus name")
+		return
+	}
+	bus, err := strconv.ParseUint(strings.TrimPrefix(args[0], "can"), 10, 8)
+	if err != nil || !strings.HasPrefix(args[0], "can") || int(bus) >= s.b.busCount() {
+		s.fail("unknown bus " + args[0])
+		return
+	}
+	s.bus.Store(uint32(bus))
+	s.mode.Store(socketcandModeBCM)
+	s.c.log.Debug("socketcand bus opened", "bus", args[0])
+	s.reply("< ok >")
+}
+
+// handleBCM runs a broadcast manager command.
+func (s *socketcandSession) handleBCM(cmd string, args []string) error {
+	switch cmd {
+	case "add":
+		if len(args) < 2 {
+			return errors.New("expected an interval")
+		}
+		interval, err := parseSocketCANDInterval(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return errors.New("interval must be greater than zero")
+		}
+		frame, err := parseSocketCANDFrame(args[2:])
+		if err != nil {
+			return err
+		}
+		key := socketcandJobKey{frame.ID, frame.Extended}
+		if job := s.jobs[key]; job != nil {
+			close(job.stop)
+		}
+		job := &socketcandJob{frame: frame, stop: make(chan struct{})}
+		s.jobs[key] = job
+		s.jobsDone.Add(1)
+		go func() {
+			defer s.jobsDone.Done()
+			s.runJob(job, interval)
+		}()
+	case "update":
+		frame, err := parseSocketCANDFrame(args)
+		if err != nil {
+			return err
+		}
+		job := s.jobs[socketcandJobKey{frame.ID, frame.Extended}]
+		if job == nil {
+			return fmt.Errorf("no cyclic job for %s", formatID(frame.ID, frame.Extended))
+		}
+		job.mu.Lock()
+		job.frame = frame
+		job.mu.Unlock()
+	case "delete":
+		key, err := parseSocketCANDKey(args)
+		if err != nil {
+			return err
+		}
+		job := s.jobs[key]
+		if job == nil {
+			return fmt.Errorf("no cyclic job for %s", formatID(key.id, key.extended))
+		}
+		close(job.stop)
+		delete(s.jobs, key)
+	case "subscribe":
+		if len(args) != 3 {
+			return errors.New("expected an interval and an identifier")
+		}
+		interval, err := parseSocketCANDInterval(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		key, err := parseSocketCANDKey(args[2:])
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.subscriptions[key] = &socketcandSubscription{interval: interval}
+		s.mu.Unlock()
+	case "unsubscribe":
+		key, err := parseSocketCANDKey(args)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		delete(s.subscriptions, key)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// runJob transmits the job's frame every interval until the job is deleted
+// or replaced, or the client disconnects.
+func (s *socketcandSession) runJob(job *socketcandJob, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job.mu.Lock()
+		frame := job.frame
+		job.mu.Unlock()
+		s.b.transmit(s.c, frame, uint8(s.bus.Load()))
+
+		select {
+		case <-ticker.C:
+		case <-job.stop:
+			return
+		case <-s.c.done:
+			return
+		}
+	}
+}
+
+// stop ends the cyclic jobs and waits for them, so that none transmits
+// after the client handler returned.
+func (s *socketcandSession) stop() {
+	for key, job := range s.jobs {
+		close(job.stop)
+		delete(s.jobs, key)
+	}
+	s.jobsDone.Wait()
+}
+
+func (s *socketcandSession) reply(msg string) {
+	s.c.enqueuePriority([]byte(msg))
+}
+
+func (s *socketcandSession) fail(reason string) {
+	s.reply("< error " + reason + " >")
+}
+
+// encodeFrame renders frames of the opened bus: all of them in raw mode and
+// those of subscribed identifiers in BCM mode.
+func (s *socketcandSession) encodeFrame(frame ebyte.Frame, bus uint8, at time.Time) []byte {
+	if uint32(bus) != s.bus.Load() {
+		return nil
+	}
+	switch s.mode.Load() {
+	case socketcandModeRaw:
+	case socketcandModeBCM:
+		if !s.subscribed(frame, at) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return []byte(encodeSocketCANDFrame(frame, at))
+}
+
+// subscribed reports whether a subscription wants frame now and records it
+// as forwarded.
+func (s *socketcandSession) subscribed(frame ebyte.Frame, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := s.subscriptions[socketcandJobKey{frame.ID, frame.Extended}]
+	if sub == nil || (sub.interval > 0 && at.Sub(sub.last) < sub.interval) {
+		return false
+	}
+	sub.last = at
+	return true
+}
+
+// busCount returns the number of buses clients can address: those of an
+// upstream GVRET device, or else the adapter's single bus.
+func (b *Bridge) busCount() int {
+	if buses := b.deviceBuses.Load(); buses != nil {
+		return len(*buses)
+	}
+	return 1
+}
+
+// encodeSocketCANDFrame renders a frame as "< frame ID sec.usec DATA >" with
+// the identifier in three or eight hex digits and the data bytes as one hex
+// string.
+func encodeSocketCANDFrame(frame ebyte.Frame, at time.Time) string {
+	var sb strings.Builder
+	if frame.Extended {
+		fmt.Fprintf(&sb, "< frame %08X", frame.ID)
+	} else {
+		fmt.Fprintf(&sb, "< frame %03X", frame.ID)
+	}
+	fmt.Fprintf(&sb, " %d.%06d ", at.Unix(), at.Nanosecond()/1000)
+	for _, by := range frame.Data[:min(frame.DLC, 8)] {
+		fmt.Fprintf(&sb, "%02X", by)
+	}
+	sb.WriteString(" >")
+	return sb.String()
+}
+
+// parseSocketCANDFrame parses "ID DLC [DATA...]" with the identifier in hex,
+// extended if given in eight digits, and one hex argument per data byte.
+func parseSocketCANDFrame(args []string) (ebyte.Frame, error) {
+	if len(args) < 2 {
+		return ebyte.Frame{}, errors.New("expected an identifier and a length")
+	}
+	key, err := parseSocketCANDKey(args[:1])
+	if err != nil {
+		return ebyte.Frame{}, err
+	}
+	dlc, err := strconv.ParseUint(args[1], 10, 8)
+	if err != nil || dlc > 8 {
+		return ebyte.Frame{}, fmt.Errorf("invalid length %q", args[1])
+	}
+	if len(args)-2 != int(dlc) {
+		return ebyte.Frame{}, fmt.Errorf("expected %d data bytes, got %d", dlc, len(args)-2)
+	}
+	frame := ebyte.Frame{ID: key.id, Extended: key.extended, DLC: uint8(dlc)}
+	for i, arg := range args[2:] {
+		by, err := strconv.ParseUint(arg, 16, 8)
+		if err != nil {
+			return ebyte.Frame{}, fmt.Errorf("invalid data byte %q", arg)
+		}
+		frame.Data[i] = byte(by)
+	}
+	return frame, nil
+}
+
+// parseSocketCANDKey parses a single hex identifier argument.
+func parseSocketCANDKey(args []string) (socketcandJobKey, error) {
+	if len(args) != 1 {
+		return socketcandJobKey{}, errors.New("expected an identifier")
+	}
+	extended := len(args[0]) == 8
+	id, err := strconv.ParseUint(args[0], 16, 32)
+	if err != nil || (extended && id > 0x1FFFFFFF) || (!extended && id > 0x7FF) {
+		return socketcandJobKey{}, fmt.Errorf("invalid identifier %q", args[0])
+	}
+	return socketcandJobKey{uint32(id), extended}, nil
+}
+
+// parseSocketCANDInterval parses the seconds and microseconds of a BCM
+// interval.
+func parseSocketCANDInterval(sec, usec string) (time.Duration, error) {
+	s, err1 := strconv.ParseUint(sec, 10, 32)
+	us, err2 := strconv.ParseUint(usec, 10, 32)
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("invalid interval %s %s", sec, usec)
+	}
+	return time.Duration(s)*time.Second + time.Duration(us)*time.Microsecond, nil
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/gvret"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestSocketCANDSession(t *testing.T) {
+	b := newTestBridge(t)
+	b.adapterConnected.Store(true)
+	server, peer := net.Pipe()
+	defer peer.Close()
+	c := newClient(1, server, b.clientLog)
+	defer c.close()
+	s := b.newSession(protocolSocketCAND, c)
+
+	if got := string(<-c.sendCh); got != "< hi >" {
+		t.Fatalf("expected greeting, got %q", got)
+	}
+	reply := func(input, want string) {
+		t.Helper()
+		s.receive([]byte(input))
+		if got := string(<-c.sendCh); got != want {
+			t.Fatalf("reply to %q: expected %q got %q", input, want, got)
+		}
+	}
+	silent := func(input string) {
+		t.Helper()
+		s.receive([]byte(input))
+		select {
+		case data := <-c.sendCh:
+			t.Fatalf("unexpected reply %q to %q", data, input)
+		default:
+		}
+	}
+
+	frame := ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0x11, 0xAB}}
+	at := time.Unix(1700000000, 42000)
+	if data := s.encodeFrame(frame, 0, at); data != nil {
+		t.Fatalf("session without bus must not receive frames, got %q", data)
+	}
+
+	reply("< rawmode >", "< error no bus opened >")
+	reply("< open can1 >", "< error unknown bus can1 >")
+	// elements may be split across reads and need no line endings
+	silent("< open ")
+	reply("can0 >", "< ok >")
+	reply("< open can0 >", "< error bus already opened >")
+	reply("< echo >", "< echo >")
+
+	// BCM mode only forwards subscribed identifiers
+	if data := s.encodeFrame(frame, 0, at); data != nil {
+		t.Fatalf("unsubscribed frame forwarded in BCM mode: %q", data)
+	}
+	silent("< subscribe 1 0 123 >")
+	if got, want := string(s.encodeFrame(frame, 0, at)), "< frame 123 1700000000.000042 11AB >"; got != want {
+		t.Fatalf("expected %q got %q", want, got)
+	}
+	if data := s.encodeFrame(frame, 0, at.Add(500*time.Millisecond)); data != nil {
+		t.Fatalf("frame forwarded within the subscription interval: %q", data)
+	}
+	silent("< unsubscribe 123 >")
+	if data := s.encodeFrame(frame, 0, at.Add(2*time.Second)); data != nil {
+		t.Fatalf("frame forwarded after unsubscribe: %q", data)
+	}
+
+	silent("< send 12345678 3 01 02 03 >")
+	sent := (<-b.txCh).frame
+	if sent.ID != 0x12345678 || !sent.Extended || sent.DLC != 3 || sent.Data[2] != 0x03 {
+		t.Fatalf("unexpected transmitted frame %+v", sent)
+	}
+	reply("< send 123 2 01 >", "< error expected 2 data bytes, got 1 >")
+	reply("< send 800 0 >", `< error invalid identifier "800" >`)
+	reply("< filter 0 0 123 0 >", "< error unsupported command filter >")
+
+	reply("< rawmode >", "< ok >")
+	extended := ebyte.Frame{ID: 0x1ABCDE, Extended: true, DLC: 0}
+	if got, want := string(s.encodeFrame(extended, 0, at)), "< frame 001ABCDE 1700000000.000042  >"; got != want {
+		t.Fatalf("expected %q got %q", want, got)
+	}
+	if data := s.encodeFrame(frame, 1, at); data != nil {
+		t.Fatalf("frame of another bus forwarded: %q", data)
+	}
+	reply("< add 0 10000 123 1 01 >", "< error command only valid in BCM mode >")
+	reply("< bcmmode >", "< ok >")
+}
+
+func TestSocketCANDCyclicJobs(t *testing.T) {
+	b := newTestBridge(t)
+	b.adapterConnected.Store(true)
+	b.deviceBuses.Store(&[]gvret.BusInfo{{Enabled: true}, {Enabled: true}})
+	server, peer := net.Pipe()
+	defer peer.Close()
+	c := newClient(1, server, b.clientLog)
+	defer c.close()
+	s := b.newSession(protocolSocketCAND, c)
+	<-c.sendCh
+
+	s.receive([]byte("< open can1 >< add 0 5000 7E0 2 01 02 >"))
+	if got := string(<-c.sendCh); got != "< ok >" {
+		t.Fatalf("expected bus to open, got %q", got)
+	}
+	next := func() txFrame {
+		t.Helper()
+		select {
+		case tx := <-b.txCh:
+			return tx
+		case <-time.After(time.Second):
+			t.Fatalf("cyclic frame not transmitted")
+			return txFrame{}
+		}
+	}
+	tx := next()
+	if tx.bus != 1 || tx.frame.ID != 0x7E0 || tx.frame.Data[1] != 0x02 {
+		t.Fatalf("unexpected cyclic frame %+v", tx)
+	}
+
+	s.receive([]byte("< update 7E0 2 03 04 >"))
+	waitFor(t, func() bool { return next().frame.Data[1] == 0x04 })
+
+	s.receive([]byte("< delete 7E0 >"))
+	// drain a transmission racing with the deletion
+	time.Sleep(20 * time.Millisecond)
+	for len(b.txCh) > 0 {
+		<-b.txCh
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(b.txCh); n != 0 {
+		t.Fatalf("%d frames transmitted after delete", n)
+	}
+
+	// Jobs end with the client handler.
+	s.receive([]byte("< add 0 5000 7E1 0 >"))
+	next()
+	s.(sessionStopper).stop()
+	for len(b.txCh) > 0 {
+		<-b.txCh
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(b.txCh); n != 0 {
+		t.Fatalf("%d frames transmitted after the session stopped", n)
+	}
+
+	s.receive([]byte("< delete 7E0 >< update 7E0 0 >< add 0 0 7E0 0 >"))
+	for _, want := range []string{
+		"< error no cyclic job for 7E0 >",
+		"< error no cyclic job for 7E0 >",
+		"< error interval must be greater than zero >",
+	} {
+		if got := string(<-c.sendCh); got != want {
+			t.Fatalf("expected %q got %q", want, got)
+		}
+	}
+}
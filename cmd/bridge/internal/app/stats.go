@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/stats"
+)
+
+// Stats returns the bus load and per-identifier statistics collected from the
+// adapter frame stream since startup.
+func (b *Bridge) Stats() stats.Snapshot {
+	return b.stats.Snapshot()
+}
+
+// logStats periodically writes a bus load summary at info level and the
+// per-identifier details at debug level until the context is cancelled.
+func (b *Bridge) logStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		snap := b.stats.Snapshot()
+		b.statsLog.Info("bus statistics",
+			"bus_load", fmt.Sprintf("%.1f%%", snap.BusLoad*100),
+			"peak_load", fmt.Sprintf("%.1f%%", snap.PeakLoad*100),
+			"frames", snap.Frames,
+			"identifiers", len(snap.IDs))
+		for _, id := range snap.IDs {
+			b.statsLog.Debug("identifier statistics",
+				"frame_id", formatID(id.ID, id.Extended),
+				"count", id.Count,
+				"period", id.MeanPeriod,
+				"jitter", id.Jitter,
+				"data", fmt.Sprintf("% X", id.Data))
+		}
+		if t := b.tunnel.Load(); t != nil {
+			s := t.status()
+			b.statsLog.Info("cannelloni statistics",
+				"packets_sent", s.PacketsSent,
+				"packets_received", s.PacketsReceived,
+				"lost_packets", s.LostPackets,
+				"out_of_order_packets", s.OutOfOrder,
+				"malformed_packets", s.Malformed)
+		}
+	}
+}
+
+// formatID renders a CAN identifier the way SavvyCAN and candump display it.
+func formatID(id uint32, extended bool) string {
+	if extended {
+		return fmt.Sprintf("%08X", id&0x1FFFFFFF)
+	}
+	return fmt.Sprintf("%03X", id&0x7FF)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/systemd"
+)
+
+// activatedFiles returns the sockets passed by systemd socket activation;
+// tests replace it.
+var activatedFiles func() []*os.File = systemd.Files
+
+// livenessSlack is added to the time the adapter loop announces for its
+// next step before the watchdog considers the loop stuck.
+const livenessSlack = 5 * time.Second
+
+// notify sends a state change to systemd if the bridge runs as a notify
+// service.
+func (b *Bridge) notify(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		b.logger.Debug("systemd notification failed", "state", state, "error", err)
+	}
+}
+
+// notifyStatus publishes a status line shown by systemctl status.
+func (b *Bridge) notifyStatus(format string, args ...any) {
+	b.notify("STATUS=" + fmt.Sprintf(format, args...))
+}
+
+// notifyReady reports readiness the first time the adapter is connected.
+func (b *Bridge) notifyReady() {
+	b.readyOnce.Do(func() { b.notify("READY=1") })
+}
+
+// expectProgress records that the adapter loop will be back within d. The
+// watchdog only confirms liveness while that promise holds.
+func (b *Bridge) expectProgress(d time.Duration) {
+	b.adapterDeadline.Store(time.Now().Add(d + livenessSlack).UnixNano())
+}
+
+// runWatchdog pings the systemd watchdog at half its interval as long as the
+// adapter loop keeps its announced deadlines. A stuck loop therefore makes
+// systemd restart the service.
+func (b *Bridge) runWatchdog(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	stalled := false
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if time.Now().UnixNano() > b.adapterDeadline.Load() {
+			if !stalled {
+				b.adapterLog.Error("adapter loop unresponsive, withholding watchdog ping")
+				stalled = true
+			}
+			continue
+		}
+		stalled = false
+		b.notify("WATCHDOG=1")
+	}
+}
+
+// activatedListener takes the socket passed by systemd under name, which is
+// the FileDescriptorName= of the socket unit or the index of the socket.
+func (b *Bridge) activatedListener(name string) (net.Listener, error) {
+	index := -1
+	for i, f := range b.activated {
+		if f != nil && f.Name() == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(b.activated) && b.activated[i] != nil {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+	}
+
+	f := b.activated[index]
+	b.activated[index] = nil
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket %q passed by systemd: %w", name, err)
+	}
+	return l, nil
+}
+
+// closeUnusedActivated closes sockets passed by systemd that no listener
+// refers to.
+func (b *Bridge) closeUnusedActivated() {
+	for i, f := range b.activated {
+		if f == nil {
+			continue
+		}
+		b.logger.Warn("ignoring socket passed by systemd", "name", f.Name(), "index", i)
+		_ = f.Close()
+	}
+	b.activated = nil
+}
@@ -0,0 +1,120 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunSystemdIntegration(t *testing.T) {
+	notifyPath := filepath.Join(t.TempDir(), "notify.sock")
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifyPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer notifications.Close()
+	t.Setenv("NOTIFY_SOCKET", notifyPath)
+	t.Setenv("WATCHDOG_USEC", "200000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+
+	// Pass a listening socket the way socket activation does.
+	activated, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	file, err := activated.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("listener file: %v", err)
+	}
+	addr := activated.Addr().String()
+	activated.Close()
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatalf("dup: %v", err)
+	}
+	file.Close()
+	named := os.NewFile(uintptr(fd), "gvret-socket")
+	defer func(orig func() []*os.File) { activatedFiles = orig }(activatedFiles)
+	activatedFiles = func() []*os.File { return []*os.File{named} }
+
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = "systemd:gvret-socket"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	seen := map[string]bool{}
+	buf := make([]byte, 256)
+	_ = notifications.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !(seen["READY=1"] && seen["WATCHDOG=1"] && seen["STATUS=connected to adapter "+adapterAddr]) {
+		n, err := notifications.Read(buf)
+		if err != nil {
+			t.Fatalf("missing notifications, got %v: %v", seen, err)
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			seen[line] = true
+		}
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial activated socket: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte{0xE7, 0xE7, 0xF1, 0x09}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ack := make([]byte, 2)
+	if _, err := io.ReadFull(conn, ack); err != nil || ack[1] != 0x09 {
+		t.Fatalf("expected validation ack on activated socket, got %X (%v)", ack, err)
+	}
+}
+
+func TestWatchdogWithholdsPingWhenLoopStalls(t *testing.T) {
+	b := newTestBridge(t)
+	b.adapterDeadline.Store(time.Now().Add(-time.Second).UnixNano())
+
+	notifyPath := filepath.Join(t.TempDir(), "notify.sock")
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifyPath, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer notifications.Close()
+	t.Setenv("NOTIFY_SOCKET", notifyPath)
+
+	stop := make(chan struct{})
+	go b.runWatchdog(stop, 20*time.Millisecond)
+	defer close(stop)
+
+	_ = notifications.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := notifications.Read(make([]byte, 64)); err == nil {
+		t.Fatalf("expected no watchdog ping while the adapter loop is overdue")
+	}
+
+	b.expectProgress(time.Second)
+	_ = notifications.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := notifications.Read(buf)
+	if err != nil || string(buf[:n]) != "WATCHDOG=1" {
+		t.Fatalf("expected watchdog ping, got %q (%v)", buf[:n], err)
+	}
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// tlsHandshakeTimeout bounds the TLS handshake of a new client.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLSConfig holds the certificate material shared by all listeners that have
+// TLS enabled.
+type TLSConfig struct {
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// ClientCAFile enables verification of client certificates against the
+	// CA bundle in the file. Clients without a certificate are still
+	// accepted unless RequireClientCert is set.
+	ClientCAFile      string `json:"client_ca_file,omitempty"`
+	RequireClientCert bool   `json:"require_client_cert,omitempty"`
+	// AllowedClients restricts access to client certificates whose common
+	// name is in the list.
+	AllowedClients []string `json:"allowed_clients,omitempty"`
+}
+
+// validate checks the settings of the TLS block; it is only called when a
+// listener uses TLS.
+func (t TLSConfig) validate(add func(string, error)) {
+	if t.CertFile == "" {
+		add("tls.cert_file", errors.New("required when TLS is enabled"))
+	}
+	if t.KeyFile == "" {
+		add("tls.key_file", errors.New("required when TLS is enabled"))
+	}
+	if t.RequireClientCert && t.ClientCAFile == "" {
+		add("tls.require_client_cert", errors.New("requires tls.client_ca_file"))
+	}
+	if len(t.AllowedClients) > 0 && t.ClientCAFile == "" {
+		add("tls.allowed_clients", errors.New("requires tls.client_ca_file"))
+	}
+}
+
+// serverConfig loads the certificates and builds the server configuration.
+func (t TLSConfig) serverConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client CA bundle %s contains no certificates", t.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if t.RequireClientCert || len(t.AllowedClients) > 0 {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// handshakeClient completes the TLS handshake of conn and returns the common
+// name of the verified client certificate, or "" if none was presented.
+func handshakeClient(ctx context.Context, conn *tls.Conn) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return "", err
+	}
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0].Subject.CommonName, nil
+	}
+	return "", nil
+}
+
+// authorizeClient decides whether a client may use the bridge. It returns
+// the reason for a rejection or "" if the client is accepted.
+func (b *Bridge) authorizeClient(c *client) string {
+	if allowed := b.cfg.TLS.AllowedClients; c.tls && len(allowed) > 0 && !slices.Contains(allowed, c.identity) {
+		return "client certificate not allowed"
+	}
+	return ""
+}
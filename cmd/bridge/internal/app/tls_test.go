@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI is a throw-away CA issuing server and client certificates.
+type testPKI struct {
+	t    *testing.T
+	dir  string
+	ca   *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	p := &testPKI{t: t, dir: t.TempDir(), ca: ca, key: key, pool: x509.NewCertPool()}
+	p.pool.AddCert(ca)
+	p.write("ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *testPKI) write(name, typ string, der []byte) string {
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		p.t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+// issue creates a certificate for cn and returns it together with the paths
+// of the PEM files.
+func (p *testPKI) issue(cn string, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	p.t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		p.t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, &key.PublicKey, p.key)
+	if err != nil {
+		p.t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		p.t.Fatalf("marshal key: %v", err)
+	}
+	certPath := p.write(cn+".pem", "CERTIFICATE", der)
+	keyPath := p.write(cn+"-key.pem", "EC PRIVATE KEY", keyDER)
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		p.t.Fatalf("load key pair: %v", err)
+	}
+	return cert, certPath, keyPath
+}
+
+func TestTLSClientIdentityAndAccess(t *testing.T) {
+	pki := newTestPKI(t)
+	_, certFile, keyFile := pki.issue("bridge", x509.ExtKeyUsageServerAuth)
+	allowed, _, _ := pki.issue("savvycan", x509.ExtKeyUsageClientAuth)
+	denied, _, _ := pki.issue("intruder", x509.ExtKeyUsageClientAuth)
+
+	b := newTestBridge(t)
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.SLCANListenAddress = freeAddress(t)
+	b.cfg.SLCANListenTLS = true
+	b.cfg.TLS = TLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ClientCAFile:   filepath.Join(pki.dir, "ca.pem"),
+		AllowedClients: []string{"savvycan"},
+	}
+	if err := b.cfg.Validate(); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	dial := func(cert *tls.Certificate) (*tls.Conn, error) {
+		cfg := &tls.Config{RootCAs: pki.pool, ServerName: "127.0.0.1"}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+		var conn *tls.Conn
+		var err error
+		waitFor(t, func() bool {
+			var d net.Dialer
+			raw, dialErr := d.Dial("tcp", b.cfg.SLCANListenAddress)
+			if dialErr != nil {
+				return false
+			}
+			conn = tls.Client(raw, cfg)
+			err = conn.Handshake()
+			return true
+		})
+		return conn, err
+	}
+
+	conn, err := dial(&allowed)
+	if err != nil {
+		t.Fatalf("handshake with allowed certificate failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("V\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\r')
+	if err != nil || line != "V0100\r" {
+		t.Fatalf("unexpected reply %q (%v)", line, err)
+	}
+	b.mu.RLock()
+	var identity string
+	for c := range b.clients {
+		identity = c.identity
+	}
+	b.mu.RUnlock()
+	if identity != "savvycan" {
+		t.Fatalf("expected client identity savvycan, got %q", identity)
+	}
+
+	// Rejected clients complete the handshake but are disconnected at once.
+	for _, cert := range []*tls.Certificate{&denied, nil} {
+		conn, err := dial(cert)
+		if err == nil {
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, err = conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		if err == nil {
+			t.Fatalf("expected connection to be refused")
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package app
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/canlog"
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/rotate"
+)
+
+// traceQueueSize bounds the records waiting for a trace writer; further
+// records are dropped so that a slow disk cannot stall the adapter loop.
+const traceQueueSize = 4096
+
+// CandumpConfig enables a trace in the log format of `candump -L`.
+type CandumpConfig struct {
+	// File receives the trace; "-" writes to stdout and an empty value
+	// disables the output.
+	File string `json:"file,omitempty"`
+	// Interfaces names the buses in the trace, bus 0 first; buses without
+	// a name are called "can<n>".
+	Interfaces []string `json:"interfaces,omitempty"`
+}
+
+// Capture formats.
+const (
+	captureFormatPcapNG = "pcapng"
+	captureFormatPcap   = "pcap"
+)
+
+// CaptureConfig enables a packet capture that Wireshark and tcpdump can
+// read, using the SocketCAN link type.
+type CaptureConfig struct {
+	// File receives the capture; "-" writes to stdout, e.g. for piping into
+	// "wireshark -k -i -", and an empty value disables the output.
+	File string `json:"file,omitempty"`
+	// Format is "pcapng" (the default) or "pcap". Classic PCAP files have
+	// no interfaces and no direction, so all buses and both directions
+	// are mixed.
+	Format string `json:"format,omitempty"`
+	// Interfaces names the buses in the capture, bus 0 first; buses without
+	// a name are called "can<n>".
+	Interfaces []string `json:"interfaces,omitempty"`
+	// IncludeTX adds the frames clients transmit to the adapter.
+	IncludeTX bool          `json:"include_tx,omitempty"`
+	Rotation  TraceRotation `json:"rotation"`
+}
+
+// ASCConfig enables a trace in the Vector ASC format for CANalyzer and
+// CANoe. Bus n is written as channel n+1.
+type ASCConfig struct {
+	// File receives the trace; "-" writes to stdout and an empty value
+	// disables the output.
+	File string `json:"file,omitempty"`
+	// IncludeTX adds the frames clients transmit to the adapter as Tx
+	// lines.
+	IncludeTX bool          `json:"include_tx,omitempty"`
+	Rotation  TraceRotation `json:"rotation"`
+}
+
+// TRCConfig enables a trace in the PEAK TRC 2.1 format for PCAN-View.
+type TRCConfig struct {
+	// File receives the trace; "-" writes to stdout and an empty value
+	// disables the output.
+	File string `json:"file,omitempty"`
+	// PerBus writes every bus to its own file, named after File with
+	// "-bus<n>" inserted before the extension, e.g. "trace-bus1.trc".
+	// Bus n is numbered n+1 as in the TRC bus column.
+	PerBus bool `json:"per_bus,omitempty"`
+	// IncludeTX adds the frames clients transmit to the adapter as Tx
+	// lines.
+	IncludeTX bool          `json:"include_tx,omitempty"`
+	Rotation  TraceRotation `json:"rotation"`
+}
+
+// trcBusPath returns the file of bus in a per-bus TRC trace.
+func trcBusPath(file string, bus int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s-bus%d%s", strings.TrimSuffix(file, ext), bus+1, ext)
+}
+
+// TraceRotation starts a new trace file once the current one reaches a size
+// or an age. Rotation happens between records, so every file is complete
+// on its own; older files are kept as "<file>.1", "<file>.2" and so on.
+type TraceRotation struct {
+	// MaxSize is the size in bytes after which the file is rotated. It is
+	// checked against the data written out, so a file may exceed it by up
+	// to one write buffer.
+	MaxSize int64 `json:"max_size,omitempty"`
+	// MaxAge rotates the file with the first record that arrives this long
+	// after the first record in the file.
+	MaxAge     Duration `json:"max_age,omitempty"`
+	MaxBackups int      `json:"max_backups,omitempty"`
+}
+
+// validate reports problems with the rotation below path; file is the
+// trace output the rotation applies to.
+func (r TraceRotation) validate(path, file string, add func(string, error)) {
+	if r.MaxSize < 0 {
+		add(path+".max_size", errors.New("must not be negative"))
+	}
+	if r.MaxAge < 0 {
+		add(path+".max_age", errors.New("must not be negative"))
+	}
+	if r.MaxBackups < 0 {
+		add(path+".max_backups", errors.New("must not be negative"))
+	}
+	if file == "-" && r != (TraceRotation{}) {
+		add(path, errors.New("stdout cannot be rotated"))
+	}
+}
+
+// traceSink feeds records to a trace writer from its own goroutine.
+type traceSink struct {
+	name    string
+	w       canlog.Writer
+	ch      chan canlog.Record
+	done    chan struct{}
+	dropped atomic.Uint64
+	log     Logger
+	// includeTX selects whether frames sent to the adapter are traced.
+	includeTX bool
+}
+
+func newTraceSink(name string, w canlog.Writer, log Logger) *traceSink {
+	return &traceSink{
+		name: name,
+		w:    w,
+		ch:   make(chan canlog.Record, traceQueueSize),
+		done: make(chan struct{}),
+		log:  log.With("trace", name),
+	}
+}
+
+// run writes queued records until the sink is closed, flushing whenever the
+// queue runs empty so that the trace can be followed live.
+func (s *traceSink) run() {
+	defer close(s.done)
+	failing := false
+	for rec := range s.ch {
+		err := s.w.WriteRecord(rec)
+		if err == nil && len(s.ch) == 0 {
+			err = s.w.Flush()
+		}
+		switch {
+		case err != nil && !failing:
+			s.log.Error("trace write failed", "error", err)
+			failing = true
+		case err == nil && failing:
+			s.log.Info("trace write recovered")
+			failing = false
+		}
+	}
+}
+
+// record queues rec without blocking.
+func (s *traceSink) record(rec canlog.Record) {
+	if rec.Dir == canlog.Tx && !s.includeTX {
+		return
+	}
+	select {
+	case s.ch <- rec:
+	default:
+		if s.dropped.Add(1) == 1 {
+			s.log.Warn("trace queue full, dropping records")
+		}
+	}
+}
+
+// close writes the remaining records and closes the writer.
+func (s *traceSink) close() error {
+	close(s.ch)
+	<-s.done
+	if n := s.dropped.Load(); n > 0 {
+		s.log.Warn("trace records dropped", "dropped", n)
+	}
+	if err := s.w.Close(); err != nil {
+		return fmt.Errorf("trace %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// openTraceFile opens path for appending; "-" selects stdout, which is not
+// closed with the trace.
+func openTraceFile(path string) (io.Writer, error) {
+	if path == "-" {
+		return struct{ io.Writer }{os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+	return f, nil
+}
+
+// rotatingTrace writes a trace format to a rotated file. Every file starts
+// with a fresh writer, so that headers and interface descriptions are
+// repeated and each file can be read on its own.
+type rotatingTrace struct {
+	file      *rotate.Writer
+	newWriter func(w io.Writer, start time.Time) (canlog.Writer, error)
+	w         canlog.Writer
+	rotation  TraceRotation
+	// started is the time of the first record in the current file.
+	started time.Time
+}
+
+// openRotatingTrace starts a trace at path whose first file begins at
+// start. An existing file is rotated away, or replaced without backups,
+// because binary formats cannot be appended to.
+func openRotatingTrace(path string, rotation TraceRotation, start time.Time, newWriter func(io.Writer, time.Time) (canlog.Writer, error)) (*rotatingTrace, error) {
+	file, err := rotate.Open(path, 0, rotation.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+	t := &rotatingTrace{file: file, newWriter: newWriter, rotation: rotation}
+	if file.Size() > 0 {
+		err = file.Rotate()
+	}
+	if err == nil {
+		err = t.start(start)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+	return t, nil
+}
+
+// start creates the writer for a new file beginning at the given time. The
+// file is hidden behind a plain io.Writer so that closing the writer at
+// rotation keeps it open.
+func (t *rotatingTrace) start(at time.Time) error {
+	w, err := t.newWriter(struct{ io.Writer }{t.file}, at)
+	if err != nil {
+		return err
+	}
+	t.w = w
+	t.started = time.Time{}
+	return nil
+}
+
+// WriteRecord writes rec, rotating the file first if it is due. A failed
+// rotation is reported, but the trace continues in the file that is open
+// afterwards with a new writer, since the old one is closed either way.
+func (t *rotatingTrace) WriteRecord(rec canlog.Record) error {
+	var rotateErr error
+	if t.w != nil && t.due(rec.Time) {
+		rotateErr = errors.Join(t.w.Close(), t.file.Rotate())
+		t.w = nil
+	}
+	if t.w == nil {
+		// The new file begins with the record that triggered the
+		// rotation, so that its time offsets are not negative.
+		if err := t.start(rec.Time); err != nil {
+			return errors.Join(rotateErr, err)
+		}
+	}
+	if t.started.IsZero() {
+		t.started = rec.Time
+	}
+	return errors.Join(rotateErr, t.w.WriteRecord(rec))
+}
+
+func (t *rotatingTrace) due(now time.Time) bool {
+	if t.started.IsZero() {
+		return false
+	}
+	if t.rotation.MaxSize > 0 && t.file.Size() >= t.rotation.MaxSize {
+		return true
+	}
+	return t.rotation.MaxAge > 0 && now.Sub(t.started) >= time.Duration(t.rotation.MaxAge)
+}
+
+// Flush writes buffered records to the file.
+func (t *rotatingTrace) Flush() error {
+	if t.w == nil {
+		return nil
+	}
+	return t.w.Flush()
+}
+
+// Close flushes the writer and closes the file.
+func (t *rotatingTrace) Close() error {
+	if t.w == nil {
+		return t.file.Close()
+	}
+	return errors.Join(t.w.Close(), t.file.Close())
+}
+
+// busTraces splits records by bus into writers that are opened when the
+// first record of their bus arrives and begin at its time.
+type busTraces struct {
+	open    func(bus int, start time.Time) (canlog.Writer, error)
+	writers map[int]canlog.Writer
+}
+
+func newBusTraces(open func(bus int, start time.Time) (canlog.Writer, error)) *busTraces {
+	return &busTraces{open: open, writers: make(map[int]canlog.Writer)}
+}
+
+// WriteRecord writes rec to the writer of its bus.
+func (t *busTraces) WriteRecord(rec canlog.Record) error {
+	w, ok := t.writers[rec.Bus]
+	if !ok {
+		var err error
+		if w, err = t.open(rec.Bus, rec.Time); err != nil {
+			return err
+		}
+		t.writers[rec.Bus] = w
+	}
+	return w.WriteRecord(rec)
+}
+
+// Flush flushes the writers of all buses.
+func (t *busTraces) Flush() error {
+	var errs []error
+	for _, w := range t.writers {
+		errs = append(errs, w.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the writers of all buses.
+func (t *busTraces) Close() error {
+	var errs []error
+	for _, w := range t.writers {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// openFormatTrace opens file for a trace format whose writer is created by
+// newWriter: stdout for "-", otherwise a rotating file. The trace begins
+// now.
+func openFormatTrace(file string, rotation TraceRotation, newWriter func(io.Writer, time.Time) (canlog.Writer, error)) (canlog.Writer, error) {
+	if file == "-" {
+		out, err := openTraceFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return newWriter(out, time.Now())
+	}
+	return openRotatingTrace(file, rotation, time.Now(), newWriter)
+}
+
+// startTrace runs a sink for w and logs its settings.
+func (b *Bridge) startTrace(name string, w canlog.Writer, includeTX bool, attrs ...any) {
+	sink := newTraceSink(name, w, b.traceLog)
+	sink.includeTX = includeTX
+	b.traces = append(b.traces, sink)
+	b.spawn(sink.run)
+	sink.log.Info("trace started", attrs...)
+}
+
+// openTraces creates the configured trace outputs, the SocketCAN mirror and
+// the cannelloni tunnel and starts their writers.
+func (b *Bridge) openTraces() error {
+	if path := b.cfg.Candump.File; path != "" {
+		out, err := openTraceFile(path)
+		if err != nil {
+			return err
+		}
+		b.startTrace("candump", canlog.NewCandumpWriter(out, b.cfg.Candump.Interfaces), false, "file", path)
+	}
+	if cfg := b.cfg.Capture; cfg.File != "" {
+		w, err := openFormatTrace(cfg.File, cfg.Rotation, func(w io.Writer, _ time.Time) (canlog.Writer, error) {
+			if cfg.Format == captureFormatPcap {
+				return canlog.NewPcapWriter(w)
+			}
+			return canlog.NewPcapNGWriter(w, cfg.Interfaces)
+		})
+		if err != nil {
+			return err
+		}
+		b.startTrace("capture", w, cfg.IncludeTX, "file", cfg.File, "format", cmp.Or(cfg.Format, captureFormatPcapNG), "include_tx", cfg.IncludeTX)
+	}
+	if cfg := b.cfg.ASC; cfg.File != "" {
+		w, err := openFormatTrace(cfg.File, cfg.Rotation, func(w io.Writer, start time.Time) (canlog.Writer, error) {
+			return canlog.NewASCWriter(w, start)
+		})
+		if err != nil {
+			return err
+		}
+		b.startTrace("asc", w, cfg.IncludeTX, "file", cfg.File, "include_tx", cfg.IncludeTX)
+	}
+	if cfg := b.cfg.TRC; cfg.File != "" {
+		newWriter := func(w io.Writer, start time.Time) (canlog.Writer, error) {
+			return canlog.NewTRCWriter(w, start)
+		}
+		var w canlog.Writer
+		if cfg.PerBus {
+			w = newBusTraces(func(bus int, start time.Time) (canlog.Writer, error) {
+				return openRotatingTrace(trcBusPath(cfg.File, bus), cfg.Rotation, start, newWriter)
+			})
+		} else {
+			var err error
+			if w, err = openFormatTrace(cfg.File, cfg.Rotation, newWriter); err != nil {
+				return err
+			}
+		}
+		b.startTrace("trc", w, cfg.IncludeTX, "file", cfg.File, "per_bus", cfg.PerBus, "include_tx", cfg.IncludeTX)
+	}
+	if b.cfg.SocketCAN.Mirror != "" {
+		m, err := b.openMirror()
+		if err != nil {
+			return err
+		}
+		b.mirror = m
+	}
+	if b.cfg.Cannelloni.Peer != "" {
+		t, err := b.openTunnel()
+		if err != nil {
+			return err
+		}
+		b.tunnel.Store(t)
+	}
+	return nil
+}
+
+// traceFrame hands a frame to all trace outputs.
+func (b *Bridge) traceFrame(rec canlog.Record) {
+	for _, s := range b.traces {
+		s.record(rec)
+	}
+}
+
+// closeTraces flushes and closes all trace outputs, the mirror and the
+// tunnel.
+func (b *Bridge) closeTraces() error {
+	var errs []error
+	for _, s := range b.traces {
+		errs = append(errs, s.close())
+	}
+	b.traces = nil
+	if b.mirror != nil {
+		errs = append(errs, b.mirror.close())
+		b.mirror = nil
+	}
+	if t := b.tunnel.Swap(nil); t != nil {
+		errs = append(errs, t.close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/canlog"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestRunTraces(t *testing.T) {
+	frames := []ebyte.Frame{
+		{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}},
+		{ID: 0x18DAF110, Extended: true, Remote: true, DLC: 3},
+	}
+	adapterAddr := startFakeAdapter(t, func(conn net.Conn) {
+		for _, f := range frames {
+			raw, err := ebyte.SerializeFrame(f)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(raw)
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.log")
+	ascPath := filepath.Join(dir, "trace.asc")
+	b := newTestBridge(t)
+	b.cfg.EByteAddress = adapterAddr
+	b.cfg.ListenAddress = freeAddress(t)
+	b.cfg.Candump = CandumpConfig{File: path, Interfaces: []string{"ebyte0"}}
+	b.cfg.ASC = ASCConfig{File: ascPath}
+	// Filters only affect clients; the trace records all frames.
+	b.filters.Store(newFilterSet([]Filter{{ID: 0x7FF}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	waitFor(t, func() bool { return b.stats.Snapshot().Frames == uint64(len(frames)) })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	want := regexp.MustCompile(`^\(\d+\.\d{6}\) ebyte0 123#CAFE\n\(\d+\.\d{6}\) ebyte0 18DAF110#R3\n$`)
+	if !want.Match(data) {
+		t.Fatalf("unexpected trace %q", data)
+	}
+
+	f, err := os.Open(ascPath)
+	if err != nil {
+		t.Fatalf("open ASC trace: %v", err)
+	}
+	defer f.Close()
+	r := canlog.NewASCReader(f)
+	for i, want := range frames {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatalf("ASC record %d: %v", i, err)
+		}
+		if rec.Frame != want || rec.Dir != canlog.Rx {
+			t.Fatalf("ASC record %d: expected %+v got %+v", i, want, rec)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("expected end of ASC trace, got %v", err)
+	}
+}
+
+func TestRotatingTraceStartsEachFileWithHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	if err := os.WriteFile(path, []byte("previous run"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newWriter := func(w io.Writer, _ time.Time) (canlog.Writer, error) { return canlog.NewPcapWriter(w) }
+	trace, err := openRotatingTrace(path, TraceRotation{MaxAge: Duration(time.Second), MaxBackups: 3}, time.Now(), newWriter)
+	if err != nil {
+		t.Fatalf("openRotatingTrace returned error: %v", err)
+	}
+	start := time.Unix(1000, 0)
+	for _, offset := range []time.Duration{0, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond} {
+		if err := trace.WriteRecord(canlog.Record{Time: start.Add(offset), Frame: ebyte.Frame{ID: 0x1}}); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := trace.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	// The records at 0 and 0.5s share a file; 1s and 2.5s each start one.
+	const header, record = 24, 32
+	for name, want := range map[string]int{
+		path:        header + record,
+		path + ".1": header + record,
+		path + ".2": header + 2*record,
+		path + ".3": len("previous run"),
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if len(data) != want {
+			t.Fatalf("%s: expected %d bytes got %d", name, want, len(data))
+		}
+		if name != path+".3" && !bytes.HasPrefix(data, []byte{0x4D, 0x3C, 0xB2, 0xA1}) {
+			t.Fatalf("%s does not start with a PCAP header", name)
+		}
+	}
+}
+
+func TestRotatingASCTraceStartsAtFirstRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.asc")
+	newWriter := func(w io.Writer, start time.Time) (canlog.Writer, error) { return canlog.NewASCWriter(w, start) }
+	start := time.Unix(1000, 0)
+	trace, err := openRotatingTrace(path, TraceRotation{MaxAge: Duration(time.Second), MaxBackups: 1}, start, newWriter)
+	if err != nil {
+		t.Fatalf("openRotatingTrace returned error: %v", err)
+	}
+	for _, offset := range []time.Duration{0, 3 * time.Second} {
+		if err := trace.WriteRecord(canlog.Record{Time: start.Add(offset), Frame: ebyte.Frame{ID: 0x1}}); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := trace.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	// Both files begin with their first record.
+	for _, name := range []string{path, path + ".1"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Contains(data, []byte("\n   0.000000 1  1 ")) {
+			t.Fatalf("%s: expected the first record at offset 0 in %q", name, data)
+		}
+	}
+}
+
+func TestRotatingTraceContinuesAfterFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.asc")
+	newWriter := func(w io.Writer, start time.Time) (canlog.Writer, error) { return canlog.NewASCWriter(w, start) }
+	start := time.Unix(1000, 0)
+	trace, err := openRotatingTrace(path, TraceRotation{MaxAge: Duration(time.Second), MaxBackups: 1}, start, newWriter)
+	if err != nil {
+		t.Fatalf("openRotatingTrace returned error: %v", err)
+	}
+	rec := canlog.Record{Time: start, Frame: ebyte.Frame{ID: 0x1}}
+	if err := trace.WriteRecord(rec); err != nil {
+		t.Fatalf("WriteRecord returned error: %v", err)
+	}
+	// The file cannot be moved away once it is deleted.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	rec.Time = start.Add(2 * time.Second)
+	if err := trace.WriteRecord(rec); err == nil {
+		t.Fatalf("expected the failed rotation to be reported")
+	}
+	rec.Time = start.Add(2500 * time.Millisecond)
+	if err := trace.WriteRecord(rec); err != nil {
+		t.Fatalf("WriteRecord after failed rotation returned error: %v", err)
+	}
+	if err := trace.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read trace: %v", err)
+	}
+	if n := bytes.Count(data, []byte("Begin Triggerblock")); n != 1 || bytes.Count(data, []byte("End TriggerBlock")) != 1 {
+		t.Fatalf("expected one complete trigger block in %q", data)
+	}
+	if !bytes.Contains(data, []byte("\n   0.000000 1  1 ")) || !bytes.Contains(data, []byte("\n   0.500000 1  1 ")) {
+		t.Fatalf("expected both records after the rotation in %q", data)
+	}
+}
+
+func TestBusTracesSplitTRCByBus(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trace.trc")
+	newWriter := func(w io.Writer, start time.Time) (canlog.Writer, error) { return canlog.NewTRCWriter(w, start) }
+	trace := newBusTraces(func(bus int, start time.Time) (canlog.Writer, error) {
+		return openRotatingTrace(trcBusPath(file, bus), TraceRotation{}, start, newWriter)
+	})
+	// Each file begins with the first record of its bus.
+	for i, bus := range []int{0, 1, 0} {
+		rec := canlog.Record{Time: time.Unix(1000+int64(i), 0), Bus: bus, Frame: ebyte.Frame{ID: 0x100 + uint32(bus)}}
+		if err := trace.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := trace.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"trace-bus1.trc": "      1         0.000 DT 1      0100 Rx -  0\n      2      2000.000 DT 1      0100 Rx -  0\n",
+		"trace-bus2.trc": "      1         0.000 DT 2      0101 Rx -  0\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(file), name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.HasSuffix(data, []byte(want)) {
+			t.Fatalf("%s: expected records %q in %q", name, want, data)
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("per-bus trace created the combined file")
+	}
+}
@@ -0,0 +1,265 @@
+package canlog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ascDateLayout is the timestamp layout of the ASC "date" header line.
+const ascDateLayout = "Mon Jan 02 03:04:05.000 pm 2006"
+
+// ascDateLayouts are the header date layouts accepted by ASCReader.
+var ascDateLayouts = []string{
+	"Mon Jan 2 03:04:05.000 pm 2006",
+	"Mon Jan 2 03:04:05 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+// ASCWriter writes records in the Vector ASC log format read by CANalyzer
+// and CANoe:
+//
+//	date Sat Oct 18 10:15:00.123 am 2026
+//	base hex  timestamps absolute
+//	internal events logged
+//	Begin Triggerblock Sat Oct 18 10:15:00.123 am 2026
+//	   0.000000 Start of measurement
+//	   0.012345 1  18DAF110x       Rx   d 3 01 02 03
+//	End TriggerBlock
+//
+// Timestamps are seconds since the start time in the header; bus n is
+// written as channel n+1.
+type ASCWriter struct {
+	w      *bufio.Writer
+	closer io.Closer
+	start  time.Time
+}
+
+// NewASCWriter writes the header with the given start time to w. If w is an
+// io.Closer, Close closes it.
+func NewASCWriter(w io.Writer, start time.Time) (*ASCWriter, error) {
+	aw := &ASCWriter{w: bufio.NewWriter(w), start: start}
+	if c, ok := w.(io.Closer); ok {
+		aw.closer = c
+	}
+	date := start.Format(ascDateLayout)
+	_, err := fmt.Fprintf(aw.w, "date %s\nbase hex  timestamps absolute\ninternal events logged\n"+
+		"Begin Triggerblock %s\n%11.6f Start of measurement\n", date, date, 0.0)
+	if err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// WriteRecord writes one message line.
+func (aw *ASCWriter) WriteRecord(rec Record) error {
+	_, err := aw.w.WriteString(FormatASC(rec, rec.Time.Sub(aw.start)))
+	return err
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (aw *ASCWriter) Flush() error {
+	return aw.w.Flush()
+}
+
+// Close ends the trigger block, flushes and closes the underlying writer.
+func (aw *ASCWriter) Close() error {
+	_, err := aw.w.WriteString("End TriggerBlock\n")
+	if cerr := closeBuffered(aw.w, aw.closer); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// FormatASC renders rec as an ASC message line at the given offset from the
+// start of the measurement, including the trailing newline. Remote frames
+// carry their DLC after the "r" as written by CANoe 8.5 and later.
+func FormatASC(rec Record, offset time.Duration) string {
+	var b strings.Builder
+	frame := rec.Frame
+	id := fmt.Sprintf("%X", frame.ID&0x7FF)
+	if frame.Extended {
+		id = fmt.Sprintf("%Xx", frame.ID&0x1FFFFFFF)
+	}
+	dlc := min(frame.DLC, 8)
+	fmt.Fprintf(&b, "%11.6f %d  %-15s %-4s ", offset.Seconds(), rec.Bus+1, id, rec.Dir)
+	if frame.Remote {
+		fmt.Fprintf(&b, "r %X", dlc)
+	} else {
+		fmt.Fprintf(&b, "d %X", dlc)
+		for _, v := range frame.Data[:dlc] {
+			fmt.Fprintf(&b, " %02X", v)
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// ASCReader reads the CAN messages of a Vector ASC log. Lines it does not
+// understand, such as events, statistics and CAN FD messages, are skipped.
+type ASCReader struct {
+	sc       *bufio.Scanner
+	line     int
+	start    time.Time
+	base     int
+	relative bool
+	last     time.Duration
+}
+
+// NewASCReader reads an ASC log from r. Records are timed relative to the
+// "date" header, interpreted in the local time zone; channel n is returned
+// as bus n-1.
+func NewASCReader(r io.Reader) *ASCReader {
+	return &ASCReader{sc: bufio.NewScanner(r), start: time.Unix(0, 0), base: 16}
+}
+
+// Read returns the next CAN message.
+func (ar *ASCReader) Read() (Record, error) {
+	for ar.sc.Scan() {
+		ar.line++
+		fields := strings.Fields(ar.sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var (
+			rec Record
+			ok  bool
+			err error
+		)
+		switch strings.ToLower(fields[0]) {
+		case "date":
+			err = ar.parseDate(fields[1:])
+		case "base":
+			err = ar.parseBase(fields[1:])
+		default:
+			rec, ok, err = ar.parseMessage(fields)
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", ar.line, err)
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	if err := ar.sc.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (ar *ASCReader) parseDate(fields []string) error {
+	value := strings.Join(fields, " ")
+	for _, layout := range ascDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			ar.start = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q", value)
+}
+
+// parseBase reads "base hex|dec  timestamps absolute|relative".
+func (ar *ASCReader) parseBase(fields []string) error {
+	if len(fields) != 3 || fields[1] != "timestamps" {
+		return fmt.Errorf("invalid base line %q", strings.Join(fields, " "))
+	}
+	switch fields[0] {
+	case "hex":
+		ar.base = 16
+	case "dec":
+		ar.base = 10
+	default:
+		return fmt.Errorf("unknown number base %q", fields[0])
+	}
+	switch fields[2] {
+	case "absolute":
+		ar.relative = false
+	case "relative":
+		ar.relative = true
+	default:
+		return fmt.Errorf("unknown timestamp mode %q", fields[2])
+	}
+	return nil
+}
+
+// parseMessage decodes a line of the form
+// "<time> <channel> <id>[x] <Rx|Tx> <d|r> <dlc> <data...>"; ok is false for
+// lines of other kinds.
+func (ar *ASCReader) parseMessage(fields []string) (rec Record, ok bool, err error) {
+	if len(fields) < 5 {
+		return Record{}, false, nil
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return Record{}, false, nil
+	}
+	channel, err := strconv.Atoi(fields[1])
+	if err != nil || channel < 1 {
+		return Record{}, false, nil
+	}
+	switch fields[3] {
+	case "Rx":
+		rec.Dir = Rx
+	case "Tx":
+		rec.Dir = Tx
+	default:
+		return Record{}, false, nil
+	}
+	kind := fields[4]
+	if kind != "d" && kind != "r" {
+		return Record{}, false, nil
+	}
+
+	frame := &rec.Frame
+	idText, extended := strings.CutSuffix(strings.ToLower(fields[2]), "x")
+	id, err := strconv.ParseUint(idText, ar.base, 32)
+	if err != nil || id > 0x1FFFFFFF {
+		return Record{}, false, fmt.Errorf("invalid identifier %q", fields[2])
+	}
+	frame.ID = uint32(id)
+	frame.Extended = extended || id > 0x7FF
+
+	data := fields[5:]
+	if kind == "r" {
+		frame.Remote = true
+		// Older versions write no DLC for remote frames.
+		if len(data) > 0 {
+			if dlc, err := strconv.ParseUint(data[0], 16, 8); err == nil && dlc <= 8 {
+				frame.DLC = uint8(dlc)
+			}
+		}
+	} else {
+		if len(data) == 0 {
+			return Record{}, false, errors.New("missing DLC")
+		}
+		dlc, err := strconv.ParseUint(data[0], 16, 8)
+		if err != nil || dlc > 8 {
+			return Record{}, false, fmt.Errorf("invalid DLC %q", data[0])
+		}
+		frame.DLC = uint8(dlc)
+		if len(data)-1 < int(dlc) {
+			return Record{}, false, fmt.Errorf("expected %d data bytes", dlc)
+		}
+		for i := range frame.DLC {
+			v, err := strconv.ParseUint(data[1+i], ar.base, 8)
+			if err != nil {
+				return Record{}, false, fmt.Errorf("invalid data byte %q", data[1+i])
+			}
+			frame.Data[i] = byte(v)
+		}
+	}
+
+	offset := time.Duration(seconds * float64(time.Second)).Round(time.Microsecond)
+	if ar.relative {
+		offset += ar.last
+	}
+	ar.last = offset
+	rec.Time = ar.start.Add(offset)
+	rec.Bus = channel - 1
+	return rec, true, nil
+}
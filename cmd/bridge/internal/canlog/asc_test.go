@@ -0,0 +1,116 @@
+package canlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestFormatASC(t *testing.T) {
+	cases := []struct {
+		rec  Record
+		want string
+	}{
+		{Record{Frame: ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}}},
+			"   1.250000 1  123             Rx   d 2 CA FE\n"},
+		{Record{Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 0}},
+			"   1.250000 2  18DAF110x       Tx   d 0\n"},
+		{Record{Frame: ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 8}},
+			"   1.250000 1  7FF             Rx   r 8\n"},
+	}
+	for _, tc := range cases {
+		if got := FormatASC(tc.rec, 1250*time.Millisecond); got != tc.want {
+			t.Fatalf("expected %q got %q", tc.want, got)
+		}
+	}
+}
+
+func TestASCRoundTrip(t *testing.T) {
+	start := time.Date(2026, time.October, 18, 14, 5, 6, 789000000, time.Local)
+	records := []Record{
+		{Time: start.Add(12345 * time.Microsecond), Frame: ebyte.Frame{ID: 0x123, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		{Time: start.Add(time.Second), Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 3, Data: [8]byte{0xAA, 0xBB, 0xCC}}},
+		{Time: start.Add(2 * time.Second), Frame: ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 4}},
+		{Time: start.Add(3 * time.Second), Frame: ebyte.Frame{ID: 0x1, Extended: true, Remote: true}},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewASCWriter(&buf, start)
+	if err != nil {
+		t.Fatalf("NewASCWriter returned error: %v", err)
+	}
+	for _, rec := range records {
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "date Sun Oct 18 02:05:06.789 pm 2026\nbase hex  timestamps absolute\n") {
+		t.Fatalf("unexpected header in %q", buf.String())
+	}
+
+	r := NewASCReader(&buf)
+	for i, want := range records {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: Read returned error: %v", i, err)
+		}
+		if !got.Time.Equal(want.Time) || got.Bus != want.Bus || got.Dir != want.Dir || got.Frame != want.Frame {
+			t.Fatalf("record %d: expected %+v got %+v", i, want, got)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestASCReaderVariants(t *testing.T) {
+	log := `date Thu Apr 28 10:44:52 am 2022
+base dec  timestamps relative
+// version 9.0.0
+Begin Triggerblock Thu Apr 28 10:44:52 am 2022
+   0.000000 Start of measurement
+   0.100000 1  291             Rx   d 2 202 254
+   0.050000 1  Statistic: D 0 R 0 XD 0 XR 0 E 0 O 0 B 0.00%
+   0.200000 2  2047            Rx   r
+   0.300000 1  ErrorFrame
+End TriggerBlock
+`
+	r := NewASCReader(strings.NewReader(log))
+	start := time.Date(2022, time.April, 28, 10, 44, 52, 0, time.Local)
+
+	rec, err := r.Read()
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	want := ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}}
+	if rec.Frame != want || !rec.Time.Equal(start.Add(100*time.Millisecond)) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	rec, err = r.Read()
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	// Relative timestamps add up from message to message.
+	if rec.Bus != 1 || !rec.Frame.Remote || rec.Frame.ID != 0x7FF || !rec.Time.Equal(start.Add(300*time.Millisecond)) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestASCReaderReportsLine(t *testing.T) {
+	r := NewASCReader(strings.NewReader("base hex  timestamps absolute\n   0.1 1  123  Rx   d 4 01 02\n"))
+	_, err := r.Read()
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected error for line 2, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package canlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// canErrFlag marks error frames in the identifiers of candump logs.
+const canErrFlag = 0x20000000
+
+// CandumpWriter writes records in the log file format of `candump -L`:
+//
+//	(1436509052.249713) can0 123#DEADBEEF
+//
+// Remote frames are written as "123#R" followed by the DLC if it is not
+// zero. The "##" separator is reserved for CAN FD frames, which the adapter
+// does not deliver.
+type CandumpWriter struct {
+	w          *bufio.Writer
+	closer     io.Closer
+	interfaces []string
+}
+
+// NewCandumpWriter writes to w and names bus n after interfaces[n], or
+// "can<n>" if no name is given. If w is an io.Closer, Close closes it.
+func NewCandumpWriter(w io.Writer, interfaces []string) *CandumpWriter {
+	cw := &CandumpWriter{w: bufio.NewWriter(w), interfaces: interfaces}
+	if c, ok := w.(io.Closer); ok {
+		cw.closer = c
+	}
+	return cw
+}
+
+// WriteRecord writes one log line.
+func (cw *CandumpWriter) WriteRecord(rec Record) error {
+	_, err := cw.w.WriteString(FormatCandump(rec, busName(cw.interfaces, rec.Bus, "can")))
+	return err
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (cw *CandumpWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// Close flushes and closes the underlying writer.
+func (cw *CandumpWriter) Close() error {
+	return closeBuffered(cw.w, cw.closer)
+}
+
+// FormatCandump renders rec as a candump log line for the given interface,
+// including the trailing newline.
+func FormatCandump(rec Record, iface string) string {
+	var b strings.Builder
+	ts := rec.Time
+	fmt.Fprintf(&b, "(%d.%06d) %s ", ts.Unix(), ts.Nanosecond()/1000, iface)
+
+	frame := rec.Frame
+	if frame.Extended {
+		fmt.Fprintf(&b, "%08X#", frame.ID&0x1FFFFFFF)
+	} else {
+		fmt.Fprintf(&b, "%03X#", frame.ID&0x7FF)
+	}
+	if frame.Remote {
+		b.WriteByte('R')
+		if frame.DLC > 0 && frame.DLC <= 8 {
+			fmt.Fprintf(&b, "%X", frame.DLC)
+		}
+	} else {
+		for i := uint8(0); i < frame.DLC && i < 8; i++ {
+			fmt.Fprintf(&b, "%02X", frame.Data[i])
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// CandumpReader reads candump log files. Buses are numbered in the order in
+// which their interface names first appear. CAN FD and error frames are
+// skipped.
+type CandumpReader struct {
+	sc    *bufio.Scanner
+	line  int
+	buses map[string]int
+}
+
+// NewCandumpReader reads a candump log from r.
+func NewCandumpReader(r io.Reader) *CandumpReader {
+	return &CandumpReader{sc: bufio.NewScanner(r), buses: make(map[string]int)}
+}
+
+// Read returns the next classic CAN frame.
+func (cr *CandumpReader) Read() (Record, error) {
+	for cr.sc.Scan() {
+		cr.line++
+		fields := strings.Fields(cr.sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rec, ok, err := cr.parseLine(fields)
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", cr.line, err)
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	if err := cr.sc.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// parseLine decodes "(sec.usec) iface ID#DATA"; ok is false for frames that
+// are skipped.
+func (cr *CandumpReader) parseLine(fields []string) (rec Record, ok bool, err error) {
+	if len(fields) < 3 {
+		return Record{}, false, errors.New("expected timestamp, interface and frame")
+	}
+	ts, found := strings.CutPrefix(fields[0], "(")
+	ts, closed := strings.CutSuffix(ts, ")")
+	if !found || !closed {
+		return Record{}, false, fmt.Errorf("invalid timestamp %q", fields[0])
+	}
+	sec, frac, _ := strings.Cut(ts, ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("invalid timestamp %q", fields[0])
+	}
+	var nsec int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		n, err := strconv.ParseInt(frac, 10, 64)
+		if err != nil {
+			return Record{}, false, fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		for i := len(frac); i < 9; i++ {
+			n *= 10
+		}
+		nsec = n
+	}
+	rec.Time = time.Unix(s, nsec)
+
+	idText, data, found := strings.Cut(fields[2], "#")
+	if !found {
+		return Record{}, false, fmt.Errorf("invalid frame %q", fields[2])
+	}
+	if strings.HasPrefix(data, "#") {
+		// CAN FD frame
+		return Record{}, false, nil
+	}
+	id, err := strconv.ParseUint(idText, 16, 32)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("invalid identifier %q", idText)
+	}
+	frame := &rec.Frame
+	switch len(idText) {
+	case 3:
+		if id > 0x7FF {
+			return Record{}, false, fmt.Errorf("invalid identifier %q", idText)
+		}
+	case 8:
+		if id&canErrFlag != 0 {
+			return Record{}, false, nil
+		}
+		if id > 0x1FFFFFFF {
+			return Record{}, false, fmt.Errorf("invalid identifier %q", idText)
+		}
+		frame.Extended = true
+	default:
+		return Record{}, false, fmt.Errorf("invalid identifier %q", idText)
+	}
+	frame.ID = uint32(id)
+
+	// A "_<dlc>" suffix for DLCs above 8 is irrelevant for classic frames.
+	data, _, _ = strings.Cut(data, "_")
+	if rtr, isRemote := strings.CutPrefix(strings.ToUpper(data), "R"); isRemote {
+		frame.Remote = true
+		if rtr != "" {
+			dlc, err := strconv.ParseUint(rtr, 16, 8)
+			if err != nil || dlc > 8 {
+				return Record{}, false, fmt.Errorf("invalid DLC %q", rtr)
+			}
+			frame.DLC = uint8(dlc)
+		}
+	} else {
+		if len(data)%2 != 0 || len(data) > 16 {
+			return Record{}, false, fmt.Errorf("invalid data %q", data)
+		}
+		raw, err := hex.DecodeString(data)
+		if err != nil {
+			return Record{}, false, fmt.Errorf("invalid data %q", data)
+		}
+		frame.DLC = uint8(copy(frame.Data[:], raw))
+	}
+
+	bus, known := cr.buses[fields[1]]
+	if !known {
+		bus = len(cr.buses)
+		cr.buses[fields[1]] = bus
+	}
+	rec.Bus = bus
+	// candump -L appends the direction as "R" or "T" with -x.
+	if len(fields) > 3 && fields[3] == "T" {
+		rec.Dir = Tx
+	}
+	return rec, true, nil
+}
@@ -0,0 +1,95 @@
+package canlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestFormatCandump(t *testing.T) {
+	at := time.Unix(1436509052, 249713000)
+	cases := []struct {
+		frame ebyte.Frame
+		want  string
+	}{
+		{ebyte.Frame{ID: 0x123, DLC: 4, Data: [8]byte{0xDE, 0xAD, 0xBE, 0xEF}}, "(1436509052.249713) can0 123#DEADBEEF\n"},
+		{ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 0}, "(1436509052.249713) can0 18DAF110#\n"},
+		{ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 8}, "(1436509052.249713) can0 7FF#R8\n"},
+		{ebyte.Frame{ID: 0x1, Extended: true, Remote: true}, "(1436509052.249713) can0 00000001#R\n"},
+	}
+	for _, tc := range cases {
+		if got := FormatCandump(Record{Time: at, Frame: tc.frame}, "can0"); got != tc.want {
+			t.Fatalf("expected %q got %q", tc.want, got)
+		}
+	}
+}
+
+func TestCandumpWriterInterfaces(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCandumpWriter(&buf, []string{"vcan0"})
+	at := time.Unix(1, 5000)
+	for bus := 0; bus < 2; bus++ {
+		if err := w.WriteRecord(Record{Time: at, Bus: bus, Frame: ebyte.Frame{ID: 0x10, DLC: 1, Data: [8]byte{0xFF}}}); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	want := "(1.000005) vcan0 010#FF\n(1.000005) can1 010#FF\n"
+	if buf.String() != want {
+		t.Fatalf("expected %q got %q", want, buf.String())
+	}
+}
+
+func TestCandumpReader(t *testing.T) {
+	log := `(1436509052.249713) can0 123#DEADBEEF
+(1436509052.250000) vcan1 18DAF110#R3 T
+(1436509052.3) can0 7FF#
+(1436509052.400000) can0 123##1112233
+(1436509052.500000) can0 20000080#0000000000000000
+(1436509052.600000) vcan1 00000001#R
+`
+	r := NewCandumpReader(strings.NewReader(log))
+	want := []Record{
+		{Time: time.Unix(1436509052, 249713000), Frame: ebyte.Frame{ID: 0x123, DLC: 4, Data: [8]byte{0xDE, 0xAD, 0xBE, 0xEF}}},
+		{Time: time.Unix(1436509052, 250000000), Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x18DAF110, Extended: true, Remote: true, DLC: 3}},
+		{Time: time.Unix(1436509052, 300000000), Frame: ebyte.Frame{ID: 0x7FF}},
+		{Time: time.Unix(1436509052, 600000000), Bus: 1, Frame: ebyte.Frame{ID: 0x1, Extended: true, Remote: true}},
+	}
+	for i, w := range want {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: Read returned error: %v", i, err)
+		}
+		if !got.Time.Equal(w.Time) || got.Bus != w.Bus || got.Dir != w.Dir || got.Frame != w.Frame {
+			t.Fatalf("record %d: expected %+v got %+v", i, w, got)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestCandumpRoundTrip(t *testing.T) {
+	rec := Record{Time: time.Unix(1, 5000), Frame: ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}
+	got, err := NewCandumpReader(strings.NewReader(FormatCandump(rec, "can0"))).Read()
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if !got.Time.Equal(rec.Time) || got.Frame != rec.Frame {
+		t.Fatalf("expected %+v got %+v", rec, got)
+	}
+}
+
+func TestCandumpReaderReportsLine(t *testing.T) {
+	_, err := NewCandumpReader(strings.NewReader("\n(1.0) can0 1234#00\n")).Read()
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected error for line 2, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package canlog reads and writes CAN trace files in the formats of common
+// tools, such as the candump log format of the Linux can-utils.
+package canlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// Direction tells whether a frame was received from the bus or transmitted
+// onto it.
+type Direction int
+
+const (
+	Rx Direction = iota
+	Tx
+)
+
+func (d Direction) String() string {
+	if d == Tx {
+		return "Tx"
+	}
+	return "Rx"
+}
+
+// Record is a frame together with the time and bus it was seen on.
+type Record struct {
+	Time  time.Time
+	Bus   int
+	Dir   Direction
+	Frame ebyte.Frame
+}
+
+// Writer is implemented by the trace format writers.
+type Writer interface {
+	// WriteRecord appends a record to the trace; output may be buffered.
+	WriteRecord(rec Record) error
+	// Flush writes buffered output.
+	Flush() error
+	// Close flushes and closes the underlying file, if the writer owns it.
+	Close() error
+}
+
+// Reader is implemented by the trace format readers.
+type Reader interface {
+	// Read returns the next record, or io.EOF at the end of the trace.
+	Read() (Record, error)
+}
+
+// busName returns the configured name of bus or a default derived from
+// prefix and the bus number.
+func busName(names []string, bus int, prefix string) string {
+	if bus >= 0 && bus < len(names) && names[bus] != "" {
+		return names[bus]
+	}
+	return fmt.Sprintf("%s%d", prefix, bus)
+}
+
+// closeBuffered flushes w and closes closer, if set.
+func closeBuffered(w *bufio.Writer, closer io.Closer) error {
+	err := w.Flush()
+	if closer != nil {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package canlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// LinkTypeCANSocketCAN is the link-layer header type of SocketCAN frames in
+// PCAP and PCAPNG files.
+const LinkTypeCANSocketCAN = 227
+
+// SocketCAN identifier flags.
+const (
+	canEFFFlag = 0x80000000
+	canRTRFlag = 0x40000000
+)
+
+// socketCANFrameSize is the size of a classic struct can_frame.
+const socketCANFrameSize = 16
+
+// pcapSnapLen is the snapshot length announced in the file headers.
+const pcapSnapLen = 262144
+
+// socketCANFrame encodes rec as a struct can_frame with the identifier in
+// network byte order, as LINKTYPE_CAN_SOCKETCAN requires.
+func socketCANFrame(rec Record) []byte {
+	frame := rec.Frame
+	id := frame.ID
+	if frame.Extended {
+		id = id&0x1FFFFFFF | canEFFFlag
+	} else {
+		id &= 0x7FF
+	}
+	if frame.Remote {
+		id |= canRTRFlag
+	}
+	buf := make([]byte, socketCANFrameSize)
+	binary.BigEndian.PutUint32(buf[0:4], id)
+	buf[4] = min(frame.DLC, 8)
+	if !frame.Remote {
+		copy(buf[8:], frame.Data[:buf[4]])
+	}
+	return buf
+}
+
+// PcapWriter writes classic PCAP files with nanosecond timestamps. The
+// format has no notion of interfaces or direction, so bus and direction of
+// the records are not preserved.
+type PcapWriter struct {
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewPcapWriter writes the file header to w. If w is an io.Closer, Close
+// closes it.
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	pw := &PcapWriter{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		pw.closer = c
+	}
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:4], 0xA1B23C4D) // nanosecond resolution
+	binary.LittleEndian.PutUint16(hdr[4:6], 2)
+	binary.LittleEndian.PutUint16(hdr[6:8], 4)
+	binary.LittleEndian.PutUint32(hdr[16:20], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:24], LinkTypeCANSocketCAN)
+	if _, err := pw.w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteRecord writes one packet record.
+func (pw *PcapWriter) WriteRecord(rec Record) error {
+	data := socketCANFrame(rec)
+	hdr := make([]byte, 16)
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(rec.Time.Unix()))
+	binary.LittleEndian.PutUint32(hdr[4:8], uint32(rec.Time.Nanosecond()))
+	binary.LittleEndian.PutUint32(hdr[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(hdr[12:16], uint32(len(data)))
+	if _, err := pw.w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(data)
+	return err
+}
+
+// Flush writes buffered records to the underlying writer.
+func (pw *PcapWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// Close flushes and closes the underlying writer.
+func (pw *PcapWriter) Close() error {
+	return closeBuffered(pw.w, pw.closer)
+}
+
+// PCAPNG block types and options.
+const (
+	pcapngSectionHeader      = 0x0A0D0D0A
+	pcapngInterfaceDesc      = 0x00000001
+	pcapngEnhancedPacket     = 0x00000006
+	pcapngByteOrderMagic     = 0x1A2B3C4D
+	pcapngOptEnd             = 0
+	pcapngOptSHBUserAppl     = 4
+	pcapngOptIfName          = 2
+	pcapngOptIfTSResol       = 9
+	pcapngOptEPBFlags        = 2
+	pcapngFlagInbound        = 1
+	pcapngFlagOutbound       = 2
+	pcapngNanosecondsTSResol = 9
+)
+
+// PcapNGWriter writes PCAPNG files. Each bus gets its own interface, which
+// is described when the first record of the bus is written, and each packet
+// carries its direction in the epb_flags option.
+type PcapNGWriter struct {
+	w          *bufio.Writer
+	closer     io.Closer
+	interfaces []string
+	// ifaces maps a bus to its interface ID in the section.
+	ifaces map[int]uint32
+}
+
+// NewPcapNGWriter writes the section header to w. Bus n is described with
+// the name interfaces[n], or "can<n>" if no name is given. If w is an
+// io.Closer, Close closes it.
+func NewPcapNGWriter(w io.Writer, interfaces []string) (*PcapNGWriter, error) {
+	pw := &PcapNGWriter{w: bufio.NewWriter(w), interfaces: interfaces, ifaces: make(map[int]uint32)}
+	if c, ok := w.(io.Closer); ok {
+		pw.closer = c
+	}
+
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	binary.LittleEndian.PutUint16(body[6:8], 0)
+	// section length unknown
+	binary.LittleEndian.PutUint64(body[8:16], ^uint64(0))
+	body = appendOption(body, pcapngOptSHBUserAppl, []byte("ebyte_can_ethernet_to_slcan bridge"))
+	body = appendOption(body, pcapngOptEnd, nil)
+	if err := pw.writeBlock(pcapngSectionHeader, body); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteRecord writes one enhanced packet block, preceded by the interface
+// description of the record's bus if it is the first record on that bus.
+func (pw *PcapNGWriter) WriteRecord(rec Record) error {
+	id, ok := pw.ifaces[rec.Bus]
+	if !ok {
+		id = uint32(len(pw.ifaces))
+		if err := pw.writeInterface(busName(pw.interfaces, rec.Bus, "can")); err != nil {
+			return err
+		}
+		pw.ifaces[rec.Bus] = id
+	}
+
+	data := socketCANFrame(rec)
+	ts := uint64(rec.Time.UnixNano())
+	body := make([]byte, 20, 20+len(data)+12)
+	binary.LittleEndian.PutUint32(body[0:4], id)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(len(data)))
+	body = append(body, data...)
+	body = appendPadding(body)
+
+	flags := make([]byte, 4)
+	if rec.Dir == Tx {
+		binary.LittleEndian.PutUint32(flags, pcapngFlagOutbound)
+	} else {
+		binary.LittleEndian.PutUint32(flags, pcapngFlagInbound)
+	}
+	body = appendOption(body, pcapngOptEPBFlags, flags)
+	body = appendOption(body, pcapngOptEnd, nil)
+	return pw.writeBlock(pcapngEnhancedPacket, body)
+}
+
+func (pw *PcapNGWriter) writeInterface(name string) error {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], LinkTypeCANSocketCAN)
+	binary.LittleEndian.PutUint32(body[4:8], pcapSnapLen)
+	body = appendOption(body, pcapngOptIfName, []byte(name))
+	body = appendOption(body, pcapngOptIfTSResol, []byte{pcapngNanosecondsTSResol})
+	body = appendOption(body, pcapngOptEnd, nil)
+	return pw.writeBlock(pcapngInterfaceDesc, body)
+}
+
+// writeBlock frames body, whose length must be a multiple of four, with the
+// block type and the leading and trailing total length.
+func (pw *PcapNGWriter) writeBlock(blockType uint32, body []byte) error {
+	total := uint32(12 + len(body))
+	hdr := make([]byte, 8)
+	binary.LittleEndian.PutUint32(hdr[0:4], blockType)
+	binary.LittleEndian.PutUint32(hdr[4:8], total)
+	if _, err := pw.w.Write(hdr); err != nil {
+		return err
+	}
+	if _, err := pw.w.Write(body); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(hdr[4:8])
+	return err
+}
+
+// Flush writes buffered blocks to the underlying writer.
+func (pw *PcapNGWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// Close flushes and closes the underlying writer.
+func (pw *PcapNGWriter) Close() error {
+	return closeBuffered(pw.w, pw.closer)
+}
+
+// appendOption appends a PCAPNG option padded to 32 bits.
+func appendOption(buf []byte, code uint16, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, code)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	return appendPadding(buf)
+}
+
+func appendPadding(buf []byte) []byte {
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
@@ -0,0 +1,189 @@
+package canlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestSocketCANFrame(t *testing.T) {
+	cases := []struct {
+		frame ebyte.Frame
+		want  []byte
+	}{
+		{ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}},
+			[]byte{0x00, 0x00, 0x01, 0x23, 2, 0, 0, 0, 0xCA, 0xFE, 0, 0, 0, 0, 0, 0}},
+		{ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 1, Data: [8]byte{0x01}},
+			[]byte{0x98, 0xDA, 0xF1, 0x10, 1, 0, 0, 0, 0x01, 0, 0, 0, 0, 0, 0, 0}},
+		{ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 8, Data: [8]byte{0xFF}},
+			[]byte{0x40, 0x00, 0x07, 0xFF, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tc := range cases {
+		if got := socketCANFrame(Record{Frame: tc.frame}); !bytes.Equal(got, tc.want) {
+			t.Fatalf("frame %+v: expected % X got % X", tc.frame, tc.want, got)
+		}
+	}
+}
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPcapWriter(&buf)
+	if err != nil {
+		t.Fatalf("NewPcapWriter returned error: %v", err)
+	}
+	at := time.Unix(1436509052, 249713123)
+	if err := w.WriteRecord(Record{Time: at, Frame: ebyte.Frame{ID: 0x10, DLC: 1, Data: [8]byte{0xFF}}}); err != nil {
+		t.Fatalf("WriteRecord returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	data := buf.Bytes()
+	if len(data) != 24+16+socketCANFrameSize {
+		t.Fatalf("unexpected file size %d", len(data))
+	}
+	if magic := binary.LittleEndian.Uint32(data[0:4]); magic != 0xA1B23C4D {
+		t.Fatalf("unexpected magic 0x%08X", magic)
+	}
+	if lt := binary.LittleEndian.Uint32(data[20:24]); lt != LinkTypeCANSocketCAN {
+		t.Fatalf("unexpected link type %d", lt)
+	}
+	rec := data[24:]
+	if sec, nsec := binary.LittleEndian.Uint32(rec[0:4]), binary.LittleEndian.Uint32(rec[4:8]); sec != 1436509052 || nsec != 249713123 {
+		t.Fatalf("unexpected timestamp %d.%09d", sec, nsec)
+	}
+	if n := binary.LittleEndian.Uint32(rec[8:12]); n != socketCANFrameSize {
+		t.Fatalf("unexpected captured length %d", n)
+	}
+}
+
+// pcapngBlock is a parsed PCAPNG block.
+type pcapngBlock struct {
+	typ  uint32
+	body []byte
+}
+
+func readPcapNGBlocks(t *testing.T, data []byte) []pcapngBlock {
+	t.Helper()
+	var blocks []pcapngBlock
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block header")
+		}
+		typ := binary.LittleEndian.Uint32(data[0:4])
+		total := binary.LittleEndian.Uint32(data[4:8])
+		if total%4 != 0 || int(total) > len(data) {
+			t.Fatalf("invalid block length %d", total)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[total-4 : total]); trailer != total {
+			t.Fatalf("block length mismatch: %d vs %d", total, trailer)
+		}
+		blocks = append(blocks, pcapngBlock{typ: typ, body: data[8 : total-4]})
+		data = data[total:]
+	}
+	return blocks
+}
+
+// pcapngOptions parses the options at the start of body.
+func pcapngOptions(t *testing.T, body []byte) map[uint16][]byte {
+	t.Helper()
+	opts := make(map[uint16][]byte)
+	for len(body) >= 4 {
+		code := binary.LittleEndian.Uint16(body[0:2])
+		n := int(binary.LittleEndian.Uint16(body[2:4]))
+		if code == pcapngOptEnd {
+			return opts
+		}
+		padded := (n + 3) &^ 3
+		if 4+padded > len(body) {
+			t.Fatalf("truncated option %d", code)
+		}
+		opts[code] = body[4 : 4+n]
+		body = body[4+padded:]
+	}
+	t.Fatalf("missing end of options")
+	return nil
+}
+
+func TestPcapNGWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPcapNGWriter(&buf, []string{"vcan0"})
+	if err != nil {
+		t.Fatalf("NewPcapNGWriter returned error: %v", err)
+	}
+	at := time.Unix(1436509052, 249713123)
+	records := []Record{
+		{Time: at, Bus: 0, Frame: ebyte.Frame{ID: 0x123, DLC: 1, Data: [8]byte{0xAA}}},
+		{Time: at, Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x456, DLC: 0}},
+		{Time: at.Add(time.Microsecond), Bus: 0, Frame: ebyte.Frame{ID: 0x789, DLC: 0}},
+	}
+	for _, rec := range records {
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	blocks := readPcapNGBlocks(t, buf.Bytes())
+	types := []uint32{pcapngSectionHeader, pcapngInterfaceDesc, pcapngEnhancedPacket, pcapngInterfaceDesc, pcapngEnhancedPacket, pcapngEnhancedPacket}
+	if len(blocks) != len(types) {
+		t.Fatalf("expected %d blocks got %d", len(types), len(blocks))
+	}
+	for i, typ := range types {
+		if blocks[i].typ != typ {
+			t.Fatalf("block %d: expected type 0x%X got 0x%X", i, typ, blocks[i].typ)
+		}
+	}
+	if magic := binary.LittleEndian.Uint32(blocks[0].body[0:4]); magic != pcapngByteOrderMagic {
+		t.Fatalf("unexpected byte-order magic 0x%08X", magic)
+	}
+
+	for i, name := range map[int]string{1: "vcan0", 3: "can1"} {
+		idb := blocks[i].body
+		if lt := binary.LittleEndian.Uint16(idb[0:2]); lt != LinkTypeCANSocketCAN {
+			t.Fatalf("interface %s: unexpected link type %d", name, lt)
+		}
+		opts := pcapngOptions(t, idb[8:])
+		if got := string(opts[pcapngOptIfName]); got != name {
+			t.Fatalf("expected interface name %q got %q", name, got)
+		}
+		if got := opts[pcapngOptIfTSResol]; !bytes.Equal(got, []byte{9}) {
+			t.Fatalf("unexpected timestamp resolution % X", got)
+		}
+	}
+
+	cases := []struct {
+		block int
+		iface uint32
+		ts    uint64
+		flags uint32
+	}{
+		{2, 0, uint64(at.UnixNano()), pcapngFlagInbound},
+		{4, 1, uint64(at.UnixNano()), pcapngFlagOutbound},
+		{5, 0, uint64(at.UnixNano()) + 1000, pcapngFlagInbound},
+	}
+	for _, tc := range cases {
+		epb := blocks[tc.block].body
+		if iface := binary.LittleEndian.Uint32(epb[0:4]); iface != tc.iface {
+			t.Fatalf("block %d: expected interface %d got %d", tc.block, tc.iface, iface)
+		}
+		ts := uint64(binary.LittleEndian.Uint32(epb[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(epb[8:12]))
+		if ts != tc.ts {
+			t.Fatalf("block %d: expected timestamp %d got %d", tc.block, tc.ts, ts)
+		}
+		n := binary.LittleEndian.Uint32(epb[12:16])
+		if n != socketCANFrameSize {
+			t.Fatalf("block %d: unexpected captured length %d", tc.block, n)
+		}
+		opts := pcapngOptions(t, epb[20+n:])
+		if flags := binary.LittleEndian.Uint32(opts[pcapngOptEPBFlags]); flags != tc.flags {
+			t.Fatalf("block %d: expected flags %d got %d", tc.block, tc.flags, flags)
+		}
+	}
+}
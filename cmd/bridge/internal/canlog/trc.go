@@ -0,0 +1,337 @@
+package canlog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// TRCWriter writes records in the PEAK TRC 2.1 format read by PCAN-View and
+// the PCAN-Explorer:
+//
+//	;$FILEVERSION=2.1
+//	;$STARTTIME=46313.4271562153
+//	;$COLUMNS=N,O,T,B,I,d,R,L,D
+//	...
+//	      1         1.040 DT 1      0123 Rx -  2    CA FE
+//	      2      1000.000 RR 2  18DAF110 Tx -  3
+//
+// Message numbers start at 1 in every file, offsets are milliseconds since
+// the start time in the header, and bus n is written as bus n+1.
+type TRCWriter struct {
+	w      *bufio.Writer
+	closer io.Closer
+	start  time.Time
+	number uint64
+}
+
+// NewTRCWriter writes the header with the given start time to w. If w is an
+// io.Closer, Close closes it.
+func NewTRCWriter(w io.Writer, start time.Time) (*TRCWriter, error) {
+	// $STARTTIME is not precise beyond milliseconds, so offsets are taken
+	// from a start time that readers can restore exactly.
+	start = start.Truncate(time.Millisecond)
+	tw := &TRCWriter{w: bufio.NewWriter(w), start: start}
+	if c, ok := w.(io.Closer); ok {
+		tw.closer = c
+	}
+	lines := []string{
+		";$FILEVERSION=2.1",
+		";$STARTTIME=" + strconv.FormatFloat(trcStartTime(start), 'f', 10, 64),
+		";$COLUMNS=N,O,T,B,I,d,R,L,D",
+		";",
+		";   Start time: " + start.Format("02.01.2006 15:04:05.000") + ".0",
+		";   Generated by ebyte_can_ethernet_to_slcan bridge",
+		";-------------------------------------------------------------------------------",
+		";   Message   Time    Type    ID     Rx/Tx",
+		";   Number    Offset  |  Bus  [hex]  |  Reserved",
+		";   |         [ms]    |  |    |      |  |  Data Length Code",
+		";   |         |       |  |    |      |  |  |    Data [hex] ...",
+		";   |         |       |  |    |      |  |  |    |",
+		";---+-- ------+------ +- +- --+----- +- +- +--- +- -- -- -- -- -- -- --",
+	}
+	if _, err := tw.w.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return nil, err
+	}
+	return tw, nil
+}
+
+// trcStartTime returns t as the number of days since 30 December 1899 in
+// t's wall clock time, the OLE automation date used by $STARTTIME.
+func trcStartTime(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// WriteRecord writes one message line.
+func (tw *TRCWriter) WriteRecord(rec Record) error {
+	tw.number++
+	_, err := tw.w.WriteString(FormatTRC(rec, tw.number, rec.Time.Sub(tw.start)))
+	return err
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (tw *TRCWriter) Flush() error {
+	return tw.w.Flush()
+}
+
+// Close flushes and closes the underlying writer.
+func (tw *TRCWriter) Close() error {
+	return closeBuffered(tw.w, tw.closer)
+}
+
+// FormatTRC renders rec as a TRC 2.1 message line with the given message
+// number and offset from the start time, including the trailing newline.
+// Data frames have the type "DT" and remote frames "RR".
+func FormatTRC(rec Record, number uint64, offset time.Duration) string {
+	var b strings.Builder
+	frame := rec.Frame
+	kind := "DT"
+	if frame.Remote {
+		kind = "RR"
+	}
+	id := fmt.Sprintf("%04X", frame.ID&0x7FF)
+	if frame.Extended {
+		id = fmt.Sprintf("%08X", frame.ID&0x1FFFFFFF)
+	}
+	dlc := min(frame.DLC, 8)
+	fmt.Fprintf(&b, "%7d %13.3f %s %-2d %8s %s -  %-4d", number, float64(offset)/float64(time.Millisecond), kind, rec.Bus+1, id, rec.Dir, dlc)
+	if !frame.Remote {
+		for _, v := range frame.Data[:dlc] {
+			fmt.Fprintf(&b, " %02X", v)
+		}
+	}
+	return strings.TrimRight(b.String(), " ") + "\n"
+}
+
+// trcColumnsV20 are the columns of TRC 2.0 files, which predate $COLUMNS.
+var trcColumnsV20 = []string{"N", "O", "T", "I", "d", "l", "D"}
+
+// TRCReader reads the CAN messages of PEAK TRC files in versions 1.1, 2.0
+// and 2.1. Records are timed relative to the start time in the header,
+// interpreted in the local time zone; bus n is returned as bus n-1. Lines
+// other than data and remote frames are skipped.
+type TRCReader struct {
+	sc      *bufio.Scanner
+	line    int
+	start   time.Time
+	version string
+	columns []string
+}
+
+// NewTRCReader reads a TRC file from r.
+func NewTRCReader(r io.Reader) *TRCReader {
+	return &TRCReader{sc: bufio.NewScanner(r), start: time.Unix(0, 0), version: "1.1"}
+}
+
+// Read returns the next CAN message.
+func (tr *TRCReader) Read() (Record, error) {
+	for tr.sc.Scan() {
+		tr.line++
+		text := strings.TrimSpace(tr.sc.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, ";") {
+			if err := tr.parseHeader(text); err != nil {
+				return Record{}, fmt.Errorf("line %d: %w", tr.line, err)
+			}
+			continue
+		}
+		var (
+			rec Record
+			ok  bool
+			err error
+		)
+		if tr.version == "1.1" {
+			rec, ok, err = tr.parseV11(strings.Fields(text))
+		} else {
+			rec, ok, err = tr.parseV2(strings.Fields(text))
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", tr.line, err)
+		}
+		if ok {
+			return rec, nil
+		}
+	}
+	if err := tr.sc.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (tr *TRCReader) parseHeader(text string) error {
+	switch {
+	case strings.HasPrefix(text, ";$FILEVERSION="):
+		tr.version = strings.TrimPrefix(text, ";$FILEVERSION=")
+		if tr.version == "2.0" {
+			tr.columns = trcColumnsV20
+		}
+	case strings.HasPrefix(text, ";$STARTTIME="):
+		days, err := strconv.ParseFloat(strings.TrimPrefix(text, ";$STARTTIME="), 64)
+		if err != nil {
+			return fmt.Errorf("invalid start time %q", text)
+		}
+		tr.start = trcTime(days)
+	case strings.HasPrefix(text, ";$COLUMNS="):
+		tr.columns = strings.Split(strings.TrimPrefix(text, ";$COLUMNS="), ",")
+	default:
+		// Version 1.1 files only carry the start time in a comment.
+		value, ok := strings.CutPrefix(text, ";   Start time: ")
+		if !ok || tr.version != "1.1" {
+			return nil
+		}
+		value = strings.TrimSpace(value)
+		for _, layout := range []string{"02.01.2006 15:04:05.000.0", "02.01.2006 15:04:05.000"} {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				tr.start = t
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// trcTime converts an OLE automation date to the local wall clock time,
+// rounded to milliseconds.
+func trcTime(days float64) time.Time {
+	wall := time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC).Add(time.Duration(days * 24 * float64(time.Hour)))
+	wall = wall.Round(time.Millisecond)
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), time.Local)
+}
+
+// parseV2 decodes a message line according to the $COLUMNS header.
+func (tr *TRCReader) parseV2(fields []string) (rec Record, ok bool, err error) {
+	var dlc uint64
+	var data []string
+	for i, col := range tr.columns {
+		if col == "D" {
+			data = fields[min(i, len(fields)):]
+			break
+		}
+		if i >= len(fields) {
+			return Record{}, false, errors.New("missing columns")
+		}
+		value := fields[i]
+		switch col {
+		case "O":
+			ms, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Record{}, false, fmt.Errorf("invalid offset %q", value)
+			}
+			rec.Time = tr.start.Add(time.Duration(ms * float64(time.Millisecond)).Round(time.Microsecond))
+		case "T":
+			switch value {
+			case "DT":
+			case "RR":
+				rec.Frame.Remote = true
+			default:
+				// CAN FD, error and status lines
+				return Record{}, false, nil
+			}
+		case "B":
+			bus, err := strconv.Atoi(value)
+			if err != nil || bus < 1 {
+				return Record{}, false, fmt.Errorf("invalid bus %q", value)
+			}
+			rec.Bus = bus - 1
+		case "I":
+			if err := parseTRCID(&rec.Frame, value); err != nil {
+				return Record{}, false, err
+			}
+		case "d":
+			if rec.Dir, err = parseTRCDirection(value); err != nil {
+				return Record{}, false, err
+			}
+		case "l", "L":
+			if dlc, err = strconv.ParseUint(value, 10, 8); err != nil || dlc > 8 {
+				return Record{}, false, fmt.Errorf("invalid DLC %q", value)
+			}
+		}
+	}
+	if err := setTRCData(&rec.Frame, dlc, data); err != nil {
+		return Record{}, false, err
+	}
+	return rec, true, nil
+}
+
+// parseV11 decodes "1) 1059.9 Rx 0300 8 00 11 ..." lines; remote frames
+// have "RTR" instead of data.
+func (tr *TRCReader) parseV11(fields []string) (rec Record, ok bool, err error) {
+	if len(fields) < 5 || !strings.HasSuffix(fields[0], ")") {
+		return Record{}, false, nil
+	}
+	ms, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return Record{}, false, fmt.Errorf("invalid offset %q", fields[1])
+	}
+	rec.Time = tr.start.Add(time.Duration(ms * float64(time.Millisecond)).Round(time.Microsecond))
+	if fields[2] != "Rx" && fields[2] != "Tx" {
+		// error and warning lines
+		return Record{}, false, nil
+	}
+	rec.Dir, _ = parseTRCDirection(fields[2])
+	if err := parseTRCID(&rec.Frame, fields[3]); err != nil {
+		return Record{}, false, err
+	}
+	dlc, err := strconv.ParseUint(fields[4], 10, 8)
+	if err != nil || dlc > 8 {
+		return Record{}, false, fmt.Errorf("invalid DLC %q", fields[4])
+	}
+	data := fields[5:]
+	if len(data) > 0 && data[0] == "RTR" {
+		rec.Frame.Remote = true
+	}
+	if err := setTRCData(&rec.Frame, dlc, data); err != nil {
+		return Record{}, false, err
+	}
+	return rec, true, nil
+}
+
+// parseTRCID decodes a hex identifier; PEAK writes extended identifiers
+// with eight digits.
+func parseTRCID(frame *ebyte.Frame, value string) error {
+	id, err := strconv.ParseUint(value, 16, 32)
+	if err != nil || id > 0x1FFFFFFF {
+		return fmt.Errorf("invalid identifier %q", value)
+	}
+	frame.ID = uint32(id)
+	frame.Extended = len(value) > 4 || id > 0x7FF
+	return nil
+}
+
+func parseTRCDirection(value string) (Direction, error) {
+	switch value {
+	case "Rx":
+		return Rx, nil
+	case "Tx":
+		return Tx, nil
+	}
+	return Rx, fmt.Errorf("invalid direction %q", value)
+}
+
+// setTRCData stores the DLC and, for data frames, the data bytes.
+func setTRCData(frame *ebyte.Frame, dlc uint64, data []string) error {
+	frame.DLC = uint8(dlc)
+	if frame.Remote {
+		return nil
+	}
+	if len(data) < int(dlc) {
+		return fmt.Errorf("expected %d data bytes", dlc)
+	}
+	for i := range frame.DLC {
+		v, err := strconv.ParseUint(data[i], 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid data byte %q", data[i])
+		}
+		frame.Data[i] = byte(v)
+	}
+	return nil
+}
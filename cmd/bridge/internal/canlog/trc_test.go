@@ -0,0 +1,140 @@
+package canlog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestFormatTRC(t *testing.T) {
+	cases := []struct {
+		rec  Record
+		want string
+	}{
+		{Record{Frame: ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}}},
+			"     42         1.040 DT 1      0123 Rx -  2    CA FE\n"},
+		{Record{Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 3, Data: [8]byte{1, 2, 3}}},
+			"     42         1.040 DT 2  18DAF110 Tx -  3    01 02 03\n"},
+		{Record{Frame: ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 4}},
+			"     42         1.040 RR 1      07FF Rx -  4\n"},
+	}
+	for _, tc := range cases {
+		if got := FormatTRC(tc.rec, 42, 1040*time.Microsecond); got != tc.want {
+			t.Fatalf("expected %q got %q", tc.want, got)
+		}
+	}
+}
+
+func TestTRCWriter(t *testing.T) {
+	start := time.Date(2026, time.October, 18, 10, 15, 6, 789000000, time.Local)
+	var buf bytes.Buffer
+	w, err := NewTRCWriter(&buf, start)
+	if err != nil {
+		t.Fatalf("NewTRCWriter returned error: %v", err)
+	}
+	for i := range 2 {
+		rec := Record{Time: start.Add(time.Duration(i) * time.Second), Frame: ebyte.Frame{ID: 0x10, DLC: 1, Data: [8]byte{0xFF}}}
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		";$FILEVERSION=2.1\n;$STARTTIME=46313.4271619097\n;$COLUMNS=N,O,T,B,I,d,R,L,D\n",
+		";   Start time: 18.10.2026 10:15:06.789.0\n",
+		"\n      1         0.000 DT 1      0010 Rx -  1    FF\n      2      1000.000 DT 1      0010 Rx -  1    FF\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in %q", want, out)
+		}
+	}
+}
+
+func TestTRCRoundTrip(t *testing.T) {
+	start := time.Date(2026, time.October, 18, 10, 15, 6, 789000000, time.Local)
+	records := []Record{
+		{Time: start.Add(1040 * time.Microsecond), Frame: ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}}},
+		{Time: start.Add(time.Second), Bus: 1, Dir: Tx, Frame: ebyte.Frame{ID: 0x5, Extended: true, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}},
+		{Time: start.Add(2 * time.Second), Frame: ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 4}},
+	}
+	var buf bytes.Buffer
+	w, err := NewTRCWriter(&buf, start)
+	if err != nil {
+		t.Fatalf("NewTRCWriter returned error: %v", err)
+	}
+	for _, rec := range records {
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatalf("WriteRecord returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	r := NewTRCReader(&buf)
+	for i, want := range records {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: Read returned error: %v", i, err)
+		}
+		if !got.Time.Equal(want.Time) || got.Bus != want.Bus || got.Dir != want.Dir || got.Frame != want.Frame {
+			t.Fatalf("record %d: expected %+v got %+v", i, want, got)
+		}
+	}
+	if _, err := r.Read(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestTRCReaderOlderVersions(t *testing.T) {
+	cases := map[string]string{
+		"1.1": `;##########################################################################
+;   Start time: 12.03.2015 10:42:26.166.0
+;   Message Number
+;   |         Time Offset (ms)
+;---+--   ----+----  --+--  ----+---  +  -+ -- -- -- -- -- -- --
+     1)      1059.9  Rx         0300  2  CA FE
+     2)      1060.0  Warng  FFFFFFFF  4  00 00 00 08  BUSHEAVY
+     3)      2059.9  Rx     18DAF110  3  RTR
+`,
+		"2.0": `;$FILEVERSION=2.0
+;$STARTTIME=42075.4461361111
+;---+-- ------+------ +- --+----- +- +- +- -- -- -- -- -- -- --
+      1      1059.900 DT     0300 Rx 2  CA FE
+      2      1060.000 ST          Rx    00 00 00 08
+      3      2059.900 RR 18DAF110 Rx 3
+`,
+	}
+	for version, log := range cases {
+		r := NewTRCReader(strings.NewReader(log))
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatalf("%s: Read returned error: %v", version, err)
+		}
+		if rec.Frame != (ebyte.Frame{ID: 0x300, DLC: 2, Data: [8]byte{0xCA, 0xFE}}) {
+			t.Fatalf("%s: unexpected frame %+v", version, rec.Frame)
+		}
+		if rec.Time.Year() != 2015 || rec.Time.Hour() != 10 || rec.Time.Minute() != 42 {
+			t.Fatalf("%s: unexpected time %v", version, rec.Time)
+		}
+		next, err := r.Read()
+		if err != nil {
+			t.Fatalf("%s: Read returned error: %v", version, err)
+		}
+		if next.Frame != (ebyte.Frame{ID: 0x18DAF110, Extended: true, Remote: true, DLC: 3}) || next.Time.Sub(rec.Time) != time.Second {
+			t.Fatalf("%s: unexpected record %+v", version, next)
+		}
+		if _, err := r.Read(); !errors.Is(err, io.EOF) {
+			t.Fatalf("%s: expected io.EOF, got %v", version, err)
+		}
+	}
+}
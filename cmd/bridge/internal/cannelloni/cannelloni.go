@@ -0,0 +1,207 @@
+// Package cannelloni encodes and decodes the UDP packets of cannelloni, which
+// tunnels CAN frames between two hosts in batches with sequence numbers.
+package cannelloni
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// Version is the protocol version written into and expected in every packet
+// header.
+const Version = 2
+
+// Operation codes of the packet header. Only data packets are sent; the
+// acknowledgement codes are defined by the protocol but not used by
+// cannelloni itself.
+const (
+	OpData = 0
+	OpAck  = 1
+	OpNack = 2
+)
+
+// HeaderSize is the size of the packet header: version, operation code,
+// sequence number and the big-endian frame count.
+const HeaderSize = 5
+
+// MaxPacketSize is the largest packet written, the UDP payload that fits
+// into an Ethernet frame without fragmentation.
+const MaxPacketSize = 1472
+
+// Flags in the frame identifier and length fields, as in Linux struct
+// can_frame and struct canfd_frame.
+const (
+	flagExtended = 0x80000000
+	flagRemote   = 0x40000000
+	flagError    = 0x20000000
+	flagFD       = 0x80
+	maskExtended = 0x1FFFFFFF
+	maskStandard = 0x7FF
+)
+
+// ErrVersion is returned for packets of another protocol version.
+var ErrVersion = errors.New("unsupported cannelloni version")
+
+// Packet is a decoded cannelloni packet.
+type Packet struct {
+	OpCode uint8
+	Seq    uint8
+	Frames []ebyte.Frame
+	// Skipped counts CAN FD and error frames in the packet, which have no
+	// ebyte.Frame representation.
+	Skipped int
+}
+
+// Decode parses a packet received from a peer.
+func Decode(data []byte) (Packet, error) {
+	if len(data) < HeaderSize {
+		return Packet{}, fmt.Errorf("packet of %d bytes shorter than the header", len(data))
+	}
+	if data[0] != Version {
+		return Packet{}, fmt.Errorf("%w %d", ErrVersion, data[0])
+	}
+	p := Packet{OpCode: data[1], Seq: data[2]}
+	count := int(binary.BigEndian.Uint16(data[3:5]))
+	if p.OpCode != OpData {
+		return p, nil
+	}
+	rest := data[HeaderSize:]
+	for i := range count {
+		if len(rest) < 5 {
+			return Packet{}, fmt.Errorf("frame %d of %d truncated", i+1, count)
+		}
+		rawID := binary.BigEndian.Uint32(rest)
+		length := int(rest[4])
+		rest = rest[5:]
+		fd := length&flagFD != 0
+		if fd {
+			// CAN FD frames carry a flags byte before the data.
+			if len(rest) < 1 {
+				return Packet{}, fmt.Errorf("frame %d of %d truncated", i+1, count)
+			}
+			length &^= flagFD
+			rest = rest[1:]
+		}
+		if (!fd && length > 8) || length > 64 {
+			return Packet{}, fmt.Errorf("frame %d of %d has invalid length %d", i+1, count, length)
+		}
+		remote := rawID&flagRemote != 0 && !fd
+		dataLen := length
+		if remote {
+			dataLen = 0
+		}
+		if len(rest) < dataLen {
+			return Packet{}, fmt.Errorf("frame %d of %d truncated", i+1, count)
+		}
+		if fd || rawID&flagError != 0 {
+			p.Skipped++
+			rest = rest[dataLen:]
+			continue
+		}
+		f := ebyte.Frame{Extended: rawID&flagExtended != 0, Remote: remote, DLC: uint8(length)}
+		if f.Extended {
+			f.ID = rawID & maskExtended
+		} else {
+			f.ID = rawID & maskStandard
+		}
+		copy(f.Data[:], rest[:dataLen])
+		rest = rest[dataLen:]
+		p.Frames = append(p.Frames, f)
+	}
+	return p, nil
+}
+
+// frameSize returns the encoded size of f.
+func frameSize(f ebyte.Frame) int {
+	if f.Remote {
+		return 5
+	}
+	return 5 + int(min(f.DLC, 8))
+}
+
+// appendFrame encodes f in the layout of a classic CAN frame.
+func appendFrame(dst []byte, f ebyte.Frame) []byte {
+	id := f.ID & maskExtended
+	if f.Extended || id > maskStandard {
+		id |= flagExtended
+	}
+	if f.Remote {
+		id |= flagRemote
+	}
+	dlc := min(f.DLC, 8)
+	dst = binary.BigEndian.AppendUint32(dst, id)
+	dst = append(dst, dlc)
+	if !f.Remote {
+		dst = append(dst, f.Data[:dlc]...)
+	}
+	return dst
+}
+
+// Batch collects frames into data packets of at most MaxPacketSize bytes
+// and numbers the packets. The zero value starts at sequence number 0.
+type Batch struct {
+	buf   []byte
+	count int
+	seq   uint8
+}
+
+// Add appends f to the pending packet. It reports false without adding the
+// frame if the packet is full and has to be taken first.
+func (b *Batch) Add(f ebyte.Frame) bool {
+	if b.count == 0 {
+		b.buf = append(b.buf[:0], make([]byte, HeaderSize)...)
+	}
+	if len(b.buf)+frameSize(f) > MaxPacketSize {
+		return false
+	}
+	b.buf = appendFrame(b.buf, f)
+	b.count++
+	return true
+}
+
+// Len returns the number of frames in the pending packet.
+func (b *Batch) Len() int {
+	return b.count
+}
+
+// Take returns the pending packet and starts the next one. The returned
+// slice is only valid until the next call to Add.
+func (b *Batch) Take() []byte {
+	if b.count == 0 {
+		return nil
+	}
+	b.buf[0] = Version
+	b.buf[1] = OpData
+	b.buf[2] = b.seq
+	binary.BigEndian.PutUint16(b.buf[3:5], uint16(b.count))
+	b.seq++
+	b.count = 0
+	return b.buf
+}
+
+// Sequence checks the sequence numbers of received packets.
+type Sequence struct {
+	started bool
+	next    uint8
+}
+
+// Track records the sequence number of a received packet. It returns the
+// number of packets missing before it, or reports a packet that arrived
+// after a later one or twice. Gaps of up to half the sequence number range
+// count as loss, larger ones as reordering.
+func (s *Sequence) Track(seq uint8) (lost int, late bool) {
+	if !s.started {
+		s.started = true
+		s.next = seq + 1
+		return 0, false
+	}
+	gap := seq - s.next
+	if gap >= 128 {
+		return 0, true
+	}
+	s.next = seq + 1
+	return int(gap), false
+}
@@ -0,0 +1,136 @@
+package cannelloni
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestBatchRoundTrip(t *testing.T) {
+	frames := []ebyte.Frame{
+		{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}},
+		{ID: 0x18DAF110, Extended: true, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: 0x7DF, Remote: true, DLC: 3},
+		{ID: 0x10, Extended: true},
+	}
+	var b Batch
+	for _, f := range frames {
+		if !b.Add(f) {
+			t.Fatalf("Add(%+v) reported a full packet", f)
+		}
+	}
+	if b.Len() != len(frames) {
+		t.Fatalf("expected %d frames, got %d", len(frames), b.Len())
+	}
+	p, err := Decode(b.Take())
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if p.OpCode != OpData || p.Seq != 0 || !slices.Equal(p.Frames, frames) {
+		t.Fatalf("unexpected packet %+v", p)
+	}
+	if b.Len() != 0 || b.Take() != nil {
+		t.Fatalf("expected empty batch after Take")
+	}
+
+	b.Add(frames[0])
+	if p, _ := Decode(b.Take()); p.Seq != 1 {
+		t.Fatalf("expected sequence number 1, got %d", p.Seq)
+	}
+}
+
+func TestBatchLayout(t *testing.T) {
+	var b Batch
+	b.Add(ebyte.Frame{ID: 0x1ABCDE, DLC: 1, Data: [8]byte{0x55, 0x66}})
+	b.Add(ebyte.Frame{ID: 0x100, Remote: true, DLC: 4})
+	want := []byte{
+		2, 0, 0, 0, 2,
+		0x80, 0x1A, 0xBC, 0xDE, 1, 0x55,
+		0x40, 0x00, 0x01, 0x00, 4,
+	}
+	if got := b.Take(); !bytes.Equal(got, want) {
+		t.Fatalf("expected % X got % X", want, got)
+	}
+}
+
+func TestBatchFull(t *testing.T) {
+	var b Batch
+	f := ebyte.Frame{ID: 0x123, DLC: 8}
+	n := 0
+	for b.Add(f) {
+		n++
+	}
+	if want := (MaxPacketSize - HeaderSize) / 13; n != want {
+		t.Fatalf("expected %d frames per packet, got %d", want, n)
+	}
+	if packet := b.Take(); len(packet) > MaxPacketSize {
+		t.Fatalf("packet of %d bytes exceeds the maximum", len(packet))
+	}
+	if !b.Add(f) {
+		t.Fatalf("Add after Take failed")
+	}
+}
+
+func TestDecodeSkipsFDAndErrorFrames(t *testing.T) {
+	packet := []byte{
+		2, 0, 7, 0, 3,
+		0x00, 0x00, 0x01, 0x23, 0x80 | 12, 0x01, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12,
+		0x20, 0x00, 0x00, 0x04, 8, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x00, 0x00, 0x04, 0x56, 1, 0xAA,
+	}
+	p, err := Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	want := []ebyte.Frame{{ID: 0x456, DLC: 1, Data: [8]byte{0xAA}}}
+	if p.Seq != 7 || p.Skipped != 2 || !slices.Equal(p.Frames, want) {
+		t.Fatalf("unexpected packet %+v", p)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"short header": {2, 0, 0},
+		"truncated":    {2, 0, 0, 0, 1, 0, 0, 1, 0x23, 2, 0xAA},
+		"missing":      {2, 0, 0, 0, 2, 0, 0, 1, 0x23, 0},
+		"length":       {2, 0, 0, 0, 1, 0, 0, 1, 0x23, 9, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	}
+	for name, packet := range cases {
+		if _, err := Decode(packet); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if _, err := Decode([]byte{1, 0, 0, 0, 0}); !errors.Is(err, ErrVersion) {
+		t.Fatalf("expected ErrVersion, got %v", err)
+	}
+	if p, err := Decode([]byte{2, OpAck, 5, 0, 0}); err != nil || p.OpCode != OpAck {
+		t.Fatalf("expected acknowledgement packet, got %+v, %v", p, err)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	var s Sequence
+	steps := []struct {
+		seq  uint8
+		lost int
+		late bool
+	}{
+		{250, 0, false},
+		{251, 0, false},
+		{254, 2, false},
+		{253, 0, true},
+		{255, 0, false},
+		{0, 0, false},
+		{0, 0, true},
+		{3, 2, false},
+	}
+	for _, step := range steps {
+		lost, late := s.Track(step.seq)
+		if lost != step.lost || late != step.late {
+			t.Fatalf("Track(%d) = %d, %v; want %d, %v", step.seq, lost, late, step.lost, step.late)
+		}
+	}
+}
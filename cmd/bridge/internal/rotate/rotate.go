@@ -0,0 +1,128 @@
+// Package rotate provides a file writer that rolls over to a fresh file once a
+// size limit is reached, keeping a bounded number of numbered backups.
+package rotate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Writer is an io.WriteCloser backed by a file on disk. When a write would
+// grow the file beyond MaxSize, the file is renamed to "<path>.1" (shifting
+// older backups up by one) and a new file is started. It is safe for
+// concurrent use.
+type Writer struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open creates or appends to the file at path. A maxSize of zero disables
+// rotation; maxBackups limits how many rotated files are kept.
+func Open(path string, maxSize int64, maxBackups int) (*Writer, error) {
+	w := &Writer{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", w.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("stat %s: %w", w.path, err)
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// Write appends p to the current file, rotating first if required.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Size returns the size of the current file.
+func (w *Writer) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Rotate starts a new file immediately, for callers that must rotate at
+// their own record boundaries rather than by MaxSize.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate shifts the backups and starts a new file. The caller must hold w.mu.
+// A new file is opened even if the old one could not be moved away, so that
+// later writes still succeed; the errors are returned together.
+func (w *Writer) rotate() error {
+	var errs []error
+	if err := w.file.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close %s: %w", w.path, err))
+	}
+	w.file = nil
+
+	if w.maxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	} else {
+		_ = os.Remove(w.backupName(w.maxBackups))
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			_ = os.Rename(w.backupName(i), w.backupName(i+1))
+		}
+		if err := os.Rename(w.path, w.backupName(1)); err != nil {
+			errs = append(errs, fmt.Errorf("rotate %s: %w", w.path, err))
+		}
+	}
+	errs = append(errs, w.open())
+	return errors.Join(errs...)
+}
+
+func (w *Writer) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", w.path, n)
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,120 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.log")
+	w, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+	}
+
+	expect := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for name, want := range expect {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s: got %q want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only two backups to be kept")
+	}
+}
+
+func TestWriterWithoutLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.log")
+	w, err := Open(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := w.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() != 1000 {
+		t.Fatalf("unexpected size %d", info.Size())
+	}
+}
+
+func TestWriterRotateOnDemand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.pcap")
+	w, err := Open(path, 0, 1)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Rotate returned error: %v", err)
+	}
+	if w.Size() != 0 {
+		t.Fatalf("size after rotation = %d, want 0", w.Size())
+	}
+	if _, err := w.Write([]byte("second")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	for name, want := range map[string]string{path: "second", path + ".1": "first"} {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Fatalf("%s: got %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestWriterKeepsWritingAfterFailedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.log")
+	w, err := Open(path, 10, 1)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("0123456789")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	// An operator deleted the file, so the rotation cannot rename it.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("lost")); err == nil {
+		t.Fatalf("expected the failed rotation to be reported")
+	}
+	if _, err := w.Write([]byte("next")); err != nil {
+		t.Fatalf("Write after failed rotation returned error: %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "next" {
+		t.Fatalf("expected a new file with %q, got %q (%v)", "next", got, err)
+	}
+}
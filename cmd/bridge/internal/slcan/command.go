@@ -6,6 +6,14 @@ const (
 	CommandUnknown CommandType = iota
 	CommandOpen
 	CommandClose
+	CommandListenOnly
+	CommandBitrate
+	CommandBitTiming
+	CommandTransmit
+	CommandVersion
+	CommandSerial
+	CommandStatus
+	CommandTimestamp
 )
 
 type Command struct {
@@ -16,6 +24,7 @@ type Command struct {
 // ParseCommand inspects the ASCII command string sent by a GVRET client and
 // categorises it into a known command type. Unknown commands are reported with
 // their raw representation so the caller can decide how to handle them.
+// Transmit commands are only recognised if they contain a well-formed frame.
 func ParseCommand(raw string) Command {
 	if raw == "" {
 		return Command{Type: CommandUnknown, Raw: raw}
@@ -26,6 +35,25 @@ func ParseCommand(raw string) Command {
 		return Command{Type: CommandOpen, Raw: raw}
 	case 'C':
 		return Command{Type: CommandClose, Raw: raw}
+	case 'L':
+		return Command{Type: CommandListenOnly, Raw: raw}
+	case 'S':
+		return Command{Type: CommandBitrate, Raw: raw}
+	case 's':
+		return Command{Type: CommandBitTiming, Raw: raw}
+	case 't', 'T', 'r', 'R':
+		if _, err := DecodeFrame(raw); err != nil {
+			return Command{Type: CommandUnknown, Raw: raw}
+		}
+		return Command{Type: CommandTransmit, Raw: raw}
+	case 'V', 'v':
+		return Command{Type: CommandVersion, Raw: raw}
+	case 'N':
+		return Command{Type: CommandSerial, Raw: raw}
+	case 'F':
+		return Command{Type: CommandStatus, Raw: raw}
+	case 'Z':
+		return Command{Type: CommandTimestamp, Raw: raw}
 	default:
 		return Command{Type: CommandUnknown, Raw: raw}
 	}
@@ -11,6 +11,11 @@ func TestParseCommand(t *testing.T) {
 		{"C", CommandClose},
 		{"", CommandUnknown},
 		{"T123", CommandUnknown},
+		{"t1230", CommandTransmit},
+		{"L", CommandListenOnly},
+		{"S6", CommandBitrate},
+		{"V", CommandVersion},
+		{"Z1", CommandTimestamp},
 	}
 
 	for _, tc := range cases {
@@ -4,14 +4,25 @@ package slcan
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
-	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/ebyte"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
 )
 
 // EncodeFrame converts an internal CAN frame into the ASCII SLCAN string that
 // GVRET-compatible clients expect.
 func EncodeFrame(frame ebyte.Frame) string {
+	return encodeFrame(frame, nil)
+}
+
+// EncodeFrameTimestamp works like EncodeFrame but appends the four hex digit
+// millisecond timestamp that clients enable with the Z1 command.
+func EncodeFrameTimestamp(frame ebyte.Frame, millis uint16) string {
+	return encodeFrame(frame, &millis)
+}
+
+func encodeFrame(frame ebyte.Frame, millis *uint16) string {
 	var builder strings.Builder
 	switch {
 	case frame.Remote && frame.Extended:
@@ -38,6 +49,70 @@ func EncodeFrame(frame ebyte.Frame) string {
 		}
 	}
 
+	if millis != nil {
+		builder.WriteString(fmt.Sprintf("%04X", *millis))
+	}
+
 	builder.WriteByte('\r')
 	return builder.String()
 }
+
+// DecodeFrame parses a transmit command (tiiildd.., Tiiiiiiiildd.., riiil or
+// Riiiiiiiil) into a frame. A trailing carriage return is ignored.
+func DecodeFrame(raw string) (ebyte.Frame, error) {
+	raw = strings.TrimSuffix(raw, "\r")
+	if raw == "" {
+		return ebyte.Frame{}, fmt.Errorf("empty frame")
+	}
+
+	var frame ebyte.Frame
+	idLen := 3
+	switch raw[0] {
+	case 't':
+	case 'T':
+		frame.Extended, idLen = true, 8
+	case 'r':
+		frame.Remote = true
+	case 'R':
+		frame.Extended, frame.Remote, idLen = true, true, 8
+	default:
+		return ebyte.Frame{}, fmt.Errorf("unknown frame type %q", raw[0])
+	}
+
+	if len(raw) < 1+idLen+1 {
+		return ebyte.Frame{}, fmt.Errorf("frame %q too short", raw)
+	}
+	id, err := strconv.ParseUint(raw[1:1+idLen], 16, 32)
+	if err != nil {
+		return ebyte.Frame{}, fmt.Errorf("invalid identifier in %q", raw)
+	}
+	if (frame.Extended && id > 0x1FFFFFFF) || (!frame.Extended && id > 0x7FF) {
+		return ebyte.Frame{}, fmt.Errorf("identifier out of range in %q", raw)
+	}
+	frame.ID = uint32(id)
+
+	dlc := raw[1+idLen]
+	if dlc < '0' || dlc > '8' {
+		return ebyte.Frame{}, fmt.Errorf("invalid DLC in %q", raw)
+	}
+	frame.DLC = dlc - '0'
+
+	data := raw[2+idLen:]
+	if frame.Remote {
+		if data != "" {
+			return ebyte.Frame{}, fmt.Errorf("unexpected data in remote frame %q", raw)
+		}
+		return frame, nil
+	}
+	if len(data) != 2*int(frame.DLC) {
+		return ebyte.Frame{}, fmt.Errorf("data length does not match DLC in %q", raw)
+	}
+	for i := 0; i < int(frame.DLC); i++ {
+		v, err := strconv.ParseUint(data[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return ebyte.Frame{}, fmt.Errorf("invalid data byte in %q", raw)
+		}
+		frame.Data[i] = byte(v)
+	}
+	return frame, nil
+}
@@ -4,7 +4,7 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/ebyte"
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
 )
 
 func TestEncodeFrame(t *testing.T) {
@@ -37,3 +37,47 @@ func TestEncodeExtendedRemote(t *testing.T) {
 		t.Fatalf("missing terminator in %q", encoded)
 	}
 }
+
+func TestEncodeFrameTimestamp(t *testing.T) {
+	frame := ebyte.Frame{ID: 0x123, DLC: 1, Data: [8]byte{0x01}}
+	if got, want := EncodeFrameTimestamp(frame, 0xEA5F), "t123101EA5F\r"; got != want {
+		t.Fatalf("expected %q got %q", want, got)
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	cases := []struct {
+		input string
+		want  ebyte.Frame
+	}{
+		{"t1232ABCD", ebyte.Frame{ID: 0x123, DLC: 2, Data: [8]byte{0xAB, 0xCD}}},
+		{"T1ABCDEF01FF\r", ebyte.Frame{ID: 0x1ABCDEF0, Extended: true, DLC: 1, Data: [8]byte{0xFF}}},
+		{"r7FF8", ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 8}},
+		{"R000000010", ebyte.Frame{ID: 0x1, Extended: true, Remote: true}},
+	}
+	for _, tc := range cases {
+		got, err := DecodeFrame(tc.input)
+		if err != nil {
+			t.Fatalf("DecodeFrame(%q) returned error: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Fatalf("DecodeFrame(%q) = %+v, want %+v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeFrameRoundTrip(t *testing.T) {
+	frame := ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	got, err := DecodeFrame(EncodeFrame(frame))
+	if err != nil || got != frame {
+		t.Fatalf("round trip mismatch: %+v (%v)", got, err)
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	for _, input := range []string{"", "x123", "t12", "t8001", "t1239", "t1232AB", "t1232ABZZ", "r1231AB", "T123"} {
+		if _, err := DecodeFrame(input); err == nil {
+			t.Fatalf("expected error for %q", input)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux && !386
+
+package socketcan
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// canRaw is the CAN_RAW protocol of AF_CAN sockets.
+const canRaw = 1
+
+// sockaddrCAN mirrors struct sockaddr_can; the address union is only used
+// by other CAN protocols.
+type sockaddrCAN struct {
+	family  uint16
+	_       [2]byte
+	ifindex int32
+	_       [16]byte
+}
+
+// Open binds a raw CAN socket to the named interface.
+func Open(iface string) (*Conn, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("socketcan %s: %w", iface, err)
+	}
+	fd, err := syscall.Socket(syscall.AF_CAN, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, canRaw)
+	if err != nil {
+		return nil, fmt.Errorf("socketcan %s: %w", iface, os.NewSyscallError("socket", err))
+	}
+	addr := sockaddrCAN{family: syscall.AF_CAN, ifindex: int32(ifi.Index)}
+	_, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(unsafe.Pointer(&addr)), unsafe.Sizeof(addr))
+	if errno != 0 {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("socketcan %s: %w", iface, os.NewSyscallError("bind", errno))
+	}
+	// A non-blocking descriptor is served by the runtime poller, which
+	// makes deadlines and Close from another goroutine work.
+	return &Conn{f: os.NewFile(uintptr(fd), iface), iface: iface}, nil
+}
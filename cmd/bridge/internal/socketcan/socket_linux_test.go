@@ -0,0 +1,55 @@
+//go:build linux && !386
+
+package socketcan
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// TestOpenVCAN needs a vcan0 interface:
+//
+//	ip link add dev vcan0 type vcan && ip link set up vcan0
+func TestOpenVCAN(t *testing.T) {
+	if _, err := net.InterfaceByName("vcan0"); err != nil {
+		t.Skip("vcan0 not available")
+	}
+	a, err := Open("vcan0")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer a.Close()
+	b, err := Open("vcan0")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer b.Close()
+
+	want := ebyte.Frame{ID: 0x18DAF110, Extended: true, DLC: 3, Data: [8]byte{1, 2, 3}}
+	if err := a.WriteFrame(want); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	_ = b.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := b.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if got != want {
+		t.Fatalf("received %+v, want %+v", got, want)
+	}
+
+	// The writing socket does not receive its own frame.
+	_ = a.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if f, err := a.ReadFrame(); err == nil {
+		t.Fatalf("unexpected own frame %+v", f)
+	}
+}
+
+func TestOpenUnknownInterface(t *testing.T) {
+	if _, err := Open("nosuchcan0"); err == nil {
+		t.Fatalf("expected error for unknown interface")
+	}
+}
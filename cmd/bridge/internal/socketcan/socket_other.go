@@ -0,0 +1,13 @@
+//go:build !linux || 386
+
+package socketcan
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Open fails; SocketCAN only exists on Linux.
+func Open(iface string) (*Conn, error) {
+	return nil, fmt.Errorf("socketcan %s: %w", iface, errors.ErrUnsupported)
+}
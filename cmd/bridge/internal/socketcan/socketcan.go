@@ -0,0 +1,118 @@
+// Package socketcan reads and writes classic CAN frames on Linux SocketCAN
+// interfaces such as can0 or vcan0 through raw AF_CAN sockets.
+package socketcan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// FrameSize is the size of struct can_frame.
+const FrameSize = 16
+
+// Flags in can_id of struct can_frame.
+const (
+	flagExtended = 0x80000000
+	flagRemote   = 0x40000000
+	flagError    = 0x20000000
+	maskExtended = 0x1FFFFFFF
+	maskStandard = 0x7FF
+)
+
+// ErrErrorFrame is returned for error frames, which carry bus state
+// instead of a CAN message.
+var ErrErrorFrame = errors.New("error frame")
+
+// EncodeFrame renders f as struct can_frame in host byte order.
+func EncodeFrame(f ebyte.Frame) [FrameSize]byte {
+	var raw [FrameSize]byte
+	id := f.ID & maskExtended
+	if f.Extended || id > maskStandard {
+		id |= flagExtended
+	}
+	if f.Remote {
+		id |= flagRemote
+	}
+	binary.NativeEndian.PutUint32(raw[0:4], id)
+	raw[4] = min(f.DLC, 8)
+	copy(raw[8:], f.Data[:raw[4]])
+	return raw
+}
+
+// DecodeFrame parses struct can_frame in host byte order.
+func DecodeFrame(raw []byte) (ebyte.Frame, error) {
+	if len(raw) != FrameSize {
+		return ebyte.Frame{}, fmt.Errorf("invalid frame size %d", len(raw))
+	}
+	id := binary.NativeEndian.Uint32(raw[0:4])
+	if id&flagError != 0 {
+		return ebyte.Frame{}, ErrErrorFrame
+	}
+	if raw[4] > 8 {
+		return ebyte.Frame{}, fmt.Errorf("invalid DLC %d", raw[4])
+	}
+	f := ebyte.Frame{
+		Extended: id&flagExtended != 0,
+		Remote:   id&flagRemote != 0,
+		DLC:      raw[4],
+	}
+	if f.Extended {
+		f.ID = id & maskExtended
+	} else {
+		f.ID = id & maskStandard
+	}
+	if !f.Remote {
+		copy(f.Data[:], raw[8:8+f.DLC])
+	}
+	return f, nil
+}
+
+// Conn is a raw CAN socket bound to one interface. Frames written to it
+// are not received back on the same socket, but other sockets on the
+// interface see them.
+type Conn struct {
+	f     *os.File
+	iface string
+}
+
+// Interface returns the name of the interface the socket is bound to.
+func (c *Conn) Interface() string {
+	return c.iface
+}
+
+// ReadFrame returns the next frame received on the interface.
+func (c *Conn) ReadFrame() (ebyte.Frame, error) {
+	var raw [FrameSize]byte
+	n, err := c.f.Read(raw[:])
+	if err != nil {
+		return ebyte.Frame{}, err
+	}
+	return DecodeFrame(raw[:n])
+}
+
+// WriteFrame sends f on the interface.
+func (c *Conn) WriteFrame(f ebyte.Frame) error {
+	raw := EncodeFrame(f)
+	_, err := c.f.Write(raw[:])
+	return err
+}
+
+// SetReadDeadline sets the deadline for ReadFrame.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for WriteFrame.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
+
+// Close closes the socket.
+func (c *Conn) Close() error {
+	return c.f.Close()
+}
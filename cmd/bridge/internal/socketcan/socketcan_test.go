@@ -0,0 +1,55 @@
+package socketcan
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []ebyte.Frame{
+		{ID: 0x123, DLC: 2, Data: [8]byte{0xCA, 0xFE}},
+		{ID: 0x18DAF110, Extended: true, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: 0x7DF, Remote: true, DLC: 3},
+		{ID: 0x10, Extended: true},
+	}
+	for _, want := range frames {
+		raw := EncodeFrame(want)
+		got, err := DecodeFrame(raw[:])
+		if err != nil {
+			t.Fatalf("DecodeFrame(%+v) returned error: %v", want, err)
+		}
+		if got != want {
+			t.Fatalf("round trip of %+v gave %+v", want, got)
+		}
+	}
+}
+
+func TestEncodeFrameLayout(t *testing.T) {
+	raw := EncodeFrame(ebyte.Frame{ID: 0x1ABCDE, DLC: 1, Data: [8]byte{0x55, 0x66}})
+	if id := binary.NativeEndian.Uint32(raw[0:4]); id != 0x801ABCDE {
+		t.Fatalf("expected extended can_id 0x801ABCDE, got 0x%08X", id)
+	}
+	if raw[4] != 1 || raw[8] != 0x55 || raw[9] != 0 {
+		t.Fatalf("unexpected frame % X", raw)
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	var raw [FrameSize]byte
+	binary.NativeEndian.PutUint32(raw[0:4], flagError|0x04)
+	raw[4] = 8
+	if _, err := DecodeFrame(raw[:]); !errors.Is(err, ErrErrorFrame) {
+		t.Fatalf("expected ErrErrorFrame, got %v", err)
+	}
+	if _, err := DecodeFrame(raw[:8]); err == nil {
+		t.Fatalf("expected error for short frame")
+	}
+	binary.NativeEndian.PutUint32(raw[0:4], 0x123)
+	raw[4] = 9
+	if _, err := DecodeFrame(raw[:]); err == nil {
+		t.Fatalf("expected error for DLC 9")
+	}
+}
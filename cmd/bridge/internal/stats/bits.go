@@ -0,0 +1,95 @@
+package stats
+
+import "github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+
+const (
+	crc15Polynomial = 0x4599
+
+	// trailerBits covers the CRC delimiter, ACK slot and delimiter, end of
+	// frame and the interframe space, none of which are subject to stuffing.
+	trailerBits = 1 + 2 + 7 + 3
+)
+
+// FrameBits returns the number of bit times the frame occupies on the bus,
+// including stuff bits and the interframe space. The stuffing is computed from
+// the actual identifier, payload and CRC, so the result matches what a bus
+// analyser would measure for an error-free transmission.
+func FrameBits(frame ebyte.Frame) int {
+	bits := make([]byte, 0, 160)
+	appendBits := func(value uint32, width int) {
+		for i := width - 1; i >= 0; i-- {
+			bits = append(bits, byte(value>>uint(i))&1)
+		}
+	}
+
+	dlc := frame.DLC
+	if dlc > 8 {
+		dlc = 8
+	}
+	rtr := uint32(0)
+	if frame.Remote {
+		rtr = 1
+	}
+
+	appendBits(0, 1) // SOF
+	if frame.Extended || frame.ID > 0x7FF {
+		id := frame.ID & 0x1FFFFFFF
+		appendBits(id>>18, 11)
+		appendBits(1, 1) // SRR
+		appendBits(1, 1) // IDE
+		appendBits(id&0x3FFFF, 18)
+		appendBits(rtr, 1)
+		appendBits(0, 2) // r1, r0
+	} else {
+		appendBits(frame.ID&0x7FF, 11)
+		appendBits(rtr, 1)
+		appendBits(0, 2) // IDE, r0
+	}
+	appendBits(uint32(frame.DLC&0x0F), 4)
+	if !frame.Remote {
+		for i := uint8(0); i < dlc; i++ {
+			appendBits(uint32(frame.Data[i]), 8)
+		}
+	}
+	appendBits(uint32(crc15(bits)), 15)
+
+	return len(bits) + stuffBits(bits) + trailerBits
+}
+
+// crc15 computes the CAN CRC over a sequence of single-bit values.
+func crc15(bits []byte) uint16 {
+	var crc uint16
+	for _, bit := range bits {
+		next := bit ^ byte(crc>>14&1)
+		crc = (crc << 1) & 0x7FFF
+		if next != 0 {
+			crc ^= crc15Polynomial
+		}
+	}
+	return crc
+}
+
+// stuffBits counts the stuff bits a transmitter inserts after every run of
+// five identical bits. Inserted bits take part in the following run.
+func stuffBits(bits []byte) int {
+	if len(bits) == 0 {
+		return 0
+	}
+	stuffed := 0
+	last := bits[0]
+	run := 1
+	for _, bit := range bits[1:] {
+		if bit == last {
+			run++
+		} else {
+			last = bit
+			run = 1
+		}
+		if run == 5 {
+			stuffed++
+			last ^= 1
+			run = 1
+		}
+	}
+	return stuffed
+}
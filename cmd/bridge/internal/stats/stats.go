@@ -0,0 +1,235 @@
+// Package stats derives bus load and per-identifier timing figures from the
+// stream of CAN frames received from the adapter.
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+const (
+	loadBuckets    = 10
+	loadBucketSpan = 100 * time.Millisecond
+)
+
+// Collector accumulates statistics for frames observed on a single CAN bus.
+// It is safe for concurrent use.
+type Collector struct {
+	mu sync.Mutex
+
+	bitrate uint32
+	start   time.Time
+
+	frames uint64
+	bits   uint64
+
+	bucketBits  [loadBuckets]uint64
+	bucketIndex [loadBuckets]int64
+	peakLoad    float64
+
+	ids map[idKey]*idState
+}
+
+type idKey struct {
+	id       uint32
+	extended bool
+}
+
+type idState struct {
+	count    uint64
+	dlc      uint8
+	data     [8]byte
+	remote   bool
+	first    time.Time
+	last     time.Time
+	mean     float64 // mean period in seconds
+	m2       float64 // sum of squared deviations from the mean period
+	min, max time.Duration
+}
+
+// Snapshot is a point-in-time copy of the collected statistics.
+type Snapshot struct {
+	Since    time.Time `json:"since"`
+	Bitrate  uint32    `json:"bitrate"`
+	Frames   uint64    `json:"frames"`
+	Bits     uint64    `json:"bits"`
+	BusLoad  float64   `json:"bus_load"`
+	PeakLoad float64   `json:"peak_load"`
+	IDs      []IDStats `json:"ids"`
+}
+
+// IDStats describes the traffic observed for one CAN identifier. Period
+// figures are only meaningful once at least two frames have been seen.
+type IDStats struct {
+	ID         uint32        `json:"id"`
+	Extended   bool          `json:"extended"`
+	Remote     bool          `json:"remote"`
+	Count      uint64        `json:"count"`
+	DLC        uint8         `json:"dlc"`
+	Data       []byte        `json:"data"`
+	LastSeen   time.Time     `json:"last_seen"`
+	MeanPeriod time.Duration `json:"mean_period"`
+	Jitter     time.Duration `json:"jitter"`
+	MinPeriod  time.Duration `json:"min_period"`
+	MaxPeriod  time.Duration `json:"max_period"`
+}
+
+// NewCollector returns a collector that computes bus load relative to the
+// given nominal bitrate in bit/s.
+func NewCollector(bitrate uint32) *Collector {
+	return &Collector{
+		bitrate: bitrate,
+		start:   time.Now(),
+		ids:     make(map[idKey]*idState),
+	}
+}
+
+// SetBitrate changes the nominal bitrate used for the bus load calculation.
+func (c *Collector) SetBitrate(bitrate uint32) {
+	c.mu.Lock()
+	c.bitrate = bitrate
+	c.mu.Unlock()
+}
+
+// Observe records a frame that was seen on the bus at the given time.
+func (c *Collector) Observe(frame ebyte.Frame, at time.Time) {
+	bits := uint64(FrameBits(frame))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.frames++
+	c.bits += bits
+
+	idx := at.UnixNano() / int64(loadBucketSpan)
+	slot := idx % loadBuckets
+	if c.bucketIndex[slot] != idx {
+		c.bucketIndex[slot] = idx
+		c.bucketBits[slot] = 0
+	}
+	c.bucketBits[slot] += bits
+	// Until the sliding window is full, a short burst would be reported as
+	// the load of the whole window; the peak only counts full windows.
+	if at.Sub(c.start) >= loadBuckets*loadBucketSpan {
+		if load := c.loadLocked(at); load > c.peakLoad {
+			c.peakLoad = load
+		}
+	}
+
+	key := idKey{id: frame.ID, extended: frame.Extended || frame.ID > 0x7FF}
+	st, ok := c.ids[key]
+	if !ok {
+		st = &idState{first: at}
+		c.ids[key] = st
+	}
+	if st.count > 0 {
+		period := at.Sub(st.last)
+		// Welford's online algorithm keeps mean and variance numerically
+		// stable without storing individual samples.
+		n := float64(st.count)
+		delta := period.Seconds() - st.mean
+		st.mean += delta / n
+		st.m2 += delta * (period.Seconds() - st.mean)
+		if st.count == 1 || period < st.min {
+			st.min = period
+		}
+		if period > st.max {
+			st.max = period
+		}
+	}
+	st.count++
+	st.last = at
+	st.dlc = frame.DLC
+	st.data = frame.Data
+	st.remote = frame.Remote
+}
+
+// loadLocked returns the bus load over the sliding window ending at now as a
+// fraction between 0 and 1. The caller must hold c.mu.
+func (c *Collector) loadLocked(now time.Time) float64 {
+	if c.bitrate == 0 {
+		return 0
+	}
+	current := now.UnixNano() / int64(loadBucketSpan)
+	var bits uint64
+	for i := range c.bucketBits {
+		if idx := c.bucketIndex[i]; idx > current-loadBuckets && idx <= current {
+			bits += c.bucketBits[i]
+		}
+	}
+
+	// The newest bucket is only partially elapsed, so measure the window up
+	// to now instead of assuming it is complete.
+	window := time.Duration(loadBuckets-1)*loadBucketSpan + time.Duration(now.UnixNano()%int64(loadBucketSpan))
+	if elapsed := now.Sub(c.start); elapsed < window {
+		window = elapsed
+	}
+	if window < loadBucketSpan {
+		window = loadBucketSpan
+	}
+	return float64(bits) / (float64(c.bitrate) * window.Seconds())
+}
+
+// Snapshot returns the current statistics with identifiers sorted by ID.
+func (c *Collector) Snapshot() Snapshot {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := Snapshot{
+		Since:    c.start,
+		Bitrate:  c.bitrate,
+		Frames:   c.frames,
+		Bits:     c.bits,
+		BusLoad:  c.loadLocked(now),
+		PeakLoad: c.peakLoad,
+		IDs:      make([]IDStats, 0, len(c.ids)),
+	}
+	for key, st := range c.ids {
+		entry := IDStats{
+			ID:        key.id,
+			Extended:  key.extended,
+			Remote:    st.remote,
+			Count:     st.count,
+			DLC:       st.dlc,
+			Data:      append([]byte(nil), st.data[:min(int(st.dlc), 8)]...),
+			LastSeen:  st.last,
+			MinPeriod: st.min,
+			MaxPeriod: st.max,
+		}
+		if st.count > 1 {
+			entry.MeanPeriod = seconds(st.mean)
+			entry.Jitter = seconds(math.Sqrt(st.m2 / float64(st.count-1)))
+		}
+		snap.IDs = append(snap.IDs, entry)
+	}
+	sort.Slice(snap.IDs, func(i, j int) bool {
+		if snap.IDs[i].ID != snap.IDs[j].ID {
+			return snap.IDs[i].ID < snap.IDs[j].ID
+		}
+		return !snap.IDs[i].Extended && snap.IDs[j].Extended
+	})
+	return snap
+}
+
+// Reset discards all collected statistics.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.start = time.Now()
+	c.frames = 0
+	c.bits = 0
+	c.bucketBits = [loadBuckets]uint64{}
+	c.bucketIndex = [loadBuckets]int64{}
+	c.peakLoad = 0
+	c.ids = make(map[idKey]*idState)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,109 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestFrameBitsAllZero(t *testing.T) {
+	// 19 header bits and a zero CRC give 34 dominant bits in a row, which
+	// require a stuff bit after every fifth bit.
+	if got, want := FrameBits(ebyte.Frame{}), 34+6+trailerBits; got != want {
+		t.Fatalf("unexpected bit count: got %d want %d", got, want)
+	}
+}
+
+func TestFrameBitsBounds(t *testing.T) {
+	cases := []struct {
+		frame ebyte.Frame
+		base  int
+	}{
+		{ebyte.Frame{ID: 0x123, DLC: 8, Data: [8]byte{0xFF, 0x00, 0xAA, 0x55, 0x0F, 0xF0, 0x12, 0x34}}, 47 + 64},
+		{ebyte.Frame{ID: 0x1ABCDEF0, Extended: true, DLC: 4, Data: [8]byte{1, 2, 3, 4}}, 67 + 32},
+		{ebyte.Frame{ID: 0x7FF, Remote: true, DLC: 8}, 47},
+	}
+
+	for _, tc := range cases {
+		got := FrameBits(tc.frame)
+		stuffable := tc.base - trailerBits
+		if got < tc.base || got > tc.base+(stuffable-1)/4 {
+			t.Fatalf("bit count %d for %+v outside [%d, %d]", got, tc.frame, tc.base, tc.base+(stuffable-1)/4)
+		}
+	}
+}
+
+func TestCollectorPeriodAndJitter(t *testing.T) {
+	c := NewCollector(500000)
+	base := time.Now()
+	offsets := []time.Duration{0, 10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}
+	for i, off := range offsets {
+		c.Observe(ebyte.Frame{ID: 0x100, DLC: 1, Data: [8]byte{byte(i)}}, base.Add(off))
+	}
+	c.Observe(ebyte.Frame{ID: 0x100, Extended: true, DLC: 0}, base)
+
+	snap := c.Snapshot()
+	if snap.Frames != 5 {
+		t.Fatalf("expected 5 frames, got %d", snap.Frames)
+	}
+	if len(snap.IDs) != 2 {
+		t.Fatalf("expected standard and extended entries, got %+v", snap.IDs)
+	}
+
+	std := snap.IDs[0]
+	if std.Extended || std.Count != 4 {
+		t.Fatalf("unexpected entry %+v", std)
+	}
+	if std.MeanPeriod != 10*time.Millisecond {
+		t.Fatalf("unexpected mean period %s", std.MeanPeriod)
+	}
+	if std.Jitter > time.Microsecond {
+		t.Fatalf("expected no jitter for a perfectly cyclic ID, got %s", std.Jitter)
+	}
+	if len(std.Data) != 1 || std.Data[0] != 3 {
+		t.Fatalf("expected last payload to be kept, got % X", std.Data)
+	}
+}
+
+func TestCollectorBusLoad(t *testing.T) {
+	c := NewCollector(125000)
+	now := time.Now()
+	c.start = now.Add(-time.Second)
+
+	frame := ebyte.Frame{ID: 0x123, DLC: 8}
+	bits := FrameBits(frame)
+	// Half a second worth of bit times spread over the last window.
+	n := 62500 / bits
+	for i := 0; i < n; i++ {
+		c.Observe(frame, now.Add(-time.Duration(i)*time.Millisecond))
+	}
+
+	load := c.Snapshot().BusLoad
+	if load < 0.4 || load > 0.6 {
+		t.Fatalf("expected roughly 50%% bus load, got %.1f%%", load*100)
+	}
+}
+
+func TestCollectorPeakLoadNeedsFullWindow(t *testing.T) {
+	c := NewCollector(125000)
+	now := time.Now()
+	c.start = now
+
+	frame := ebyte.Frame{ID: 0x123, DLC: 8}
+	for i := range 20 {
+		c.Observe(frame, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if peak := c.Snapshot().PeakLoad; peak != 0 {
+		t.Fatalf("expected no peak before the window is full, got %.1f%%", peak*100)
+	}
+
+	later := now.Add(2 * time.Second)
+	for i := range 20 {
+		c.Observe(frame, later.Add(time.Duration(i)*time.Millisecond))
+	}
+	want := float64(20*FrameBits(frame)) / (125000 * time.Second.Seconds())
+	if peak := c.Snapshot().PeakLoad; peak < want*0.9 || peak > want*1.2 {
+		t.Fatalf("expected a peak of about %.1f%%, got %.1f%%", want*100, peak*100)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package systemd
+
+import "os"
+
+// Files returns nil; socket activation is only available on Unix systems.
+func Files() []*os.File {
+	return nil
+}
@@ -3,11 +3,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/bridge/internal/app"
@@ -15,35 +20,383 @@ import (
 
 // main parses CLI flags, initialises the bridge and blocks until shutdown.
 func main() {
+	def := app.DefaultConfig()
+	defEByteHost, defEBytePort := splitHostPort(def.EByteAddress)
+	defListenHost, defListenPort := splitHostPort(def.ListenAddress)
+
 	var (
-		ebyteHost      = flag.String("ebyte-host", "127.0.0.1", "Hostname or IP address of the EByte CAN-to-Ethernet adapter")
-		ebytePort      = flag.Int("ebyte-port", 4001, "TCP port of the EByte CAN-to-Ethernet adapter")
-		listenHost     = flag.String("listen-host", "0.0.0.0", "Host address for the GVRET TCP server")
-		listenPort     = flag.Int("listen-port", 23, "Port for the GVRET TCP server")
-		reconnectDelay = flag.Duration("reconnect-delay", 2*time.Second, "Delay before retrying the connection to the adapter")
-		logLevel       = flag.String("log-level", "info", "Log level (debug|info|warn|error)")
-		busBitrate     = flag.Uint("can-bitrate", 500000, "Nominal CAN bitrate used to announce the GVRET bus (in bit/s)")
+		configPath     = flag.String("config", "", "Path to a JSON configuration file; flags override its values")
+		checkConfig    = flag.Bool("check-config", false, "Validate the configuration, print the effective settings and exit")
+		backend        = flag.String("backend", "ebyte", "Kind of device at the adapter addresses (ebyte|gvret), or socketcan for a SocketCAN interface")
+		ebyteHost      = flag.String("ebyte-host", defEByteHost, "Hostname or IP address of the EByte CAN-to-Ethernet adapter")
+		ebytePort      = flag.Int("ebyte-port", defEBytePort, "TCP port of the EByte CAN-to-Ethernet adapter")
+		failover       = flag.String("ebyte-failover", "", "Comma-separated host:port list of secondary adapters on the same bus")
+		failoverAfter  = flag.Int("failover-after", def.FailoverAfter, "Consecutive connection failures before switching to the next adapter")
+		failback       = flag.Duration("failback-interval", time.Duration(def.FailbackInterval), "Interval for probing the primary adapter while on a secondary (0 disables failback)")
+		listenHost     = flag.String("listen-host", defListenHost, "Host address for the GVRET TCP server")
+		listenPort     = flag.Int("listen-port", defListenPort, "Port for the GVRET TCP server")
+		listenProto    = flag.String("listen-protocol", "gvret", "Protocol of the main listener (gvret|slcan|socketcand|auto)")
+		detectTimeout  = flag.Duration("detect-timeout", time.Duration(def.Detect.Timeout), "Time to wait for a client's first bytes on auto-detecting listeners")
+		detectFallback = flag.String("detect-fallback", def.Detect.Fallback, "Protocol used when auto-detection does not recognise the client")
+		listenTLS      = flag.Bool("listen-tls", false, "Serve GVRET clients over TLS")
+		slcanListen    = flag.String("slcan-listen", "", "host:port for an SLCAN ASCII TCP server (empty disables)")
+		slcanTLS       = flag.Bool("slcan-tls", false, "Serve SLCAN clients over TLS")
+		listenAllow    = flag.String("listen-allow", "", "Comma-separated CIDR prefixes allowed to connect to the GVRET server")
+		listenDeny     = flag.String("listen-deny", "", "Comma-separated CIDR prefixes refused by the GVRET server")
+		slcanAllow     = flag.String("slcan-allow", "", "Comma-separated CIDR prefixes allowed to connect to the SLCAN server")
+		slcanDeny      = flag.String("slcan-deny", "", "Comma-separated CIDR prefixes refused by the SLCAN server")
+		maxClients     = flag.Int("max-clients", def.MaxClients, "Maximum number of concurrent clients over all listeners (0 = unlimited)")
+		maxClientsIP   = flag.Int("max-clients-per-ip", def.MaxClientsPerIP, "Maximum number of concurrent clients per source address (0 = unlimited)")
+		tlsCert        = flag.String("tls-cert", "", "PEM certificate file for TLS listeners")
+		tlsKey         = flag.String("tls-key", "", "PEM private key file for TLS listeners")
+		tlsClientCA    = flag.String("tls-client-ca", "", "PEM CA bundle for verifying client certificates")
+		tlsRequireCert = flag.Bool("tls-require-client-cert", false, "Reject TLS clients without a valid certificate")
+		tlsAllowed     = flag.String("tls-allowed-clients", "", "Comma-separated client certificate common names allowed to connect")
+		reconnectDelay = flag.Duration("reconnect-delay", time.Duration(def.ReconnectDelay), "Delay before retrying the connection to the adapter")
+		reconnectMax   = flag.Duration("reconnect-max-delay", time.Duration(def.ReconnectMaxDelay), "Upper limit for the exponential reconnect delay")
+		reconnectMult  = flag.Float64("reconnect-multiplier", def.ReconnectMultiplier, "Factor applied to the reconnect delay after each failed attempt")
+		reconnectJit   = flag.Float64("reconnect-jitter", def.ReconnectJitter, "Random spread of each reconnect delay as a fraction (0..1)")
+		dialTimeout    = flag.Duration("dial-timeout", time.Duration(def.DialTimeout), "Timeout for a single connection attempt to the adapter")
+		keepAliveIdle  = flag.Duration("keepalive-idle", time.Duration(def.KeepAliveIdle), "Idle time before TCP keepalive probes are sent to the adapter (0 disables keepalive)")
+		keepAliveIntvl = flag.Duration("keepalive-interval", time.Duration(def.KeepAliveInterval), "Interval between TCP keepalive probes")
+		keepAliveCount = flag.Int("keepalive-count", def.KeepAliveCount, "Unanswered keepalive probes before the adapter connection is dropped")
+		idleTimeout    = flag.Duration("adapter-idle-timeout", 0, "Reconnect when no data arrives from the adapter for this long (0 disables)")
+		shutdownTime   = flag.Duration("shutdown-timeout", time.Duration(def.ShutdownTimeout), "Time allowed for flushing queued frames to the adapter and clients on exit")
+		logLevel       = flag.String("log-level", def.Log.Level, "Log level (debug|info|warn|error)")
+		logLevels      = flag.String("log-levels", "", "Per-component log levels, e.g. adapter=debug,stats=warn")
+		logFormat      = flag.String("log-format", def.Log.Format, "Log output format (text|json)")
+		logFile        = flag.String("log-file", "", "Write logs to this file instead of stdout")
+		logMaxSize     = flag.Int64("log-max-size", def.Log.MaxSize>>20, "Rotate the log file after this many megabytes (0 disables rotation)")
+		logMaxBackups  = flag.Int("log-max-backups", def.Log.MaxBackups, "Number of rotated log files to keep")
+		busBitrate     = flag.Uint("can-bitrate", uint(def.BusBitrate), "Nominal CAN bitrate used to announce the GVRET bus (in bit/s)")
+		adminAddress   = flag.String("admin-listen", "", "Address for the HTTP admin API (host:port or unix:/path/to/socket)")
+		candumpFile    = flag.String("candump", "", "Write every adapter frame to this file in candump -L format (- for stdout)")
+		candumpIfaces  = flag.String("candump-interfaces", "", "Comma-separated interface names per bus for the candump trace (default can0, can1, ...)")
+		captureFile    = flag.String("capture", "", "Write adapter frames to this PCAPNG or PCAP file for Wireshark (- for stdout)")
+		captureFormat  = flag.String("capture-format", "", "Capture file format (pcapng|pcap, default pcapng)")
+		captureIfaces  = flag.String("capture-interfaces", "", "Comma-separated interface names per bus for the capture (default can0, can1, ...)")
+		captureTX      = flag.Bool("capture-tx", false, "Include frames transmitted by clients in the capture")
+		captureMaxSize = flag.Int64("capture-max-size", 0, "Rotate the capture file after this many megabytes (0 disables)")
+		captureMaxAge  = flag.Duration("capture-max-age", 0, "Rotate the capture file after this long (0 disables)")
+		captureBackups = flag.Int("capture-max-backups", 0, "Number of rotated capture files to keep")
+		ascFile        = flag.String("asc", "", "Write adapter frames to this file in Vector ASC format (- for stdout)")
+		ascTX          = flag.Bool("asc-tx", false, "Include frames transmitted by clients in the ASC trace")
+		trcFile        = flag.String("trc", "", "Write adapter frames to this file in PEAK TRC 2.1 format (- for stdout)")
+		trcPerBus      = flag.Bool("trc-per-bus", false, "Write one TRC file per bus, named FILE-bus<n>.trc")
+		trcTX          = flag.Bool("trc-tx", false, "Include frames transmitted by clients in the TRC trace")
+		replayFile     = flag.String("replay", "", "Serve frames from this candump, ASC or TRC file instead of connecting to the adapter")
+		replayFormat   = flag.String("replay-format", "", "Format of the replay file (candump|asc|trc, default from the file extension)")
+		replaySpeed    = flag.Float64("replay-speed", def.Replay.Speed, "Replay speed factor; 2 replays twice as fast")
+		replayLoop     = flag.Bool("replay-loop", false, "Restart the replay after the last frame")
+		replayStart    = flag.Duration("replay-start", 0, "Skip the frames before this offset from the first frame of the replay file")
+		replayEnd      = flag.Duration("replay-end", 0, "Stop the replay at this offset from the first frame (0 replays to the end)")
+		canInterface   = flag.String("socketcan-interface", "", "SocketCAN interface used by the socketcan backend, e.g. can0")
+		canMirror      = flag.String("socketcan-mirror", "", "Copy all adapter frames to this SocketCAN interface, e.g. vcan0")
+		canMirrorTX    = flag.Bool("socketcan-mirror-tx", false, "Forward frames sent on the mirror interface to the adapter")
+		tunnelPeer     = flag.String("cannelloni-peer", "", "host:port of a cannelloni peer to exchange frames with over UDP")
+		tunnelListen   = flag.String("cannelloni-listen", def.Cannelloni.Listen, "Local UDP address of the cannelloni tunnel")
+		tunnelTimeout  = flag.Duration("cannelloni-timeout", time.Duration(def.Cannelloni.Timeout), "Time to collect frames before sending a cannelloni packet")
+		statsInterval  = flag.Duration("stats-interval", time.Duration(def.StatsInterval), "Interval for logging bus load statistics (0 disables)")
 	)
 
+	var extraListeners []app.ListenerConfig
+	flag.Func("listener", "Additional client listener as protocol=address, e.g. slcan=unix:/run/bridge.sock or gvret=tcp6:[::]:23 (repeatable)", func(spec string) error {
+		protocol, address, ok := strings.Cut(spec, "=")
+		if !ok || protocol == "" || address == "" {
+			return fmt.Errorf("expected protocol=address, got %q", spec)
+		}
+		extraListeners = append(extraListeners, app.ListenerConfig{Protocol: protocol, Address: address})
+		return nil
+	})
+
 	flag.Parse()
 
-	cfg := app.Config{
-		EByteAddress:   fmt.Sprintf("%s:%d", *ebyteHost, *ebytePort),
-		ListenAddress:  fmt.Sprintf("%s:%d", *listenHost, *listenPort),
-		ReconnectDelay: *reconnectDelay,
-		LogLevel:       *logLevel,
-		BusBitrate:     uint32(*busBitrate),
+	// applyFlags overrides cfg with the flags given explicitly on the command
+	// line, so unset flags do not mask values from the file or environment.
+	applyFlags := func(cfg *app.Config) error {
+		var err error
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "backend":
+				cfg.Backend = *backend
+			case "ebyte-host":
+				cfg.EByteAddress = replaceHost(cfg.EByteAddress, *ebyteHost)
+			case "ebyte-port":
+				cfg.EByteAddress = replacePort(cfg.EByteAddress, *ebytePort)
+			case "ebyte-failover":
+				cfg.FailoverAddresses = splitList(*failover)
+			case "failover-after":
+				cfg.FailoverAfter = *failoverAfter
+			case "failback-interval":
+				cfg.FailbackInterval = app.Duration(*failback)
+			case "listen-host":
+				cfg.ListenAddress = replaceHost(cfg.ListenAddress, *listenHost)
+			case "listen-port":
+				cfg.ListenAddress = replacePort(cfg.ListenAddress, *listenPort)
+			case "listen-protocol":
+				cfg.ListenProtocol = *listenProto
+			case "detect-timeout":
+				cfg.Detect.Timeout = app.Duration(*detectTimeout)
+			case "detect-fallback":
+				cfg.Detect.Fallback = *detectFallback
+			case "listen-tls":
+				cfg.ListenTLS = *listenTLS
+			case "listener":
+				cfg.Listeners = extraListeners
+			case "slcan-listen":
+				cfg.SLCANListenAddress = *slcanListen
+			case "slcan-tls":
+				cfg.SLCANListenTLS = *slcanTLS
+			case "listen-allow":
+				cfg.ListenAccess.Allow = splitList(*listenAllow)
+			case "listen-deny":
+				cfg.ListenAccess.Deny = splitList(*listenDeny)
+			case "slcan-allow":
+				cfg.SLCANListenAccess.Allow = splitList(*slcanAllow)
+			case "slcan-deny":
+				cfg.SLCANListenAccess.Deny = splitList(*slcanDeny)
+			case "max-clients":
+				cfg.MaxClients = *maxClients
+			case "max-clients-per-ip":
+				cfg.MaxClientsPerIP = *maxClientsIP
+			case "tls-cert":
+				cfg.TLS.CertFile = *tlsCert
+			case "tls-key":
+				cfg.TLS.KeyFile = *tlsKey
+			case "tls-client-ca":
+				cfg.TLS.ClientCAFile = *tlsClientCA
+			case "tls-require-client-cert":
+				cfg.TLS.RequireClientCert = *tlsRequireCert
+			case "tls-allowed-clients":
+				cfg.TLS.AllowedClients = splitList(*tlsAllowed)
+			case "reconnect-delay":
+				cfg.ReconnectDelay = app.Duration(*reconnectDelay)
+			case "reconnect-max-delay":
+				cfg.ReconnectMaxDelay = app.Duration(*reconnectMax)
+			case "reconnect-multiplier":
+				cfg.ReconnectMultiplier = *reconnectMult
+			case "reconnect-jitter":
+				cfg.ReconnectJitter = *reconnectJit
+			case "dial-timeout":
+				cfg.DialTimeout = app.Duration(*dialTimeout)
+			case "keepalive-idle":
+				cfg.KeepAliveIdle = app.Duration(*keepAliveIdle)
+			case "keepalive-interval":
+				cfg.KeepAliveInterval = app.Duration(*keepAliveIntvl)
+			case "keepalive-count":
+				cfg.KeepAliveCount = *keepAliveCount
+			case "adapter-idle-timeout":
+				cfg.AdapterIdleTimeout = app.Duration(*idleTimeout)
+			case "shutdown-timeout":
+				cfg.ShutdownTimeout = app.Duration(*shutdownTime)
+			case "log-level":
+				cfg.Log.Level = *logLevel
+			case "log-levels":
+				var levels map[string]string
+				if levels, err = parseComponentLevels(*logLevels); err != nil {
+					err = fmt.Errorf("invalid -log-levels: %w", err)
+				}
+				cfg.Log.ComponentLevels = levels
+			case "log-format":
+				cfg.Log.Format = *logFormat
+			case "log-file":
+				cfg.Log.File = *logFile
+			case "log-max-size":
+				cfg.Log.MaxSize = *logMaxSize << 20
+			case "log-max-backups":
+				cfg.Log.MaxBackups = *logMaxBackups
+			case "can-bitrate":
+				cfg.BusBitrate = uint32(*busBitrate)
+			case "admin-listen":
+				cfg.AdminAddress = *adminAddress
+			case "candump":
+				cfg.Candump.File = *candumpFile
+			case "candump-interfaces":
+				cfg.Candump.Interfaces = splitList(*candumpIfaces)
+			case "capture":
+				cfg.Capture.File = *captureFile
+			case "capture-format":
+				cfg.Capture.Format = *captureFormat
+			case "capture-interfaces":
+				cfg.Capture.Interfaces = splitList(*captureIfaces)
+			case "capture-tx":
+				cfg.Capture.IncludeTX = *captureTX
+			case "capture-max-size":
+				cfg.Capture.Rotation.MaxSize = *captureMaxSize << 20
+			case "capture-max-age":
+				cfg.Capture.Rotation.MaxAge = app.Duration(*captureMaxAge)
+			case "capture-max-backups":
+				cfg.Capture.Rotation.MaxBackups = *captureBackups
+			case "asc":
+				cfg.ASC.File = *ascFile
+			case "asc-tx":
+				cfg.ASC.IncludeTX = *ascTX
+			case "trc":
+				cfg.TRC.File = *trcFile
+			case "trc-per-bus":
+				cfg.TRC.PerBus = *trcPerBus
+			case "trc-tx":
+				cfg.TRC.IncludeTX = *trcTX
+			case "replay":
+				cfg.Replay.File = *replayFile
+			case "replay-format":
+				cfg.Replay.Format = *replayFormat
+			case "replay-speed":
+				cfg.Replay.Speed = *replaySpeed
+			case "replay-loop":
+				cfg.Replay.Loop = *replayLoop
+			case "replay-start":
+				cfg.Replay.Start = app.Duration(*replayStart)
+			case "replay-end":
+				cfg.Replay.End = app.Duration(*replayEnd)
+			case "socketcan-interface":
+				cfg.SocketCAN.Interface = *canInterface
+			case "socketcan-mirror":
+				cfg.SocketCAN.Mirror = *canMirror
+			case "socketcan-mirror-tx":
+				cfg.SocketCAN.MirrorTX = *canMirrorTX
+			case "cannelloni-peer":
+				cfg.Cannelloni.Peer = *tunnelPeer
+			case "cannelloni-listen":
+				cfg.Cannelloni.Listen = *tunnelListen
+			case "cannelloni-timeout":
+				cfg.Cannelloni.Timeout = app.Duration(*tunnelTimeout)
+			case "stats-interval":
+				cfg.StatsInterval = app.Duration(*statsInterval)
+			}
+		})
+		return err
+	}
+
+	// loadConfig merges defaults, configuration file, environment and flags
+	// in increasing order of precedence.
+	loadConfig := func() (app.Config, error) {
+		cfg := app.DefaultConfig()
+		if *configPath != "" {
+			if err := app.LoadConfigFile(*configPath, &cfg); err != nil {
+				return cfg, err
+			}
+		}
+		if err := app.ApplyEnv(&cfg, os.LookupEnv); err != nil {
+			return cfg, err
+		}
+		if err := applyFlags(&cfg); err != nil {
+			return cfg, err
+		}
+		return cfg, cfg.Validate()
+	}
+
+	cfg, err := loadConfig()
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "configuration invalid:")
+			for _, e := range flattenErrors(err) {
+				fmt.Fprintf(os.Stderr, "  %v\n", e)
+			}
+			os.Exit(1)
+		}
+		fmt.Println(cfg)
+		fmt.Fprintln(os.Stderr, "configuration OK")
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	bridge, err := app.New(cfg)
 	if err != nil {
 		log.Fatalf("failed to initialise bridge: %v", err)
 	}
+	defer bridge.Close()
+
+	go reloadOnHangup(ctx, bridge, loadConfig)
 
 	if err := bridge.Run(ctx); err != nil {
-		log.Fatalf("bridge terminated: %v", err)
+		log.Printf("bridge terminated: %v", err)
+		bridge.Close()
+		os.Exit(1)
+	}
+}
+
+// reloadOnHangup re-reads the configuration on SIGHUP and applies it to the
+// running bridge.
+func reloadOnHangup(ctx context.Context, bridge *app.Bridge, load func() (app.Config, error)) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+		}
+		cfg, err := load()
+		if err == nil {
+			err = bridge.Reload(cfg)
+		}
+		if err != nil {
+			bridge.Logger("bridge").Error("configuration reload failed, keeping previous settings", "error", err)
+		}
+	}
+}
+
+// flattenErrors unpacks errors created by errors.Join so that each problem
+// can be printed on its own line.
+func flattenErrors(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// parseComponentLevels splits a comma-separated list of component=level pairs.
+func parseComponentLevels(spec string) (map[string]string, error) {
+	levels := make(map[string]string)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(part, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected component=level, got %q", part)
+		}
+		levels[strings.TrimSpace(name)] = strings.TrimSpace(level)
 	}
+	return levels, nil
+}
+
+// splitList splits a comma-separated flag value and drops empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func splitHostPort(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+func replaceHost(addr, host string) string {
+	_, port := splitHostPort(addr)
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func replacePort(addr string, port int) string {
+	host, _ := splitHostPort(addr)
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
@@ -0,0 +1,313 @@
+// Package sim implements a simulated EByte CAN-to-Ethernet adapter that
+// serves synthetic traffic in the adapter's 13-byte frame format.
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+// Cyclic describes a frame that is sent periodically. Its first data byte
+// is a counter that increments with every transmission and its last data
+// byte a checksum; see Payload.
+type Cyclic struct {
+	ID       uint32
+	Extended bool
+	Period   time.Duration
+	DLC      uint8
+}
+
+// ParseCyclic parses "ID:PERIOD[:DLC]", e.g. "0x100:10ms" or
+// "0x18DAF110x:100ms:4". The identifier is hexadecimal with an optional
+// "0x" prefix; a trailing "x" or an identifier above 0x7FF selects an
+// extended frame. The DLC defaults to 8.
+func ParseCyclic(spec string) (Cyclic, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Cyclic{}, fmt.Errorf("invalid cyclic frame %q, expected ID:PERIOD[:DLC]", spec)
+	}
+	var c Cyclic
+	idText, extended := strings.CutSuffix(strings.TrimPrefix(strings.ToLower(parts[0]), "0x"), "x")
+	id, err := strconv.ParseUint(idText, 16, 32)
+	if err != nil || id > 0x1FFFFFFF {
+		return Cyclic{}, fmt.Errorf("invalid identifier %q", parts[0])
+	}
+	c.ID = uint32(id)
+	c.Extended = extended || id > 0x7FF
+	if c.Period, err = time.ParseDuration(parts[1]); err != nil || c.Period <= 0 {
+		return Cyclic{}, fmt.Errorf("invalid period %q", parts[1])
+	}
+	c.DLC = 8
+	if len(parts) == 3 {
+		dlc, err := strconv.ParseUint(parts[2], 10, 8)
+		if err != nil || dlc > 8 {
+			return Cyclic{}, fmt.Errorf("invalid DLC %q", parts[2])
+		}
+		c.DLC = uint8(dlc)
+	}
+	return c, nil
+}
+
+// Payload returns the data of the cyclic frame for the given counter value:
+// the counter in the first byte, the byte index in the bytes between, and
+// in the last byte the sum of the identifier's four bytes and all other
+// data bytes, modulo 256. Frames with a DLC of one carry only the counter.
+func (c Cyclic) Payload(counter uint8) [8]byte {
+	var data [8]byte
+	if c.DLC == 0 {
+		return data
+	}
+	data[0] = counter
+	if c.DLC == 1 {
+		return data
+	}
+	last := c.DLC - 1
+	for i := uint8(1); i < last; i++ {
+		data[i] = i
+	}
+	data[last] = Checksum(c.ID, data[:last])
+	return data
+}
+
+// Checksum returns the sum of the bytes of id and data modulo 256.
+func Checksum(id uint32, data []byte) byte {
+	sum := byte(id) + byte(id>>8) + byte(id>>16) + byte(id>>24)
+	for _, v := range data {
+		sum += v
+	}
+	return sum
+}
+
+// Config controls the traffic of the simulator.
+type Config struct {
+	Cyclic []Cyclic
+	// BurstInterval sends BurstSize frames with random standard
+	// identifiers and data back to back at this interval; zero disables
+	// bursts.
+	BurstInterval time.Duration
+	BurstSize     int
+	// TruncateRate is the probability that a frame is cut short, which
+	// shifts the frame boundaries of everything that follows.
+	TruncateRate float64
+	// MisalignRate is the probability that one to twelve junk bytes are
+	// sent before a frame.
+	MisalignRate float64
+	// Echo sends every frame received from the client back to it.
+	Echo bool
+	// Seed makes the random traffic reproducible; zero picks a random
+	// seed.
+	Seed uint64
+}
+
+// Server accepts clients and serves each with its own traffic.
+type Server struct {
+	cfg Config
+	log *slog.Logger
+}
+
+// New creates a simulator with the given traffic settings.
+func New(cfg Config, log *slog.Logger) *Server {
+	return &Server{cfg: cfg, log: log}
+}
+
+// Serve accepts connections on l until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// counters tracks the traffic of one connection.
+type counters struct {
+	sent, received, injected int
+}
+
+// handle serves one client until it disconnects or ctx is cancelled.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	log := s.log.With("remote", conn.RemoteAddr().String())
+	log.Info("client connected")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	seed := s.cfg.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	rng := rand.New(rand.NewPCG(seed, seed))
+
+	frames := make(chan ebyte.Frame, 64)
+	var wg sync.WaitGroup
+	for _, c := range s.cfg.Cyclic {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runCyclic(ctx, c, frames)
+		}()
+	}
+	if s.cfg.BurstInterval > 0 && s.cfg.BurstSize > 0 {
+		burstRNG := rand.New(rand.NewPCG(seed, seed+1))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runBursts(ctx, s.cfg.BurstInterval, s.cfg.BurstSize, burstRNG, frames)
+		}()
+	}
+
+	var count counters
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		defer cancel()
+		count.received = s.receive(ctx, conn, log, frames)
+	}()
+
+	writeErr := s.transmit(ctx, conn, log, rng, frames, &count)
+	cancel()
+	wg.Wait()
+	<-readDone
+	_ = conn.Close()
+	log.Info("client disconnected", "sent", count.sent, "received", count.received, "injected_errors", count.injected, "error", writeErr)
+}
+
+// runCyclic queues c every period with an incrementing counter.
+func runCyclic(ctx context.Context, c Cyclic, out chan<- ebyte.Frame) {
+	ticker := time.NewTicker(c.Period)
+	defer ticker.Stop()
+	var counter uint8
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		frame := ebyte.Frame{ID: c.ID, Extended: c.Extended, DLC: c.DLC, Data: c.Payload(counter)}
+		counter++
+		select {
+		case out <- frame:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runBursts queues size random frames every interval.
+func runBursts(ctx context.Context, interval time.Duration, size int, rng *rand.Rand, out chan<- ebyte.Frame) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for range size {
+			frame := ebyte.Frame{ID: rng.Uint32N(0x800), DLC: uint8(rng.IntN(9))}
+			for i := range frame.DLC {
+				frame.Data[i] = byte(rng.Uint32())
+			}
+			select {
+			case out <- frame:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// transmit writes queued frames to the client, injecting the configured
+// errors, until ctx is cancelled or a write fails.
+func (s *Server) transmit(ctx context.Context, conn net.Conn, log *slog.Logger, rng *rand.Rand, frames <-chan ebyte.Frame, count *counters) error {
+	for {
+		var frame ebyte.Frame
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame = <-frames:
+		}
+		raw, err := ebyte.SerializeFrame(frame)
+		if err != nil {
+			return err
+		}
+		if s.cfg.MisalignRate > 0 && rng.Float64() < s.cfg.MisalignRate {
+			junk := make([]byte, 1+rng.IntN(ebyte.FrameSize-1))
+			for i := range junk {
+				junk[i] = byte(rng.Uint32())
+			}
+			log.Warn("injecting junk bytes", "bytes", len(junk))
+			raw = append(junk, raw...)
+			count.injected++
+		}
+		if s.cfg.TruncateRate > 0 && rng.Float64() < s.cfg.TruncateRate {
+			n := 1 + rng.IntN(ebyte.FrameSize-1)
+			log.Warn("injecting truncated frame", "frame_id", fmt.Sprintf("0x%X", frame.ID), "bytes", n)
+			raw = raw[:len(raw)-ebyte.FrameSize+n]
+			count.injected++
+		}
+		if _, err := conn.Write(raw); err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		count.sent++
+	}
+}
+
+// receive logs the frames sent by the client and echoes them if enabled.
+// It returns the number of frames received.
+func (s *Server) receive(ctx context.Context, conn net.Conn, log *slog.Logger, echo chan<- ebyte.Frame) int {
+	received := 0
+	raw := make([]byte, ebyte.FrameSize)
+	for {
+		if _, err := io.ReadFull(conn, raw); err != nil {
+			if ctx.Err() == nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Warn("read failed", "error", err)
+			}
+			return received
+		}
+		frame, err := ebyte.ParseFrame(raw)
+		if err != nil {
+			log.Warn("invalid frame received", "raw", fmt.Sprintf("% X", raw), "error", err)
+			continue
+		}
+		received++
+		log.Info("frame received", "frame_id", fmt.Sprintf("0x%X", frame.ID), "extended", frame.Extended,
+			"remote", frame.Remote, "dlc", frame.DLC, "data", fmt.Sprintf("% X", frame.Data[:frame.DLC]))
+		if s.cfg.Echo {
+			select {
+			case echo <- frame:
+			case <-ctx.Done():
+				return received
+			}
+		}
+	}
+}
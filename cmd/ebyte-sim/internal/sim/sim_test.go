@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/internal/ebyte"
+)
+
+func TestParseCyclic(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Cyclic
+	}{
+		{"0x100:10ms", Cyclic{ID: 0x100, Period: 10 * time.Millisecond, DLC: 8}},
+		{"7df:1s:2", Cyclic{ID: 0x7DF, Period: time.Second, DLC: 2}},
+		{"18DAF110x:100ms:4", Cyclic{ID: 0x18DAF110, Extended: true, Period: 100 * time.Millisecond, DLC: 4}},
+		{"0x10x:5ms", Cyclic{ID: 0x10, Extended: true, Period: 5 * time.Millisecond, DLC: 8}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCyclic(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseCyclic(%q) returned error: %v", tt.spec, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseCyclic(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+	for _, spec := range []string{"0x100", "0x100:0s", "zz:10ms", "0x100:10ms:9", "0x20000000:10ms", "1:2:3:4"} {
+		if _, err := ParseCyclic(spec); err == nil {
+			t.Fatalf("ParseCyclic(%q) accepted invalid spec", spec)
+		}
+	}
+}
+
+func TestPayloadChecksum(t *testing.T) {
+	c := Cyclic{ID: 0x123, DLC: 4}
+	data := c.Payload(7)
+	if data[0] != 7 || data[1] != 1 || data[2] != 2 {
+		t.Fatalf("unexpected payload % X", data)
+	}
+	want := byte(0x01 + 0x23 + 7 + 1 + 2)
+	if data[3] != want {
+		t.Fatalf("checksum = %02X, want %02X", data[3], want)
+	}
+	if data[4] != 0 {
+		t.Fatalf("payload beyond DLC not zero: % X", data)
+	}
+}
+
+func startServer(t *testing.T, cfg Config) net.Conn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))).Serve(ctx, l) }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve returned error: %v", err)
+		}
+	})
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readFrame(t *testing.T, conn net.Conn) ebyte.Frame {
+	t.Helper()
+	raw := make([]byte, ebyte.FrameSize)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	frame, err := ebyte.ParseFrame(raw)
+	if err != nil {
+		t.Fatalf("parse frame: %v", err)
+	}
+	return frame
+}
+
+func TestServeCyclicCounter(t *testing.T) {
+	c := Cyclic{ID: 0x18DAF110, Extended: true, Period: time.Millisecond, DLC: 8}
+	conn := startServer(t, Config{Cyclic: []Cyclic{c}})
+	for i := range 5 {
+		frame := readFrame(t, conn)
+		if frame.ID != c.ID || !frame.Extended || frame.DLC != 8 {
+			t.Fatalf("unexpected frame %+v", frame)
+		}
+		if frame.Data != c.Payload(uint8(i)) {
+			t.Fatalf("frame %d data % X, want % X", i, frame.Data, c.Payload(uint8(i)))
+		}
+	}
+}
+
+func TestServeEcho(t *testing.T) {
+	conn := startServer(t, Config{Echo: true})
+	sent := ebyte.Frame{ID: 0x321, DLC: 3, Data: [8]byte{1, 2, 3}}
+	raw, err := ebyte.SerializeFrame(sent)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	if _, err := conn.Write(raw); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got := readFrame(t, conn); got != sent {
+		t.Fatalf("echo = %+v, want %+v", got, sent)
+	}
+}
+
+func TestServeInjectsErrors(t *testing.T) {
+	c := Cyclic{ID: 0x100, Period: time.Millisecond, DLC: 8}
+	conn := startServer(t, Config{Cyclic: []Cyclic{c}, TruncateRate: 1, Seed: 1})
+	raw := make([]byte, 3*ebyte.FrameSize)
+	if _, err := io.ReadFull(conn, raw); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	// With every frame truncated the stream can no longer start with a
+	// complete, well-formed frame at each 13-byte boundary.
+	header, _ := ebyte.SerializeFrame(ebyte.Frame{ID: c.ID, DLC: 8, Data: c.Payload(0)})
+	if bytes.Equal(raw[:ebyte.FrameSize], header) {
+		t.Fatalf("expected first frame to be truncated")
+	}
+}
@@ -0,0 +1,97 @@
+// Command ebyte-sim simulates an EByte CAN-to-Ethernet adapter for testing
+// the bridge without hardware.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/example/ebyte_can_ethernet_to_slcan/cmd/ebyte-sim/internal/sim"
+)
+
+// cyclicFlags collects repeated -cyclic flags.
+type cyclicFlags []sim.Cyclic
+
+func (c *cyclicFlags) String() string {
+	parts := make([]string, len(*c))
+	for i, v := range *c {
+		parts[i] = fmt.Sprintf("0x%X:%s:%d", v.ID, v.Period, v.DLC)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *cyclicFlags) Set(value string) error {
+	for spec := range strings.SplitSeq(value, ",") {
+		v, err := sim.ParseCyclic(strings.TrimSpace(spec))
+		if err != nil {
+			return err
+		}
+		*c = append(*c, v)
+	}
+	return nil
+}
+
+// main parses CLI flags and serves simulated traffic until interrupted.
+func main() {
+	var cyclic cyclicFlags
+	flag.Var(&cyclic, "cyclic", "Cyclic frame as ID:PERIOD[:DLC], e.g. 0x100:10ms or 18DAF110x:100ms:4 (repeatable, comma-separated)")
+	var (
+		listen        = flag.String("listen", "127.0.0.1:4001", "TCP address to accept bridge connections on")
+		burstInterval = flag.Duration("burst-interval", 0, "Send a burst of random frames at this interval (0 disables)")
+		burstSize     = flag.Int("burst-size", 20, "Number of frames per burst")
+		truncateRate  = flag.Float64("truncate-rate", 0, "Probability (0..1) that a frame is cut short")
+		misalignRate  = flag.Float64("misalign-rate", 0, "Probability (0..1) that junk bytes are sent before a frame")
+		echo          = flag.Bool("echo", false, "Send frames received from the bridge back to it")
+		seed          = flag.Uint64("seed", 0, "Seed for the random traffic (0 picks a random seed)")
+		logLevel      = flag.String("log-level", "info", "Log level (debug|info|warn|error)")
+	)
+	flag.Parse()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -log-level: %v\n", err)
+		os.Exit(2)
+	}
+	for name, rate := range map[string]float64{"truncate-rate": *truncateRate, "misalign-rate": *misalignRate} {
+		if rate < 0 || rate > 1 {
+			fmt.Fprintf(os.Stderr, "-%s must be between 0 and 1\n", name)
+			os.Exit(2)
+		}
+	}
+	if len(cyclic) == 0 {
+		cyclic = cyclicFlags{{ID: 0x100, Period: 100 * time.Millisecond, DLC: 8}}
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Error("listen failed", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("simulator listening", "listen", l.Addr().String(), "cyclic", cyclic.String(),
+		"burst_interval", *burstInterval, "echo", *echo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := sim.New(sim.Config{
+		Cyclic:        cyclic,
+		BurstInterval: *burstInterval,
+		BurstSize:     *burstSize,
+		TruncateRate:  *truncateRate,
+		MisalignRate:  *misalignRate,
+		Echo:          *echo,
+		Seed:          *seed,
+	}, logger)
+	if err := server.Serve(ctx, l); err != nil {
+		logger.Error("simulator stopped", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,329 @@
+package gvret
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"sync"
+)
+
+// replyLength gives the payload length of the answers a device sends to
+// queries. The keepalive answer of real devices carries two more bytes,
+// DE AD, which the parser skips as they do not start a message.
+var replyLength = map[byte]int{
+	CmdTimeSync:        4,
+	CmdDigitalInputs:   2,
+	CmdAnalogInputs:    17,
+	CmdBusParams:       10,
+	CmdDeviceInfo:      6,
+	CmdKeepalive:       0,
+	CmdNumBuses:        1,
+	CmdExtendedBusInfo: 15,
+}
+
+// recvQueue is the number of received frames buffered for Recv. Once it is
+// full the client stops reading from the connection, so answers to queries
+// are delayed until Recv catches up.
+const recvQueue = 1024
+
+// Client talks to a GVRET device or server as a host.
+type Client struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+
+	frames    chan Frame
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+	// err is the reason the connection ended; it is set before done is
+	// closed.
+	err error
+
+	mu      sync.Mutex
+	waiters map[byte][]chan []byte
+}
+
+// Dial connects to a GVRET server at address ("host:port"), switches it to
+// binary mode and waits for the answer to a keepalive to make sure it
+// speaks GVRET. ctx bounds the whole handshake.
+func Dial(ctx context.Context, address string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(ctx, conn)
+}
+
+// NewClient performs the handshake of Dial on an established connection,
+// e.g. a TLS connection. The client owns conn and closes it if the
+// handshake fails.
+func NewClient(ctx context.Context, conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn:    conn,
+		frames:  make(chan Frame, recvQueue),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		waiters: make(map[byte][]chan []byte),
+	}
+	go c.read()
+	err := c.write([]byte{Handshake, Handshake})
+	if err == nil {
+		err = c.Validate(ctx)
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the connection. Pending and later calls return
+// net.ErrClosed.
+func (c *Client) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		err = c.conn.Close()
+	})
+	<-c.done
+	return err
+}
+
+// Recv returns the next frame received from the device. It blocks until a
+// frame arrives or the connection ends; frames received before the end are
+// still returned. At the end it returns io.EOF if the device closed the
+// connection.
+func (c *Client) Recv() (Frame, error) {
+	select {
+	case f := <-c.frames:
+		return f, nil
+	case <-c.done:
+	}
+	select {
+	case f := <-c.frames:
+		return f, nil
+	default:
+		return Frame{}, c.err
+	}
+}
+
+// Send transmits f on the bus given by f.Bus.
+func (c *Client) Send(f Frame) error {
+	data, err := EncodeTransmit(f)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+// Validate sends a keepalive and waits for its answer. SavvyCAN does this
+// periodically to detect dead connections.
+func (c *Client) Validate(ctx context.Context) error {
+	_, err := c.query(ctx, CmdKeepalive)
+	return err
+}
+
+// DeviceTime returns the current device time in microseconds.
+func (c *Client) DeviceTime(ctx context.Context) (uint32, error) {
+	reply, err := c.query(ctx, CmdTimeSync)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(reply), nil
+}
+
+// DeviceInfo queries the firmware build and settings.
+func (c *Client) DeviceInfo(ctx context.Context) (DeviceInfo, error) {
+	reply, err := c.query(ctx, CmdDeviceInfo)
+	if err != nil {
+		return DeviceInfo{}, err
+	}
+	return DeviceInfo{
+		Build:            binary.LittleEndian.Uint16(reply),
+		EEPROMVersion:    reply[2],
+		FileOutputType:   reply[3],
+		AutoStartLogging: reply[4] != 0,
+		SingleWireMode:   reply[5],
+	}, nil
+}
+
+// NumBuses queries the number of buses of the device.
+func (c *Client) NumBuses(ctx context.Context) (int, error) {
+	reply, err := c.query(ctx, CmdNumBuses)
+	if err != nil {
+		return 0, err
+	}
+	return int(reply[0]), nil
+}
+
+// BusParams queries the settings of the two CAN buses.
+func (c *Client) BusParams(ctx context.Context) ([2]BusInfo, error) {
+	reply, err := c.query(ctx, CmdBusParams)
+	if err != nil {
+		return [2]BusInfo{}, err
+	}
+	return [2]BusInfo{parseBusInfo(reply), parseBusInfo(reply[5:])}, nil
+}
+
+// ExtendedBusInfo queries the settings of the single-wire bus.
+func (c *Client) ExtendedBusInfo(ctx context.Context) (BusInfo, error) {
+	reply, err := c.query(ctx, CmdExtendedBusInfo)
+	if err != nil {
+		return BusInfo{}, err
+	}
+	return parseBusInfo(reply), nil
+}
+
+// Buses combines NumBuses, BusParams and ExtendedBusInfo into the settings
+// of every bus of the device.
+func (c *Client) Buses(ctx context.Context) ([]BusInfo, error) {
+	n, err := c.NumBuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params, err := c.BusParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buses := params[:min(n, 2)]
+	if n > 2 {
+		swcan, err := c.ExtendedBusInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		buses = append(buses, swcan)
+	}
+	return buses, nil
+}
+
+// query sends cmd and waits for the device's answer.
+func (c *Client) query(ctx context.Context, cmd byte) ([]byte, error) {
+	ch := make(chan []byte, 1)
+	c.mu.Lock()
+	c.waiters[cmd] = append(c.waiters[cmd], ch)
+	c.mu.Unlock()
+	if err := c.write([]byte{Start, cmd}); err != nil {
+		c.cancel(cmd, ch)
+		select {
+		case <-c.done:
+			// report why the connection ended rather than the write error
+			return nil, c.err
+		default:
+			return nil, err
+		}
+	}
+	select {
+	case reply := <-ch:
+		return reply, nil
+	case <-ctx.Done():
+		c.cancel(cmd, ch)
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// cancel removes a waiter that gave up.
+func (c *Client) cancel(cmd byte, ch chan []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waiters[cmd] = slices.DeleteFunc(c.waiters[cmd], func(w chan []byte) bool { return w == ch })
+}
+
+// answer hands a reply to the oldest waiter for cmd; unsolicited replies
+// are dropped.
+func (c *Client) answer(cmd byte, reply []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.waiters[cmd]
+	if len(waiters) == 0 {
+		return
+	}
+	waiters[0] <- reply
+	c.waiters[cmd] = waiters[1:]
+}
+
+func (c *Client) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(data)
+	return err
+}
+
+// read parses the device's messages until the connection ends.
+func (c *Client) read() {
+	err := c.parse(bufio.NewReader(c.conn))
+	select {
+	case <-c.closing:
+		err = net.ErrClosed
+	default:
+	}
+	c.err = err
+	close(c.done)
+}
+
+// parse reads messages from r. Bytes outside of messages are skipped, and
+// so are messages with unknown commands up to the next Start byte.
+func (c *Client) parse(r *bufio.Reader) error {
+	for {
+		by, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if by != Start {
+			continue
+		}
+		cmd, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if cmd == CmdFrame {
+			f, err := readFrame(r)
+			if err != nil {
+				return err
+			}
+			select {
+			case c.frames <- f:
+			case <-c.closing:
+				return net.ErrClosed
+			}
+			continue
+		}
+		n, ok := replyLength[cmd]
+		if !ok {
+			continue
+		}
+		reply := make([]byte, n)
+		if _, err := io.ReadFull(r, reply); err != nil {
+			return err
+		}
+		c.answer(cmd, reply)
+	}
+}
+
+// readFrame reads the rest of a CmdFrame message sent by a device.
+func readFrame(r *bufio.Reader) (Frame, error) {
+	var head [9]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return Frame{}, err
+	}
+	f := Frame{
+		Timestamp: binary.LittleEndian.Uint32(head[0:4]),
+		Bus:       head[8] >> 4,
+		DLC:       min(head[8]&0x0F, 8),
+	}
+	f.decodeID(binary.LittleEndian.Uint32(head[4:8]))
+	// data followed by the unused checksum byte
+	if _, err := io.ReadFull(r, f.Data[:f.DLC]); err != nil {
+		return Frame{}, err
+	}
+	if _, err := r.ReadByte(); err != nil {
+		return Frame{}, err
+	}
+	return f, nil
+}
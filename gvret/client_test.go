@@ -0,0 +1,201 @@
+package gvret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// connDevice serves a Session over a connection like a real device: it
+// answers keepalives with the trailing DE AD bytes of ESP32RET and echoes
+// transmitted frames as received frames.
+type connDevice struct {
+	conn  net.Conn
+	buses []BusInfo
+}
+
+func (d *connDevice) Transmit(f Frame) {
+	f.Timestamp = d.Timestamp()
+	data, _ := EncodeFrame(f)
+	_, _ = d.conn.Write(data)
+}
+
+func (d *connDevice) Reply(data []byte) {
+	if bytes.Equal(data, []byte{Start, CmdKeepalive}) {
+		data = append(data, 0xDE, 0xAD)
+	}
+	_, _ = d.conn.Write(data)
+}
+
+func (d *connDevice) Timestamp() uint32 { return 1234 }
+func (d *connDevice) Buses() []BusInfo  { return d.buses }
+
+// startDevice serves every connection with a Session and returns the
+// address.
+func startDevice(t *testing.T, buses []BusInfo) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				s := NewSession(&connDevice{conn: conn, buses: buses})
+				buf := make([]byte, 256)
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					s.Receive(buf[:n])
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func dialTest(t *testing.T, address string) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, address)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestClientSendRecv(t *testing.T) {
+	c := dialTest(t, startDevice(t, nil))
+
+	sent := []Frame{
+		{ID: 0x123, DLC: 2, Data: [8]byte{0xAA, 0xBB}},
+		{ID: 0x18DAF110, Extended: true, Bus: 1, DLC: 8, Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{ID: 0x7DF, Remote: true, DLC: 3},
+	}
+	for _, f := range sent {
+		if err := c.Send(f); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+	for _, want := range sent {
+		got, err := c.Recv()
+		if err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		want.Timestamp = 1234
+		if got != want {
+			t.Fatalf("Recv = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestClientQueries(t *testing.T) {
+	buses := []BusInfo{{Enabled: true, Bitrate: 500000}, {Enabled: true, ListenOnly: true, Bitrate: 250000}, {Bitrate: 33333}}
+	c := dialTest(t, startDevice(t, buses))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if ts, err := c.DeviceTime(ctx); err != nil || ts != 1234 {
+		t.Fatalf("DeviceTime = %d, %v", ts, err)
+	}
+	if info, err := c.DeviceInfo(ctx); err != nil || info.Build != 0x0100 {
+		t.Fatalf("DeviceInfo = %+v, %v", info, err)
+	}
+	got, err := c.Buses(ctx)
+	if err != nil {
+		t.Fatalf("Buses: %v", err)
+	}
+	if len(got) != len(buses) {
+		t.Fatalf("Buses = %+v, want %+v", got, buses)
+	}
+	for i := range buses {
+		if got[i] != buses[i] {
+			t.Fatalf("bus %d = %+v, want %+v", i, got[i], buses[i])
+		}
+	}
+}
+
+func TestClientEOF(t *testing.T) {
+	server, peer := net.Pipe()
+	go func() {
+		// answer the handshake, send one frame and hang up
+		buf := make([]byte, 4)
+		_, _ = io.ReadFull(peer, buf)
+		_, _ = peer.Write([]byte{Start, CmdKeepalive})
+		data, _ := EncodeFrame(Frame{ID: 0x100, DLC: 1, Data: [8]byte{7}})
+		_, _ = peer.Write(data)
+		_ = peer.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := NewClient(ctx, server)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer c.Close()
+
+	if f, err := c.Recv(); err != nil || f.ID != 0x100 || f.Data[0] != 7 {
+		t.Fatalf("Recv = %+v, %v", f, err)
+	}
+	if _, err := c.Recv(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if err := c.Validate(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF from query, got %v", err)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	c := dialTest(t, startDevice(t, nil))
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Recv()
+		done <- err
+	}()
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, got %v", err)
+	}
+	if err := c.Send(Frame{ID: 1}); err == nil {
+		t.Fatalf("expected Send to fail after Close")
+	}
+}
+
+func TestDialRequiresGVRET(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			_, _ = io.Copy(io.Discard, conn)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Dial(ctx, l.Addr().String()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected handshake timeout, got %v", err)
+	}
+}
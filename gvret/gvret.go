@@ -0,0 +1,159 @@
+// Package gvret implements the binary GVRET protocol spoken by SavvyCAN and
+// by CAN interfaces running the GVRET firmware family such as ESP32RET and
+// M2RET.
+//
+// A host switches a device to binary mode by sending two 0xE7 bytes. After
+// that every message starts with 0xF1 followed by a command byte. Frames
+// travel in both directions with command 0x00; the other commands query the
+// device and are answered with the same command byte.
+//
+// Session implements the device side of the protocol, Client the host side.
+package gvret
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Message framing.
+const (
+	// Handshake is sent twice by the host to enter binary mode.
+	Handshake = 0xE7
+	// Start begins every binary message.
+	Start = 0xF1
+)
+
+// Commands following Start.
+const (
+	CmdFrame           = 0x00
+	CmdTimeSync        = 0x01
+	CmdDigitalInputs   = 0x02
+	CmdAnalogInputs    = 0x03
+	CmdSetDigitalOut   = 0x04
+	CmdSetupBus        = 0x05
+	CmdBusParams       = 0x06
+	CmdDeviceInfo      = 0x07
+	CmdSetSingleWire   = 0x08
+	CmdKeepalive       = 0x09
+	CmdSetSystemType   = 0x0A
+	CmdEcho            = 0x0B
+	CmdNumBuses        = 0x0C
+	CmdExtendedBusInfo = 0x0D
+	CmdSetExtendedBus  = 0x0E
+	CmdFDFrame         = 0x14
+)
+
+// Flags in the identifier field of a frame.
+const (
+	flagExtended = 1 << 31
+	flagRemote   = 1 << 30
+	idMask       = 0x1FFFFFFF
+)
+
+// Frame is a classic CAN frame as exchanged over GVRET.
+type Frame struct {
+	// Timestamp is the device time in microseconds at which the frame was
+	// received; it is not transmitted for frames sent by the host.
+	Timestamp uint32
+	ID        uint32
+	// Extended marks a 29-bit identifier. Identifiers above 0x7FF are
+	// always sent as extended.
+	Extended bool
+	Remote   bool
+	// Bus is the index of the device's bus, starting at 0.
+	Bus  uint8
+	DLC  uint8
+	Data [8]byte
+}
+
+// BusInfo describes one bus of a device.
+type BusInfo struct {
+	Enabled    bool
+	ListenOnly bool
+	// Bitrate is the nominal bitrate in bit/s.
+	Bitrate uint32
+}
+
+// DeviceInfo is the device's answer to CmdDeviceInfo.
+type DeviceInfo struct {
+	Build            uint16
+	EEPROMVersion    uint8
+	FileOutputType   uint8
+	AutoStartLogging bool
+	SingleWireMode   uint8
+}
+
+// encodedID returns the identifier field of f with its flags.
+func (f Frame) encodedID() uint32 {
+	id := f.ID & idMask
+	if f.Extended || id > 0x7FF {
+		id |= flagExtended
+	}
+	if f.Remote {
+		id |= flagRemote
+	}
+	return id
+}
+
+// decodeID sets the identifier and flags of f from an identifier field.
+func (f *Frame) decodeID(id uint32) {
+	f.ID = id & idMask
+	f.Extended = id&flagExtended != 0 || f.ID > 0x7FF
+	f.Remote = id&flagRemote != 0
+}
+
+// EncodeFrame renders a frame as sent by a device to the host:
+// F1 00 <timestamp:4> <id:4> <bus<<4 | len> <data:len> 00.
+func EncodeFrame(f Frame) ([]byte, error) {
+	if f.DLC > 8 {
+		return nil, fmt.Errorf("invalid DLC %d", f.DLC)
+	}
+	buf := make([]byte, 0, 12+int(f.DLC))
+	buf = append(buf, Start, CmdFrame)
+	buf = binary.LittleEndian.AppendUint32(buf, f.Timestamp)
+	buf = binary.LittleEndian.AppendUint32(buf, f.encodedID())
+	buf = append(buf, f.DLC|(f.Bus&0x0F)<<4)
+	buf = append(buf, f.Data[:f.DLC]...)
+	return append(buf, 0x00), nil
+}
+
+// EncodeTransmit renders a frame as sent by the host to a device:
+// F1 00 <id:4> <bus> <len> <data:len> 00. The timestamp is not transmitted.
+func EncodeTransmit(f Frame) ([]byte, error) {
+	if f.DLC > 8 {
+		return nil, fmt.Errorf("invalid DLC %d", f.DLC)
+	}
+	buf := make([]byte, 0, 9+int(f.DLC))
+	buf = append(buf, Start, CmdFrame)
+	buf = binary.LittleEndian.AppendUint32(buf, f.encodedID())
+	buf = append(buf, f.Bus, f.DLC)
+	buf = append(buf, f.Data[:f.DLC]...)
+	return append(buf, 0x00), nil
+}
+
+// flags encodes the enabled and listen-only settings of a bus.
+func (i BusInfo) flags() byte {
+	var flags byte
+	if i.Enabled {
+		flags |= 0x01
+	}
+	if i.ListenOnly {
+		flags |= 0x10
+	}
+	return flags
+}
+
+// appendBusInfo appends the flags and bitrate of a bus.
+func appendBusInfo(buf []byte, info BusInfo) []byte {
+	buf = append(buf, info.flags())
+	return binary.LittleEndian.AppendUint32(buf, info.Bitrate)
+}
+
+// parseBusInfo decodes the five bytes written by appendBusInfo.
+func parseBusInfo(data []byte) BusInfo {
+	return BusInfo{
+		Enabled:    data[0]&0x01 != 0,
+		ListenOnly: data[0]&0x10 != 0,
+		Bitrate:    binary.LittleEndian.Uint32(data[1:5]),
+	}
+}
@@ -0,0 +1,207 @@
+package gvret
+
+import "encoding/binary"
+
+// Device provides the device side of a Session.
+type Device interface {
+	// Transmit is called for every frame the host sends.
+	Transmit(f Frame)
+	// Reply sends the answer to a query to the host.
+	Reply(data []byte)
+	// Timestamp returns the current device time in microseconds.
+	Timestamp() uint32
+	// Buses describes the buses of the device. The first two are reported
+	// as the CAN buses, a third one as the single-wire bus.
+	Buses() []BusInfo
+}
+
+// deviceBuild is the firmware build reported to CmdDeviceInfo.
+const deviceBuild = 0x0100
+
+type parserState int
+
+const (
+	stateIdle parserState = iota
+	stateExpectCommand
+	stateFrame
+	stateFDFrame
+	stateSkip
+)
+
+// Session parses the byte stream a host sends to a device and answers its
+// queries. It is not safe for concurrent use.
+type Session struct {
+	dev Device
+
+	binary    bool
+	e7Count   int
+	state     parserState
+	step      int
+	remaining int
+	fdLength  int
+
+	// frame under construction for CmdFrame
+	frameID uint32
+	frame   Frame
+}
+
+// NewSession creates a session that reports to dev. The session starts in
+// the text mode of the firmware and ignores everything up to the handshake.
+func NewSession(dev Device) *Session {
+	return &Session{dev: dev}
+}
+
+// Binary reports whether the host completed the handshake.
+func (s *Session) Binary() bool {
+	return s.binary
+}
+
+// StartBinary switches the session to binary mode as if the host had sent
+// the handshake, for hosts that start with a command right away.
+func (s *Session) StartBinary() {
+	s.binary = true
+	s.state = stateIdle
+	s.e7Count = 0
+}
+
+// Receive processes bytes sent by the host.
+func (s *Session) Receive(data []byte) {
+	for _, by := range data {
+		s.receiveByte(by)
+	}
+}
+
+// receiveByte feeds a single byte into the state machine and triggers
+// responses for recognised commands.
+func (s *Session) receiveByte(by byte) {
+	if !s.binary {
+		if by == Handshake {
+			s.e7Count++
+			if s.e7Count >= 2 {
+				s.binary = true
+				s.state = stateIdle
+				s.e7Count = 0
+			}
+		} else {
+			s.e7Count = 0
+		}
+		return
+	}
+
+	switch s.state {
+	case stateIdle:
+		if by == Start {
+			s.state = stateExpectCommand
+		}
+	case stateExpectCommand:
+		s.state = stateIdle
+		s.step = 0
+		s.command(by)
+	case stateFrame:
+		// F1 00 <id:4 LE> <bus> <len> <data:len> <checksum>
+		s.step++
+		switch {
+		case s.step <= 4:
+			s.frameID |= uint32(by) << (8 * (s.step - 1))
+		case s.step == 5:
+			s.frame.Bus = by
+		case s.step == 6:
+			s.frame.DLC = min(by&0x0F, 8)
+			if s.frame.DLC == 0 {
+				s.transmit()
+			}
+		default:
+			s.frame.Data[s.step-7] = by
+			if s.step-6 == int(s.frame.DLC) {
+				s.transmit()
+			}
+		}
+	case stateFDFrame:
+		s.step++
+		switch s.step {
+		case 1, 2, 3, 4, 5, 6, 7, 8:
+			// timestamp and identifier bytes
+		case 9:
+			s.fdLength = int(by & 0x3F)
+		case 10:
+			s.remaining = s.fdLength + 1 // data + trailing byte
+			if s.remaining <= 0 {
+				s.state = stateIdle
+				s.step = 0
+			} else {
+				s.state = stateSkip
+			}
+		default:
+			s.state = stateIdle
+			s.step = 0
+		}
+	case stateSkip:
+		s.remaining--
+		if s.remaining <= 0 {
+			s.state = stateIdle
+			s.step = 0
+		}
+	}
+}
+
+// transmit hands the frame the host finished sending to the device and
+// skips the trailing checksum byte.
+func (s *Session) transmit() {
+	s.frame.decodeID(s.frameID)
+	s.dev.Transmit(s.frame)
+
+	s.state = stateSkip
+	s.remaining = 1
+}
+
+// command interprets the command byte that follows Start and updates the
+// parser state or sends the answer.
+func (s *Session) command(cmd byte) {
+	switch cmd {
+	case CmdFrame:
+		s.state = stateFrame
+		s.step = 0
+		s.frameID = 0
+		s.frame = Frame{}
+	case CmdTimeSync:
+		s.dev.Reply(binary.LittleEndian.AppendUint32([]byte{Start, CmdTimeSync}, s.dev.Timestamp()))
+	case CmdBusParams:
+		buses := s.dev.Buses()
+		reply := []byte{Start, CmdBusParams}
+		for i := range 2 {
+			reply = appendBusInfo(reply, busAt(buses, i))
+		}
+		s.dev.Reply(reply)
+	case CmdDeviceInfo:
+		reply := binary.LittleEndian.AppendUint16([]byte{Start, CmdDeviceInfo}, deviceBuild)
+		s.dev.Reply(append(reply, 0x00, 0x00, 0x00, 0x00))
+	case CmdKeepalive:
+		s.dev.Reply([]byte{Start, CmdKeepalive})
+	case CmdNumBuses:
+		s.dev.Reply([]byte{Start, CmdNumBuses, byte(len(s.dev.Buses()))})
+	case CmdExtendedBusInfo:
+		// The single-wire bus is followed by two unused LIN buses.
+		reply := appendBusInfo([]byte{Start, CmdExtendedBusInfo}, busAt(s.dev.Buses(), 2))
+		s.dev.Reply(append(reply, make([]byte, 10)...))
+	case CmdSetupBus:
+		s.state = stateSkip
+		s.remaining = 9
+	case CmdSetSingleWire:
+		s.state = stateSkip
+		s.remaining = 2
+	case CmdFDFrame:
+		s.state = stateFDFrame
+		s.step = 0
+		s.fdLength = 0
+	default:
+		s.state = stateIdle
+	}
+}
+
+// busAt returns bus i of buses, or a disabled bus if there is none.
+func busAt(buses []BusInfo, i int) BusInfo {
+	if i < len(buses) {
+		return buses[i]
+	}
+	return BusInfo{}
+}
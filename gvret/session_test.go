@@ -0,0 +1,88 @@
+package gvret
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testDevice records what a Session reports.
+type testDevice struct {
+	frames  []Frame
+	replies [][]byte
+	buses   []BusInfo
+}
+
+func (d *testDevice) Transmit(f Frame)  { d.frames = append(d.frames, f) }
+func (d *testDevice) Reply(data []byte) { d.replies = append(d.replies, data) }
+func (d *testDevice) Timestamp() uint32 { return 0x01020304 }
+func (d *testDevice) Buses() []BusInfo  { return d.buses }
+
+func TestSessionTransmit(t *testing.T) {
+	dev := &testDevice{}
+	s := NewSession(dev)
+	s.Receive([]byte{
+		0xE7, 0xE7,
+		0xF1, 0x00, 0x23, 0x01, 0x00, 0x00, 0x01, 0x02, 0xAA, 0xBB, 0x00,
+		0xF1, 0x00, 0x78, 0x56, 0x34, 0x92, 0x00, 0x00, 0x00,
+	})
+
+	if len(dev.frames) != 2 {
+		t.Fatalf("expected two frames, got %+v", dev.frames)
+	}
+	first := dev.frames[0]
+	if first.ID != 0x123 || first.Extended || first.Bus != 1 || first.DLC != 2 || first.Data[0] != 0xAA || first.Data[1] != 0xBB {
+		t.Fatalf("unexpected first frame %+v", first)
+	}
+	second := dev.frames[1]
+	if second.ID != 0x12345678 || !second.Extended || second.DLC != 0 {
+		t.Fatalf("unexpected second frame %+v", second)
+	}
+	if s.state != stateIdle {
+		t.Fatalf("expected parser to return to idle, got %v", s.state)
+	}
+}
+
+func TestSessionIgnoresCommandsBeforeHandshake(t *testing.T) {
+	dev := &testDevice{}
+	s := NewSession(dev)
+	s.Receive([]byte{0xF1, 0x09, 0xE7, 0x00, 0xE7})
+	if s.Binary() || len(dev.replies) != 0 {
+		t.Fatalf("session answered before the handshake: %x", dev.replies)
+	}
+	s.Receive([]byte{0xE7, 0xE7, 0xF1, 0x09})
+	if !s.Binary() || len(dev.replies) != 1 {
+		t.Fatalf("expected keepalive answer after the handshake, got %x", dev.replies)
+	}
+}
+
+func TestSessionStartBinary(t *testing.T) {
+	dev := &testDevice{}
+	s := NewSession(dev)
+	s.StartBinary()
+	s.Receive([]byte{0xF1, 0x09})
+	if !s.Binary() || len(dev.replies) != 1 {
+		t.Fatalf("expected keepalive answer without the handshake, got %x", dev.replies)
+	}
+}
+
+func TestSessionQueries(t *testing.T) {
+	dev := &testDevice{buses: []BusInfo{{Enabled: true, Bitrate: 500000}}}
+	s := NewSession(dev)
+	s.Receive([]byte{0xE7, 0xE7, 0xF1, 0x01, 0xF1, 0x06, 0xF1, 0x0C, 0xF1, 0x0D, 0xF1, 0x09})
+
+	want := [][]byte{
+		{0xF1, 0x01, 0x04, 0x03, 0x02, 0x01},
+		{0xF1, 0x06, 0x01, 0x20, 0xA1, 0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		{0xF1, 0x0C, 0x01},
+		append([]byte{0xF1, 0x0D}, make([]byte, 15)...),
+		{0xF1, 0x09},
+	}
+	if len(dev.replies) != len(want) {
+		t.Fatalf("got %d replies, want %d: %x", len(dev.replies), len(want), dev.replies)
+	}
+	for i := range want {
+		if !bytes.Equal(dev.replies[i], want[i]) {
+			t.Fatalf("reply %d = % X, want % X", i, dev.replies[i], want[i])
+		}
+	}
+}